@@ -0,0 +1,23 @@
+package command
+
+import "time"
+
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusApplied Status = "applied"
+	StatusFailed  Status = "failed"
+	// StatusConflict means the write was based on a stale skill version.
+	StatusConflict Status = "conflict"
+)
+
+type Command struct {
+	ID        string    `json:"id"`
+	Action    string    `json:"action"`
+	Key       string    `json:"key"`
+	Status    Status    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
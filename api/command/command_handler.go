@@ -0,0 +1,27 @@
+package command
+
+import (
+	"gokafka/response"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type commandHandler struct {
+	commandRepo CommandRepo
+}
+
+func NewCommandHandler(commandRepo CommandRepo) *commandHandler {
+	return &commandHandler{commandRepo: commandRepo}
+}
+
+func (h *commandHandler) GetCommandByID(ctx *gin.Context) {
+	id := ctx.Param("id")
+	command, err := h.commandRepo.GetCommandByID(id)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+
+	response.Success(ctx, http.StatusOK, command)
+}
@@ -0,0 +1,71 @@
+package command
+
+import (
+	"encoding/json"
+	"gokafka/errs"
+	"gokafka/response"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCommandByID(t *testing.T) {
+	t.Run("should response command by id", func(t *testing.T) {
+		//arrange
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: "1"})
+
+		command := Command{
+			ID:        "1",
+			Action:    "create",
+			Key:       "go",
+			Status:    StatusApplied,
+			CreatedAt: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+			UpdatedAt: time.Date(2024, 7, 1, 0, 0, 1, 0, time.UTC),
+		}
+		mock := &mockRepo{command: command}
+		handler := NewCommandHandler(mock)
+
+		want, _ := json.Marshal(response.Response{
+			Status: "success",
+			Data:   command,
+		})
+
+		//act
+		handler.GetCommandByID(c)
+
+		//assert
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, want, w.Body.Bytes())
+	})
+
+	t.Run("should response error when command not found", func(t *testing.T) {
+		//arrange
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: "1"})
+		mock := &mockRepo{err: errs.NewErrorWithCode(http.StatusNotFound, errs.CodeCommandNotFound, "Command not found")}
+		handler := NewCommandHandler(mock)
+
+		want, _ := json.Marshal(response.Problem{
+			Type:   "/problems/command_not_found",
+			Title:  "Not Found",
+			Status: http.StatusNotFound,
+			Detail: "Command not found",
+			Code:   errs.CodeCommandNotFound,
+		})
+
+		//act
+		handler.GetCommandByID(c)
+
+		//assert
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, response.ProblemContentType, w.Header().Get("Content-Type"))
+		assert.Equal(t, want, w.Body.Bytes())
+	})
+}
@@ -0,0 +1,114 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"skillevent"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// Replies tells a waiter when the result of its command was published.
+type Replies interface {
+	// Subscribe returns a channel closed once a result for the command id
+	// comes in, and a function to call when the caller stops waiting.
+	Subscribe(id string) (<-chan struct{}, func())
+}
+
+// ReplyListener reads the results the consumer publishes to the reply topic
+// and wakes the waiters of their commands. Every api instance reads every
+// partition, since the waiter of a command can be on any of them.
+type ReplyListener struct {
+	consumer sarama.Consumer
+	topic    string
+
+	mu      sync.Mutex
+	waiters map[string][]chan struct{}
+}
+
+func NewReplyListener(consumer sarama.Consumer, topic string) *ReplyListener {
+	return &ReplyListener{consumer: consumer, topic: topic, waiters: map[string][]chan struct{}{}}
+}
+
+func (l *ReplyListener) Subscribe(id string) (<-chan struct{}, func()) {
+	settled := make(chan struct{})
+	l.mu.Lock()
+	l.waiters[id] = append(l.waiters[id], settled)
+	l.mu.Unlock()
+
+	return settled, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		waiters := l.waiters[id]
+		for i, waiter := range waiters {
+			if waiter == settled {
+				waiters = append(waiters[:i], waiters[i+1:]...)
+				break
+			}
+		}
+		if len(waiters) == 0 {
+			delete(l.waiters, id)
+			return
+		}
+		l.waiters[id] = waiters
+	}
+}
+
+// settle wakes every waiter of the command id.
+func (l *ReplyListener) settle(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, waiter := range l.waiters[id] {
+		close(waiter)
+	}
+	delete(l.waiters, id)
+}
+
+// Run reads the newest results of every partition until ctx is done, then
+// closes the consumer. When the topic can't be read it returns at once and
+// Wait keeps polling.
+func (l *ReplyListener) Run(ctx context.Context) {
+	defer l.consumer.Close()
+
+	partitions, err := l.consumer.Partitions(l.topic)
+	if err != nil {
+		log.Printf("can't read reply topic %s, waiting on commands by polling: %s\n", l.topic, err)
+		return
+	}
+
+	wg := sync.WaitGroup{}
+	for _, partition := range partitions {
+		pc, err := l.consumer.ConsumePartition(l.topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			log.Printf("can't read reply topic %s partition %d: %s\n", l.topic, partition, err)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.listen(ctx, pc)
+		}()
+	}
+	wg.Wait()
+}
+
+func (l *ReplyListener) listen(ctx context.Context, pc sarama.PartitionConsumer) {
+	defer pc.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-pc.Messages():
+			if !ok {
+				return
+			}
+			result := skillevent.Result{}
+			if err := json.Unmarshal(msg.Value, &result); err != nil || result.CorrelationID == "" {
+				continue
+			}
+			l.settle(result.CorrelationID)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"skillevent"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplyListener(t *testing.T) {
+	t.Run("should wake the waiters of the command a result correlates to", func(t *testing.T) {
+		//arrange
+		consumer := mocks.NewConsumer(t, nil)
+		consumer.SetTopicMetadata(map[string][]int32{"skills.reply": {0, 1}})
+		other, _ := json.Marshal(skillevent.Result{CorrelationID: "2", Key: "rust", Outcome: skillevent.OutcomeApplied})
+		result, _ := json.Marshal(skillevent.Result{CorrelationID: "1", Key: "go", Outcome: skillevent.OutcomeApplied})
+		consumer.ExpectConsumePartition("skills.reply", 0, sarama.OffsetNewest).
+			YieldMessage(&sarama.ConsumerMessage{Value: []byte("not json")}).
+			YieldMessage(&sarama.ConsumerMessage{Value: other})
+		consumer.ExpectConsumePartition("skills.reply", 1, sarama.OffsetNewest).
+			YieldMessage(&sarama.ConsumerMessage{Value: result})
+		listener := NewReplyListener(consumer, "skills.reply")
+		settled, unsubscribe := listener.Subscribe("1")
+		defer unsubscribe()
+		waiting, stopWaiting := listener.Subscribe("3")
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+
+		//act
+		go func() {
+			listener.Run(ctx)
+			close(done)
+		}()
+
+		//assert
+		select {
+		case <-settled:
+		case <-time.After(time.Second):
+			t.Error("expected the waiter of command 1 to be woken")
+		}
+		select {
+		case <-waiting:
+			t.Error("expected the waiter of command 3 to keep waiting")
+		default:
+		}
+		stopWaiting()
+		cancel()
+		<-done
+		listener.mu.Lock()
+		defer listener.mu.Unlock()
+		assert.NotContains(t, listener.waiters, "3")
+	})
+	t.Run("should return when the reply topic can't be read", func(t *testing.T) {
+		//arrange
+		consumer := mocks.NewConsumer(t, nil)
+		consumer.SetTopicMetadata(map[string][]int32{"skills": {0}})
+		listener := NewReplyListener(consumer, "skills.reply")
+		done := make(chan struct{})
+
+		//act
+		go func() {
+			listener.Run(context.Background())
+			close(done)
+		}()
+
+		//assert
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Error("expected the listener to give up on a missing topic")
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package command
+
+import (
+	"database/sql"
+	"gokafka/database"
+	"gokafka/errs"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type commandRepo struct {
+	db database.DBTX
+}
+
+type CommandRepo interface {
+	CreateCommand(action string, key string) (*Command, error)
+	GetCommandByID(id string) (*Command, error)
+	UpdateCommandStatus(id string, status Status, message string) error
+}
+
+func NewCommandRepo(db database.DBTX) *commandRepo {
+	return &commandRepo{db: db}
+}
+
+func (r *commandRepo) CreateCommand(action string, key string) (*Command, error) {
+	now := time.Now().UTC()
+	command := Command{
+		ID:        uuid.NewString(),
+		Action:    action,
+		Key:       key,
+		Status:    StatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	query := "INSERT INTO command (id, action, skill_key, status, error, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7)"
+	_, err := r.db.Exec(query, command.ID, command.Action, command.Key, command.Status, command.Error, command.CreatedAt, command.UpdatedAt)
+	if err != nil {
+		return nil, errs.Internal("not be able to create command", err)
+	}
+	return &command, nil
+}
+
+func (r *commandRepo) GetCommandByID(id string) (*Command, error) {
+	command := Command{}
+	query := "SELECT id, action, skill_key, status, error, created_at, updated_at FROM command WHERE id=$1"
+	err := r.db.QueryRow(query, id).Scan(&command.ID, &command.Action, &command.Key, &command.Status, &command.Error, &command.CreatedAt, &command.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errs.NewErrorWithCode(http.StatusNotFound, errs.CodeCommandNotFound, "Command not found")
+	}
+	if err != nil {
+		return nil, errs.Internal("not be able to get command", err)
+	}
+	return &command, nil
+}
+
+func (r *commandRepo) UpdateCommandStatus(id string, status Status, message string) error {
+	query := "UPDATE command SET status=$1, error=$2, updated_at=$3 WHERE id=$4"
+	_, err := r.db.Exec(query, status, message, time.Now().UTC(), id)
+	if err != nil {
+		return errs.Internal("not be able to update command", err)
+	}
+	return nil
+}
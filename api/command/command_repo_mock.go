@@ -0,0 +1,11 @@
+package command
+
+type mockRepo struct {
+	CommandRepo
+	err     error
+	command Command
+}
+
+func (m *mockRepo) GetCommandByID(id string) (*Command, error) {
+	return &m.command, m.err
+}
@@ -0,0 +1,91 @@
+package command_test
+
+import (
+	"database/sql"
+	"gokafka/command"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func newMockDB() *sql.DB {
+	db, _ := sql.Open("sqlite", "file:command?mode=memory&cache=shared")
+	q := `
+		CREATE TABLE IF NOT EXISTS command (
+		id TEXT PRIMARY KEY,
+		action TEXT NOT NULL,
+		skill_key TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);
+	`
+	db.Exec(q)
+	return db
+}
+
+func TestCreateCommandRepo(t *testing.T) {
+	//arange
+	db := newMockDB()
+	defer db.Close()
+	repo := command.NewCommandRepo(db)
+
+	//act
+	cmd, err := repo.CreateCommand("create", "go")
+
+	//assert
+	if err != nil {
+		t.Errorf("expected error to be nil but got %v", err)
+	}
+
+	result, err := repo.GetCommandByID(cmd.ID)
+	if err != nil {
+		t.Errorf("expected error to be nil but got %v", err)
+	}
+
+	assert.Equal(t, "create", result.Action)
+	assert.Equal(t, "go", result.Key)
+	assert.Equal(t, command.StatusPending, result.Status)
+	assert.Equal(t, "", result.Error)
+}
+
+func TestGetCommandByIDRepo(t *testing.T) {
+	//arange
+	db := newMockDB()
+	defer db.Close()
+	repo := command.NewCommandRepo(db)
+
+	//act
+	cmd, err := repo.GetCommandByID("not-exist")
+
+	//assert
+	if err == nil {
+		t.Errorf("expected error but got %v", err)
+	}
+
+	if cmd != nil {
+		t.Errorf("expected command to be nil but got %v", cmd)
+	}
+}
+
+func TestUpdateCommandStatusRepo(t *testing.T) {
+	//arange
+	db := newMockDB()
+	defer db.Close()
+	repo := command.NewCommandRepo(db)
+	cmd, _ := repo.CreateCommand("update_name", "go")
+
+	//act
+	err := repo.UpdateCommandStatus(cmd.ID, command.StatusFailed, "skill not found")
+
+	//assert
+	if err != nil {
+		t.Errorf("expected error to be nil but got %v", err)
+	}
+
+	result, _ := repo.GetCommandByID(cmd.ID)
+	assert.Equal(t, command.StatusFailed, result.Status)
+	assert.Equal(t, "skill not found", result.Error)
+}
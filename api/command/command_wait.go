@@ -0,0 +1,50 @@
+package command
+
+import (
+	"context"
+	"time"
+)
+
+// PollInterval is how often Wait reads a command that is still pending when
+// there are no replies to wait on.
+var PollInterval = 100 * time.Millisecond
+
+// FallbackPollInterval is how often Wait reads the command while it waits on
+// the replies, in case the reply was lost or came before the subscription.
+var FallbackPollInterval = time.Second
+
+// Wait blocks until the consumer has settled the command, that is moved it
+// out of pending, or ctx is done. The command is read again as soon as
+// replies report its result; without replies it is polled. On timeout it
+// returns the last command read together with the ctx error.
+func Wait(ctx context.Context, repo CommandRepo, id string, replies Replies) (*Command, error) {
+	interval := PollInterval
+	var settled <-chan struct{}
+	if replies != nil {
+		var unsubscribe func()
+		settled, unsubscribe = replies.Subscribe(id)
+		defer unsubscribe()
+		interval = FallbackPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		command, err := repo.GetCommandByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if command.Status != StatusPending {
+			return command, nil
+		}
+		select {
+		case <-ctx.Done():
+			return command, ctx.Err()
+		case <-settled:
+			// A closed channel is always ready, only read the command
+			// once more for it and poll after that.
+			settled = nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package command
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWait(t *testing.T) {
+	t.Run("should return command once it is settled", func(t *testing.T) {
+		//arrange
+		mock := &mockRepo{command: Command{ID: "1", Status: StatusApplied}}
+
+		//act
+		command, err := Wait(context.Background(), mock, "1", nil)
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, StatusApplied, command.Status)
+	})
+
+	t.Run("should return deadline exceeded when command stays pending", func(t *testing.T) {
+		//arrange
+		mock := &mockRepo{command: Command{ID: "1", Status: StatusPending}}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		//act
+		command, err := Wait(ctx, mock, "1", nil)
+
+		//assert
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, StatusPending, command.Status)
+	})
+}
+
+type settlingRepo struct {
+	CommandRepo
+	mu     sync.Mutex
+	status Status
+	reads  int
+}
+
+func (m *settlingRepo) GetCommandByID(id string) (*Command, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reads++
+	return &Command{ID: id, Status: m.status}, nil
+}
+
+func (m *settlingRepo) settle() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status = StatusApplied
+}
+
+type mockReplies struct {
+	settled chan struct{}
+	ids     []string
+}
+
+func (m *mockReplies) Subscribe(id string) (<-chan struct{}, func()) {
+	m.ids = append(m.ids, id)
+	return m.settled, func() {}
+}
+
+func TestWaitReplies(t *testing.T) {
+	t.Run("should read the command again as soon as its reply comes in", func(t *testing.T) {
+		//arrange
+		repo := &settlingRepo{status: StatusPending}
+		replies := &mockReplies{settled: make(chan struct{})}
+		ctx, cancel := context.WithTimeout(context.Background(), FallbackPollInterval/2)
+		defer cancel()
+		go func() {
+			repo.settle()
+			close(replies.settled)
+		}()
+
+		//act
+		command, err := Wait(ctx, repo, "1", replies)
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, StatusApplied, command.Status)
+		assert.Equal(t, []string{"1"}, replies.ids)
+	})
+	t.Run("should keep polling when the reply never comes", func(t *testing.T) {
+		//arrange
+		interval := FallbackPollInterval
+		FallbackPollInterval = time.Millisecond
+		defer func() { FallbackPollInterval = interval }()
+		repo := &settlingRepo{status: StatusPending}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			repo.settle()
+		}()
+
+		//act
+		command, err := Wait(ctx, repo, "1", &mockReplies{})
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, StatusApplied, command.Status)
+		assert.Greater(t, repo.reads, 1)
+	})
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"errors"
+	"platform/configload"
+	"platform/kafkasecurity"
+	"platform/tracing"
+	"strconv"
+	"time"
+)
+
+// Config is everything the api reads at startup. Each value comes from, in
+// increasing priority, its default, the YAML file, the environment and the
+// command line flags.
+type Config struct {
+	HTTP     HTTPConfig     `yaml:"http"`
+	Database DatabaseConfig `yaml:"database"`
+	Kafka    KafkaConfig    `yaml:"kafka"`
+	Outbox   OutboxConfig   `yaml:"outbox"`
+	Tracing  tracing.Config `yaml:"tracing"`
+}
+
+type HTTPConfig struct {
+	Port string `yaml:"port"`
+	// Mode is the gin mode: debug, release or test.
+	Mode string `yaml:"mode"`
+	// DrainGrace is how long /readyz reports 503 on shutdown before the
+	// server stops, so the load balancer takes the api out of rotation
+	// while requests are still served.
+	DrainGrace time.Duration `yaml:"drain_grace"`
+}
+
+type DatabaseConfig struct {
+	URL string `yaml:"url"`
+}
+
+type KafkaConfig struct {
+	Brokers []string `yaml:"brokers"`
+	// Topic is where the skill events are published.
+	Topic string `yaml:"topic"`
+	// ReplyTopic is where the consumer publishes the command results,
+	// "<topic>.reply" by default.
+	ReplyTopic string                   `yaml:"reply_topic"`
+	TLS        kafkasecurity.TLSConfig  `yaml:"tls"`
+	SASL       kafkasecurity.SASLConfig `yaml:"sasl"`
+}
+
+type OutboxConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval"`
+	MaxBackoff   time.Duration `yaml:"max_backoff"`
+	BatchSize    int           `yaml:"batch_size"`
+	// Retention is how long sent messages are kept before they are purged.
+	Retention time.Duration `yaml:"retention"`
+}
+
+func defaults() Config {
+	return Config{
+		HTTP: HTTPConfig{Port: "8910", Mode: "debug", DrainGrace: 5 * time.Second},
+		Outbox: OutboxConfig{
+			PollInterval: 500 * time.Millisecond,
+			MaxBackoff:   30 * time.Second,
+			BatchSize:    100,
+			Retention:    7 * 24 * time.Hour,
+		},
+		Tracing: tracing.Config{Exporter: "none", ServiceName: "skill-api"},
+	}
+}
+
+var settings = append([]configload.Setting[Config]{
+	{Key: "http.port", Env: "PORT", Flag: "port", Usage: "port the api listens on", Set: configload.String(func(c *Config) *string { return &c.HTTP.Port })},
+	{Key: "http.mode", Env: "GIN_MODE", Flag: "gin-mode", Usage: "gin mode: debug, release or test", Set: configload.String(func(c *Config) *string { return &c.HTTP.Mode })},
+	{Key: "http.drain_grace", Env: "HTTP_DRAIN_GRACE", Flag: "drain-grace", Usage: "how long to report unready before shutting down", Set: configload.Duration(func(c *Config) *time.Duration { return &c.HTTP.DrainGrace })},
+	{Key: "database.url", Env: "DATABASE_URL", Flag: "database-url", Usage: "postgres connection string", Set: configload.String(func(c *Config) *string { return &c.Database.URL })},
+	{Key: "kafka.brokers", Env: "KAFKA_BROKER", Flag: "kafka-brokers", Usage: "comma separated kafka brokers", Set: configload.List(func(c *Config) *[]string { return &c.Kafka.Brokers })},
+	{Key: "kafka.topic", Env: "TOPIC", Flag: "topic", Usage: "topic of the skill events", Set: configload.String(func(c *Config) *string { return &c.Kafka.Topic })},
+	{Key: "kafka.reply_topic", Env: "REPLY_TOPIC", Flag: "reply-topic", Usage: "topic of the command results", Set: configload.String(func(c *Config) *string { return &c.Kafka.ReplyTopic })},
+	{Key: "outbox.poll_interval", Env: "OUTBOX_POLL_INTERVAL", Flag: "outbox-poll-interval", Usage: "how often the outbox is polled", Set: configload.Duration(func(c *Config) *time.Duration { return &c.Outbox.PollInterval })},
+	{Key: "outbox.max_backoff", Env: "OUTBOX_MAX_BACKOFF", Flag: "outbox-max-backoff", Usage: "longest wait between failed relays", Set: configload.Duration(func(c *Config) *time.Duration { return &c.Outbox.MaxBackoff })},
+	{Key: "outbox.batch_size", Env: "OUTBOX_BATCH_SIZE", Flag: "outbox-batch-size", Usage: "messages relayed per poll", Set: configload.Int(func(c *Config) *int { return &c.Outbox.BatchSize })},
+	{Key: "outbox.retention", Env: "OUTBOX_RETENTION", Flag: "outbox-retention", Usage: "how long sent messages are kept", Set: configload.Duration(func(c *Config) *time.Duration { return &c.Outbox.Retention })},
+	{Key: "tracing.exporter", Env: "TRACING_EXPORTER", Flag: "tracing-exporter", Usage: "span exporter: none, stdout or otlp", Set: configload.String(func(c *Config) *string { return &c.Tracing.Exporter })},
+	{Key: "tracing.endpoint", Env: "TRACING_ENDPOINT", Flag: "tracing-endpoint", Usage: "host:port of the OTLP HTTP collector", Set: configload.String(func(c *Config) *string { return &c.Tracing.Endpoint })},
+	{Key: "tracing.insecure", Env: "TRACING_INSECURE", Flag: "tracing-insecure", Usage: "send spans over plain HTTP", Set: configload.Bool(func(c *Config) *bool { return &c.Tracing.Insecure }), IsBool: true},
+	{Key: "tracing.service_name", Env: "OTEL_SERVICE_NAME", Flag: "service-name", Usage: "service name on the spans", Set: configload.String(func(c *Config) *string { return &c.Tracing.ServiceName })},
+}, securitySettings...)
+
+// derive fills the values that default to others.
+func (c *Config) derive() {
+	if c.Kafka.ReplyTopic == "" && c.Kafka.Topic != "" {
+		c.Kafka.ReplyTopic = c.Kafka.Topic + ".reply"
+	}
+}
+
+// Validate reports every value that is missing or out of range.
+func (c Config) Validate() error {
+	problems := []error{}
+	if port, err := strconv.Atoi(c.HTTP.Port); err != nil || port < 1 || port > 65535 {
+		problems = append(problems, configload.Invalid("http.port", "must be a port between 1 and 65535"))
+	}
+	switch c.HTTP.Mode {
+	case "debug", "release", "test":
+	default:
+		problems = append(problems, configload.Invalid("http.mode", "must be debug, release or test"))
+	}
+	if c.HTTP.DrainGrace < 0 {
+		problems = append(problems, configload.Invalid("http.drain_grace", "can't be negative"))
+	}
+	if c.Database.URL == "" {
+		problems = append(problems, configload.Required("database.url"))
+	}
+	if len(c.Kafka.Brokers) == 0 {
+		problems = append(problems, configload.Required("kafka.brokers"))
+	}
+	if c.Kafka.Topic == "" {
+		problems = append(problems, configload.Required("kafka.topic"))
+	}
+	problems = append(problems, kafkasecurity.Validate(c.Kafka.TLS, c.Kafka.SASL)...)
+	problems = append(problems, tracing.Validate(c.Tracing)...)
+	if c.Outbox.PollInterval <= 0 {
+		problems = append(problems, configload.Invalid("outbox.poll_interval", "must be positive"))
+	}
+	if c.Outbox.MaxBackoff <= 0 {
+		problems = append(problems, configload.Invalid("outbox.max_backoff", "must be positive"))
+	}
+	if c.Outbox.BatchSize < 1 {
+		problems = append(problems, configload.Invalid("outbox.batch_size", "must be at least 1"))
+	}
+	if c.Outbox.Retention <= 0 {
+		problems = append(problems, configload.Invalid("outbox.retention", "must be positive"))
+	}
+	return errors.Join(problems...)
+}
+
+// Load reads the configuration from the YAML file named by -config or
+// CONFIG_FILE, if any, then the environment, then args, and validates it.
+func Load(args []string) (Config, error) {
+	cfg := defaults()
+	err := configload.Load(&cfg, args, settings, func(c *Config) error {
+		c.derive()
+		return c.Validate()
+	})
+	return cfg, err
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"platform/tracing"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setRequired(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/app")
+	t.Setenv("KAFKA_BROKER", "kafka-1:9092, kafka-2:9092")
+	t.Setenv("TOPIC", "skills")
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("should read the environment over the defaults", func(t *testing.T) {
+		//arange
+		setRequired(t)
+		t.Setenv("OUTBOX_BATCH_SIZE", "20")
+
+		//act
+		cfg, err := Load(nil)
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"kafka-1:9092", "kafka-2:9092"}, cfg.Kafka.Brokers)
+		assert.Equal(t, "skills", cfg.Kafka.Topic)
+		assert.Equal(t, "skills.reply", cfg.Kafka.ReplyTopic)
+		assert.Equal(t, "8910", cfg.HTTP.Port)
+		assert.Equal(t, 20, cfg.Outbox.BatchSize)
+		assert.Equal(t, 500*time.Millisecond, cfg.Outbox.PollInterval)
+		assert.Equal(t, 5*time.Second, cfg.HTTP.DrainGrace)
+	})
+	t.Run("should read the file, then the environment, then the flags", func(t *testing.T) {
+		//arange
+		setRequired(t)
+		path := filepath.Join(t.TempDir(), "api.yaml")
+		os.WriteFile(path, []byte("http:\n  port: \"9000\"\n  mode: release\noutbox:\n  poll_interval: 2s\n  batch_size: 5\n"), 0o600)
+		t.Setenv("OUTBOX_BATCH_SIZE", "10")
+
+		//act
+		cfg, err := Load([]string{"-config", path, "-port", "9100"})
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, "9100", cfg.HTTP.Port)
+		assert.Equal(t, "release", cfg.HTTP.Mode)
+		assert.Equal(t, 2*time.Second, cfg.Outbox.PollInterval)
+		assert.Equal(t, 10, cfg.Outbox.BatchSize)
+	})
+	t.Run("should report every missing value", func(t *testing.T) {
+		//arange
+		t.Setenv("DATABASE_URL", "")
+		t.Setenv("KAFKA_BROKER", "")
+		t.Setenv("TOPIC", "")
+
+		//act
+		_, err := Load(nil)
+
+		//assert
+		assert.ErrorContains(t, err, "database.url is required, set DATABASE_URL, -database-url or database.url in the config file")
+		assert.ErrorContains(t, err, "kafka.brokers is required")
+		assert.ErrorContains(t, err, "kafka.topic is required")
+	})
+	t.Run("should reject values that can't be parsed or are out of range", func(t *testing.T) {
+		//arange
+		setRequired(t)
+		t.Setenv("OUTBOX_POLL_INTERVAL", "soon")
+
+		//act
+		_, parseErr := Load(nil)
+		t.Setenv("OUTBOX_POLL_INTERVAL", "")
+		_, rangeErr := Load([]string{"-port", "0", "-drain-grace", "-1s"})
+
+		//assert
+		assert.ErrorContains(t, parseErr, `OUTBOX_POLL_INTERVAL: "soon" is not a duration such as 500ms`)
+		assert.ErrorContains(t, rangeErr, "http.port must be a port between 1 and 65535")
+		assert.ErrorContains(t, rangeErr, "http.drain_grace can't be negative")
+	})
+	t.Run("should need an endpoint to export spans over OTLP", func(t *testing.T) {
+		//arange
+		setRequired(t)
+		t.Setenv("TRACING_EXPORTER", "otlp")
+
+		//act
+		_, missing := Load(nil)
+		cfg, err := Load([]string{"-tracing-endpoint", "collector:4318", "-tracing-insecure"})
+		_, unknown := Load([]string{"-tracing-exporter", "jaeger"})
+
+		//assert
+		assert.ErrorContains(t, missing, "tracing.endpoint is required, set TRACING_ENDPOINT")
+		assert.NoError(t, err)
+		assert.Equal(t, tracing.Config{Exporter: "otlp", Endpoint: "collector:4318", Insecure: true, ServiceName: "skill-api"}, cfg.Tracing)
+		assert.ErrorContains(t, unknown, "tracing.exporter must be none, stdout or otlp")
+	})
+}
@@ -1,21 +1,41 @@
 package config
 
 import (
-	"os"
+	"platform/kafkasecurity"
 
 	"github.com/IBM/sarama"
 )
 
-var (
-	KafkaAddr = os.Getenv("KAFKA_BROKER")
-)
+// ProducerKafka connects to the brokers and returns the client along with a
+// producer sharing it, so the readiness probe asks the same connections for
+// metadata. The producer has to be closed before the client.
+func ProducerKafka(cfg KafkaConfig) (sarama.Client, sarama.SyncProducer, error) {
+	config, err := producerConfig(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := sarama.NewClient(cfg.Brokers, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	return client, producer, nil
+}
 
-func ProducerKafka() (sarama.SyncProducer, error) {
+func producerConfig(cfg KafkaConfig) (*sarama.Config, error) {
 	config := sarama.NewConfig()
 	config.Producer.Return.Successes = true
 	config.Producer.Return.Errors = true
-	config.Producer.Partitioner = sarama.NewRoundRobinPartitioner
+	// Messages are keyed by skill key, hashing keeps every event of a skill on
+	// one partition so the consumer applies them in the order they were sent.
+	config.Producer.Partitioner = sarama.NewHashPartitioner
 	config.Producer.RequiredAcks = sarama.WaitForAll
-	producer, err := sarama.NewSyncProducer([]string{KafkaAddr}, config)
-	return producer, err
+	if err := kafkasecurity.Apply(config, cfg.TLS, cfg.SASL); err != nil {
+		return nil, err
+	}
+	return config, nil
 }
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"platform/kafkasecurity"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProducerConfig(t *testing.T) {
+	t.Run("should stay plaintext without TLS or SASL", func(t *testing.T) {
+		//act
+		config, err := producerConfig(KafkaConfig{Brokers: []string{"kafka:9092"}})
+
+		//assert
+		assert.NoError(t, err)
+		assert.False(t, config.Net.TLS.Enable)
+		assert.False(t, config.Net.SASL.Enable)
+		assert.NoError(t, config.Validate())
+	})
+	t.Run("should apply the TLS and SASL settings", func(t *testing.T) {
+		//act
+		config, err := producerConfig(KafkaConfig{
+			TLS:  kafkasecurity.TLSConfig{Enabled: true, InsecureSkipVerify: true},
+			SASL: kafkasecurity.SASLConfig{Mechanism: "SCRAM-SHA-512", User: "skill", Password: "secret"},
+		})
+
+		//assert
+		assert.NoError(t, err)
+		assert.True(t, config.Net.TLS.Enable)
+		assert.Equal(t, sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA512), config.Net.SASL.Mechanism)
+		assert.NoError(t, config.Validate())
+	})
+}
+
+func TestSecuritySettings(t *testing.T) {
+	t.Run("should read TLS and SASL from the flags", func(t *testing.T) {
+		//arange
+		setRequired(t)
+
+		//act
+		cfg, err := Load([]string{"-kafka-tls", "-kafka-sasl-mechanism", "SCRAM-SHA-256", "-kafka-sasl-user", "skill", "-kafka-sasl-password", "secret"})
+
+		//assert
+		assert.NoError(t, err)
+		assert.True(t, cfg.Kafka.TLS.Enabled)
+		assert.Equal(t, kafkasecurity.SASLConfig{Mechanism: "SCRAM-SHA-256", User: "skill", Password: "secret"}, cfg.Kafka.SASL)
+	})
+	t.Run("should tell which env variable sets a missing credential", func(t *testing.T) {
+		//arange
+		setRequired(t)
+		t.Setenv("KAFKA_TLS_CERT_FILE", "client.pem")
+		t.Setenv("KAFKA_SASL_MECHANISM", "SCRAM-SHA-512")
+		t.Setenv("KAFKA_SASL_USER", "skill")
+
+		//act
+		_, err := Load(nil)
+
+		//assert
+		assert.ErrorContains(t, err, "kafka.tls settings are given but kafka.tls.enabled is false")
+		assert.ErrorContains(t, err, "kafka.sasl.password is required, set KAFKA_SASL_PASSWORD")
+	})
+}
@@ -0,0 +1,11 @@
+package database
+
+import "database/sql"
+
+// DBTX is satisfied by both *sql.DB and *sql.Tx so repositories can take part
+// in a caller's transaction.
+type DBTX interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
@@ -1,17 +1,113 @@
 package errs
 
+import "net/http"
+
+// Code is a stable, machine-readable error identifier. Clients switch on it
+// instead of the message, which is free to change.
+type Code string
+
+const (
+	CodeBadRequest         Code = "bad_request"
+	CodeNotFound           Code = "not_found"
+	CodeConflict           Code = "conflict"
+	CodePreconditionFailed Code = "precondition_failed"
+	CodeValidation         Code = "validation_failed"
+	CodeInternal           Code = "internal_error"
+
+	CodeInvalidPayload  Code = "invalid_payload"
+	CodeInvalidQuery    Code = "invalid_query"
+	CodeInvalidCursor   Code = "invalid_cursor"
+	CodeInvalidIfMatch  Code = "invalid_if_match"
+	CodeKeyMismatch     Code = "key_mismatch"
+	CodeSkillNotFound   Code = "skill_not_found"
+	CodeSkillExists     Code = "skill_exists"
+	CodeCommandNotFound Code = "command_not_found"
+	CodeVersionMismatch Code = "version_mismatch"
+	CodeVersionNotFound Code = "version_not_found"
+	CodeCommandFailed   Code = "command_failed"
+
+	CodeUnsupportedFormat Code = "unsupported_format"
+)
+
+// InternalMessage is all a client learns about an error the API did not
+// expect. The cause is logged instead.
+const InternalMessage = "Internal server error"
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
 type Err struct {
 	StatusCode int
+	Code       Code
 	Message    string
+	Fields     []FieldError
+	// Cause is the underlying error. It is logged but never sent to clients.
+	Cause error
 }
 
 func (e Err) Error() string {
+	if e.Cause != nil {
+		return e.Message + ": " + e.Cause.Error()
+	}
 	return e.Message
 }
 
-func NewError(code int, message string) error {
+func (e Err) Unwrap() error {
+	return e.Cause
+}
+
+func NewError(status int, message string) error {
 	return Err{
-		StatusCode: code,
+		StatusCode: status,
+		Code:       codeFor(status),
 		Message:    message,
 	}
 }
+
+func NewErrorWithCode(status int, code Code, message string) error {
+	return Err{
+		StatusCode: status,
+		Code:       code,
+		Message:    message,
+	}
+}
+
+// Internal hides cause behind message, which must be safe to show a client.
+func Internal(message string, cause error) error {
+	return Err{
+		StatusCode: http.StatusInternalServerError,
+		Code:       CodeInternal,
+		Message:    message,
+		Cause:      cause,
+	}
+}
+
+func NewValidationError(fields []FieldError) error {
+	return Err{
+		StatusCode: http.StatusUnprocessableEntity,
+		Code:       CodeValidation,
+		Message:    "Validation failed",
+		Fields:     fields,
+	}
+}
+
+func codeFor(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusPreconditionFailed:
+		return CodePreconditionFailed
+	case http.StatusUnprocessableEntity:
+		return CodeValidation
+	}
+	if status < http.StatusInternalServerError {
+		return CodeBadRequest
+	}
+	return CodeInternal
+}
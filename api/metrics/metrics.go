@@ -0,0 +1,63 @@
+// Package metrics holds the Prometheus collectors of the api and serves
+// them on /metrics.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// HTTPRequests counts requests by method, route template and status, so
+	// /skills/go and /skills/js share the /api/v1/skills/:key route.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// PublishDuration is the latency of one send to kafka, a single message
+	// or a whole batch.
+	PublishDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kafka_producer_publish_duration_seconds",
+		Help:    "Latency of kafka sends by kind, single or batch.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"kind"})
+
+	PublishedMessages = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kafka_producer_messages_total",
+		Help: "Messages delivered to kafka.",
+	})
+
+	PublishErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kafka_producer_errors_total",
+		Help: "Messages that could not be delivered to kafka.",
+	})
+)
+
+// Registry holds the collectors above and the Go runtime and process ones.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		PublishDuration,
+		PublishedMessages,
+		PublishErrors,
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ActorHeader    = "X-Actor"
+	ActorKey       = "actor"
+	AnonymousActor = "anonymous"
+	maxActorLen    = 128
+)
+
+// Actor records who is calling so writes can be attributed in the audit log.
+// There is no authentication in front of the API yet, so the identity is
+// whatever the X-Actor header says, or anonymous when it is missing.
+func Actor() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actor := strings.TrimSpace(ctx.GetHeader(ActorHeader))
+		if actor == "" || len(actor) > maxActorLen {
+			actor = AnonymousActor
+		}
+		ctx.Set(ActorKey, actor)
+		ctx.Next()
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActor(t *testing.T) {
+	t.Run("should keep actor from header", func(t *testing.T) {
+		//arrange
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodGet, "/", nil)
+		c.Request.Header.Set(ActorHeader, " alice ")
+
+		//act
+		Actor()(c)
+
+		//assert
+		assert.Equal(t, "alice", c.GetString(ActorKey))
+	})
+
+	t.Run("should be anonymous when header is missing", func(t *testing.T) {
+		//arrange
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodGet, "/", nil)
+
+		//act
+		Actor()(c)
+
+		//assert
+		assert.Equal(t, AnonymousActor, c.GetString(ActorKey))
+	})
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"gokafka/metrics"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Run("should count requests by route template and status", func(t *testing.T) {
+		//arrange
+		router := gin.New()
+		router.Use(Metrics())
+		router.GET("/skills/:key", func(ctx *gin.Context) { ctx.Status(http.StatusNotFound) })
+		counter := metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/skills/:key", "404")
+		before := testutil.ToFloat64(counter)
+
+		//act
+		for _, key := range []string{"go", "rust"} {
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/skills/"+key, nil))
+		}
+
+		//assert
+		assert.Equal(t, before+2, testutil.ToFloat64(counter))
+		assert.Equal(t, 1, testutil.CollectAndCount(metrics.HTTPDuration, "http_request_duration_seconds"))
+	})
+
+	t.Run("should put unknown paths under one route", func(t *testing.T) {
+		//arrange
+		router := gin.New()
+		router.Use(Metrics())
+		counter := metrics.HTTPRequests.WithLabelValues(http.MethodGet, unmatchedRoute, "404")
+		before := testutil.ToFloat64(counter)
+
+		//act
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nope", nil))
+
+		//assert
+		assert.Equal(t, before+1, testutil.ToFloat64(counter))
+	})
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	t.Run("should keep request id from header", func(t *testing.T) {
+		//arrange
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodGet, "/", nil)
+		c.Request.Header.Set(RequestIDHeader, "abc-123")
+
+		//act
+		RequestID()(c)
+
+		//assert
+		assert.Equal(t, "abc-123", c.GetString(RequestIDKey))
+		assert.Equal(t, "abc-123", w.Header().Get(RequestIDHeader))
+	})
+
+	t.Run("should generate request id when header is missing", func(t *testing.T) {
+		//arrange
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodGet, "/", nil)
+
+		//act
+		RequestID()(c)
+
+		//assert
+		assert.NotEmpty(t, c.GetString(RequestIDKey))
+		assert.Equal(t, c.GetString(RequestIDKey), w.Header().Get(RequestIDHeader))
+	})
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"platform/tracing/tracingtest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := tracingtest.InMemory()
+
+	t.Run("should continue the trace of the caller under the route name", func(t *testing.T) {
+		//arrange
+		exporter.Reset()
+		router := gin.New()
+		router.Use(Tracing())
+		var traceID trace.TraceID
+		router.GET("/skills/:key", func(ctx *gin.Context) {
+			traceID = trace.SpanContextFromContext(ctx.Request.Context()).TraceID()
+			ctx.Status(http.StatusOK)
+		})
+		req, _ := http.NewRequest(http.MethodGet, "/skills/go", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+		//act
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		//assert
+		spans := exporter.GetSpans()
+		assert.Len(t, spans, 1)
+		assert.Equal(t, "GET /skills/:key", spans[0].Name)
+		assert.Equal(t, trace.SpanKindServer, spans[0].SpanKind)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext.TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent.SpanID().String())
+		assert.Equal(t, spans[0].SpanContext.TraceID(), traceID)
+	})
+
+	t.Run("should mark server errors", func(t *testing.T) {
+		//arrange
+		exporter.Reset()
+		router := gin.New()
+		router.Use(Tracing())
+		router.GET("/skills", func(ctx *gin.Context) {
+			ctx.Status(http.StatusInternalServerError)
+		})
+		req, _ := http.NewRequest(http.MethodGet, "/skills", nil)
+
+		//act
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		//assert
+		spans := exporter.GetSpans()
+		assert.Len(t, spans, 1)
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+		assert.False(t, spans[0].Parent.IsValid())
+	})
+}
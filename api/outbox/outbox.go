@@ -0,0 +1,38 @@
+package outbox
+
+import "time"
+
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusSent    Status = "sent"
+)
+
+type Message struct {
+	ID        string
+	CommandID string
+	Action    string
+	Key       string
+	// ExpectedVersion is carried into the event so the consumer can reject
+	// writes based on a stale skill.
+	ExpectedVersion int64
+	// Actor and Metadata say who made the write and from where, for the
+	// audit log the consumer keeps.
+	Actor    string
+	Metadata map[string]string
+	// TraceContext is the W3C trace context of the request, so the event
+	// published later still belongs to its trace. It goes into the message
+	// headers, never into the event and so never into the audit log.
+	TraceContext map[string]string
+	Payload      []byte
+	Status       Status
+	Attempts     int
+	LastError    string
+	CreatedAt    time.Time
+}
+
+// OutboxID and OutboxKey let the relay publish the events of a skill in
+// order.
+func (m Message) OutboxID() string  { return m.ID }
+func (m Message) OutboxKey() string { return m.Key }
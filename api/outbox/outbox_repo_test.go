@@ -0,0 +1,167 @@
+package outbox_test
+
+import (
+	"database/sql"
+	"gokafka/outbox"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func newMockDB() *sql.DB {
+	db, _ := sql.Open("sqlite", "file:outbox?mode=memory&cache=shared")
+	q := `
+		CREATE TABLE IF NOT EXISTS outbox (
+		seq INTEGER PRIMARY KEY AUTOINCREMENT,
+		id TEXT NOT NULL UNIQUE,
+		command_id TEXT NOT NULL,
+		action TEXT NOT NULL,
+		skill_key TEXT NOT NULL,
+		expected_version BIGINT NOT NULL DEFAULT 0,
+		actor TEXT NOT NULL DEFAULT '',
+		metadata TEXT NOT NULL DEFAULT '{}',
+		trace_context TEXT NOT NULL DEFAULT '{}',
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		sent_at TIMESTAMP
+	);
+	`
+	db.Exec(q)
+	return db
+}
+
+func TestEnqueueRepo(t *testing.T) {
+	//arange
+	db := newMockDB()
+	defer db.Close()
+	repo := outbox.NewOutboxRepo(db)
+
+	//act
+	msg, err := repo.Enqueue(outbox.Message{
+		CommandID:       "command-id",
+		Action:          "update_name",
+		Key:             "go",
+		ExpectedVersion: 3,
+		Actor:           "alice",
+		Metadata:        map[string]string{"request_id": "req-1"},
+		TraceContext:    map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		Payload:         []byte(`{"Key":"go","Name":"golang"}`),
+	})
+
+	//assert
+	if err != nil {
+		t.Errorf("expected error to be nil but got %v", err)
+	}
+
+	assert.NotEmpty(t, msg.ID)
+	assert.Equal(t, outbox.StatusPending, msg.Status)
+
+	pending, _ := repo.FetchPending(10)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, msg.ID, pending[0].ID)
+	assert.Equal(t, "command-id", pending[0].CommandID)
+	assert.Equal(t, "update_name", pending[0].Action)
+	assert.Equal(t, "go", pending[0].Key)
+	assert.Equal(t, int64(3), pending[0].ExpectedVersion)
+	assert.Equal(t, "alice", pending[0].Actor)
+	assert.Equal(t, map[string]string{"request_id": "req-1"}, pending[0].Metadata)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", pending[0].TraceContext["traceparent"])
+	assert.Equal(t, `{"Key":"go","Name":"golang"}`, string(pending[0].Payload))
+}
+
+func TestFetchPendingRepo(t *testing.T) {
+	t.Run("should return pending messages in insertion order", func(t *testing.T) {
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		repo := outbox.NewOutboxRepo(db)
+
+		first, _ := repo.Enqueue(outbox.Message{CommandID: "1", Action: "create", Key: "go", Payload: []byte(`{}`)})
+		second, _ := repo.Enqueue(outbox.Message{CommandID: "2", Action: "update", Key: "go", Payload: []byte(`{}`)})
+		third, _ := repo.Enqueue(outbox.Message{CommandID: "3", Action: "delete", Key: "go", Payload: []byte(`{}`)})
+
+		//act
+		pending, err := repo.FetchPending(2)
+
+		//assert
+		if err != nil {
+			t.Errorf("expected error to be nil but got %v", err)
+		}
+
+		assert.Len(t, pending, 2)
+		assert.Equal(t, first.ID, pending[0].ID)
+		assert.Equal(t, second.ID, pending[1].ID)
+		assert.NotEqual(t, third.ID, pending[1].ID)
+	})
+	t.Run("should skip sent messages", func(t *testing.T) {
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		repo := outbox.NewOutboxRepo(db)
+
+		first, _ := repo.Enqueue(outbox.Message{CommandID: "1", Action: "create", Key: "go", Payload: []byte(`{}`)})
+		second, _ := repo.Enqueue(outbox.Message{CommandID: "2", Action: "update", Key: "go", Payload: []byte(`{}`)})
+
+		//act
+		err := repo.MarkSent(first.ID)
+
+		//assert
+		if err != nil {
+			t.Errorf("expected error to be nil but got %v", err)
+		}
+
+		pending, _ := repo.FetchPending(10)
+		assert.Len(t, pending, 1)
+		assert.Equal(t, second.ID, pending[0].ID)
+	})
+}
+
+func TestMarkFailedRepo(t *testing.T) {
+	//arange
+	db := newMockDB()
+	defer db.Close()
+	repo := outbox.NewOutboxRepo(db)
+
+	msg, _ := repo.Enqueue(outbox.Message{CommandID: "1", Action: "create", Key: "go", Payload: []byte(`{}`)})
+
+	//act
+	repo.MarkFailed(msg.ID, "broker down")
+	err := repo.MarkFailed(msg.ID, "broker still down")
+
+	//assert
+	if err != nil {
+		t.Errorf("expected error to be nil but got %v", err)
+	}
+
+	pending, _ := repo.FetchPending(10)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, 2, pending[0].Attempts)
+	assert.Equal(t, "broker still down", pending[0].LastError)
+}
+
+func TestPurgeRepo(t *testing.T) {
+	//arange
+	db := newMockDB()
+	defer db.Close()
+	repo := outbox.NewOutboxRepo(db)
+	sent, _ := repo.Enqueue(outbox.Message{CommandID: "1", Action: "create", Key: "go", Payload: []byte(`{}`)})
+	pending, _ := repo.Enqueue(outbox.Message{CommandID: "2", Action: "create", Key: "python", Payload: []byte(`{}`)})
+	repo.MarkSent(sent.ID)
+
+	//act
+	kept, _ := repo.Purge(time.Now().UTC().Add(-time.Hour))
+	purged, err := repo.Purge(time.Now().UTC().Add(time.Hour))
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), kept)
+	assert.Equal(t, int64(1), purged)
+	left, _ := repo.FetchPending(10)
+	assert.Len(t, left, 1)
+	assert.Equal(t, pending.ID, left[0].ID)
+}
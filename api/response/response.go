@@ -2,45 +2,96 @@ package response
 
 import (
 	"gokafka/errs"
+	"gokafka/middleware"
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
-
 type Response struct {
 	Status  string `json:"status"`
 	Message string `json:"message,omitempty"`
 	Data    any    `json:"data,omitempty"`
+	Meta    any    `json:"meta,omitempty"`
 }
 
 func Success(ctx *gin.Context, StatusCode int, data any) {
 	ctx.JSON(StatusCode, Response{
-		Status:"success",
-		Data:data,
+		Status: "success",
+		Data:   data,
+	})
+}
+
+func SuccessWithMeta(ctx *gin.Context, StatusCode int, data any, meta any) {
+	ctx.JSON(StatusCode, Response{
+		Status: "success",
+		Data:   data,
+		Meta:   meta,
 	})
 }
 
 func SuccessMsg(ctx *gin.Context, StatusCode int, msg string) {
 	ctx.JSON(StatusCode, Response{
-		Status:"success",
-		Message:msg,
+		Status:  "success",
+		Message: msg,
 	})
 }
 
+func Accepted(ctx *gin.Context, location string, data any) {
+	ctx.Header("Location", location)
+	ctx.JSON(http.StatusAccepted, Response{
+		Status: "success",
+		Data:   data,
+	})
+}
+
+// Problem is an RFC 7807 problem details body.
+type Problem struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail,omitempty"`
+	Instance  string            `json:"instance,omitempty"`
+	Code      errs.Code         `json:"code"`
+	RequestID string            `json:"request_id,omitempty"`
+	Errors    []errs.FieldError `json:"errors,omitempty"`
+}
+
+const ProblemContentType = "application/problem+json"
 
+// ProblemType is the type URI of the problem with the given code.
+func ProblemType(code errs.Code) string {
+	return "/problems/" + string(code)
+}
+
+// Error writes err as problem details. Anything that is not an errs.Err is
+// unexpected and answered with a generic 500, so driver or SQL messages never
+// reach the client; the full error is logged with the request ID instead.
 func Error(ctx *gin.Context, err error) {
-	switch e := err.(type){
-		case errs.Err:
-			ctx.JSON(e.StatusCode,Response{
-				Status:"error",
-				Message: e.Message,
-			})
-		case error:
-			ctx.JSON(http.StatusInternalServerError,Response{
-				Status: "error",
-				Message: err.Error(),
-			})
+	e, ok := err.(errs.Err)
+	if !ok {
+		e = errs.Internal(errs.InternalMessage, err).(errs.Err)
+	}
+
+	requestID := ctx.GetString(middleware.RequestIDKey)
+	if e.StatusCode >= http.StatusInternalServerError {
+		log.Printf("request %s failed: %s\n", requestID, e)
 	}
-}
 
+	problem := Problem{
+		Type:      ProblemType(e.Code),
+		Title:     http.StatusText(e.StatusCode),
+		Status:    e.StatusCode,
+		Detail:    e.Message,
+		Code:      e.Code,
+		RequestID: requestID,
+		Errors:    e.Fields,
+	}
+	if ctx.Request != nil {
+		problem.Instance = ctx.Request.URL.Path
+	}
+
+	ctx.Header("Content-Type", ProblemContentType)
+	ctx.JSON(e.StatusCode, problem)
+}
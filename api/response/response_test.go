@@ -0,0 +1,63 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"gokafka/errs"
+	"gokafka/middleware"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError(t *testing.T) {
+	t.Run("should response problem details for errs.Err", func(t *testing.T) {
+		//arrange
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/skills/go?x=1", nil)
+		c.Set(middleware.RequestIDKey, "req-1")
+
+		//act
+		Error(c, errs.NewErrorWithCode(http.StatusNotFound, errs.CodeSkillNotFound, "Skill not found"))
+
+		//assert
+		want, _ := json.Marshal(Problem{
+			Type:      "/problems/skill_not_found",
+			Title:     "Not Found",
+			Status:    http.StatusNotFound,
+			Detail:    "Skill not found",
+			Instance:  "/api/v1/skills/go",
+			Code:      errs.CodeSkillNotFound,
+			RequestID: "req-1",
+		})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+		assert.Equal(t, string(want), w.Body.String())
+	})
+
+	t.Run("should hide the cause of internal errors", func(t *testing.T) {
+		cases := []error{
+			errors.New(`pq: relation "skill" does not exist`),
+			errs.Internal("Can't read skills", errors.New(`pq: relation "skill" does not exist`)),
+		}
+		for _, err := range cases {
+			//arrange
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			//act
+			Error(c, err)
+
+			//assert
+			problem := Problem{}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+			assert.Equal(t, http.StatusInternalServerError, w.Code)
+			assert.Equal(t, errs.CodeInternal, problem.Code)
+			assert.NotContains(t, w.Body.String(), "pq:")
+		}
+	})
+}
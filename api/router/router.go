@@ -2,30 +2,75 @@ package router
 
 import (
 	"database/sql"
+	"gokafka/command"
+	"gokafka/config"
+	"gokafka/errs"
+	"gokafka/metrics"
+	"gokafka/middleware"
+	"gokafka/response"
 	"gokafka/skill"
+	"net/http"
+	"platform/health"
 
-	"github.com/IBM/sarama"
 	"github.com/gin-gonic/gin"
 )
 
-func NewRouter(db *sql.DB, producerConfig sarama.SyncProducer) *gin.Engine {
+func NewRouter(db *sql.DB, cfg config.HTTPConfig, checker *health.Checker, replies command.Replies) *gin.Engine {
 
+	gin.SetMode(cfg.Mode)
 	router := gin.Default()
+	// The probes are registered ahead of the middleware so they are not
+	// counted or traced every few seconds.
+	router.GET("/healthz", gin.WrapF(health.Liveness))
+	router.GET("/readyz", gin.WrapF(checker.Readiness))
 
-	producer := skill.NewProducer(producerConfig)
-	skillrepo := skill.NewSkillRepo(db, producer)
+	router.Use(middleware.Metrics())
+	router.Use(middleware.Tracing())
+	router.Use(middleware.RequestID())
+	router.Use(middleware.Actor())
+
+	skillrepo := skill.NewSkillRepo(db).WithReplies(replies)
 	skillHandler := skill.NewSkillHandler(skillrepo)
+	commandHandler := command.NewCommandHandler(command.NewCommandRepo(db))
+
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
 
 	v1 := router.Group("/api/v1")
+	v1.GET("/skills/search", skillHandler.SearchSkills)
 	v1.GET("/skills/:key", skillHandler.GetSkillByKey)
+	v1.GET("/skills/:key/history", skillHandler.GetSkillHistory)
 	v1.GET("/skills", skillHandler.GetSkills)
+	v1.GET("/skills:method", customMethods(map[string]gin.HandlerFunc{
+		":export": skillHandler.ExportSkills,
+	}))
 	v1.POST("/skills", skillHandler.CreateSkill)
+	v1.POST("/skills:method", customMethods(map[string]gin.HandlerFunc{
+		":import": skillHandler.ImportSkills,
+		":batch":  skillHandler.BatchSkills,
+	}))
 	v1.PUT("/skills/:key", skillHandler.UpdateSkill)
 	v1.PATCH("/skills/:key/actions/name", skillHandler.UpdateSkillNameByKey)
 	v1.PATCH("/skills/:key/actions/description", skillHandler.UpdateSkillDescriptionByKey)
 	v1.PATCH("/skills/:key/actions/logo", skillHandler.UpdateSkillLogoByKey)
 	v1.PATCH("/skills/:key/actions/tags", skillHandler.UpdateSkillTagsByKey)
+	v1.POST("/skills/:key/actions/revert", skillHandler.RevertSkill)
 	v1.DELETE("/skills/:key", skillHandler.DeleteSkill)
+	v1.GET("/commands/:id", commandHandler.GetCommandByID)
 
 	return router
 }
+
+// customMethods routes custom methods such as /skills:import. Gin reads the
+// colon as the start of a wildcard, so every /skills<anything> ends up here.
+// The wildcard keeps the colon, and methods are named with it, so
+// /skillsimport is not found.
+func customMethods(methods map[string]gin.HandlerFunc) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		handler, ok := methods[ctx.Param("method")]
+		if !ok {
+			response.Error(ctx, errs.NewError(http.StatusNotFound, "Not found"))
+			return
+		}
+		handler(ctx)
+	}
+}
@@ -0,0 +1,41 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCustomMethods(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/skills:method", customMethods(map[string]gin.HandlerFunc{
+		":export": func(ctx *gin.Context) { ctx.String(http.StatusOK, "export") },
+	}))
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	t.Run("should route the method named after the colon", func(t *testing.T) {
+		//act
+		w := get("/skills:export")
+
+		//assert
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "export", w.Body.String())
+	})
+	t.Run("should not find the method without its colon or with another name", func(t *testing.T) {
+		//act
+		noColon := get("/skillsexport")
+		unknown := get("/skills:exports")
+
+		//assert
+		assert.Equal(t, http.StatusNotFound, noColon.Code)
+		assert.Equal(t, http.StatusNotFound, unknown.Code)
+	})
+}
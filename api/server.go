@@ -4,25 +4,50 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"gokafka/command"
 	"gokafka/config"
 	"gokafka/database"
+	"gokafka/outbox"
 	"gokafka/router"
+	"gokafka/skill"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"platform/health"
+	"platform/relay"
+	"platform/tracing"
 	"syscall"
 	"time"
+
+	"github.com/IBM/sarama"
 )
 
 func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	db := database.ConnectDB()
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	db := database.ConnectDB(cfg.Database.URL)
 	defer db.Close()
 
-	producerConfig, err := config.ProducerKafka()
+	kafkaClient, producerConfig, err := config.ProducerKafka(cfg.Kafka)
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -31,12 +56,54 @@ func main() {
 		if err := producerConfig.Close(); err != nil {
 			log.Fatalln(err)
 		}
+		if err := kafkaClient.Close(); err != nil {
+			log.Fatalln(err)
+		}
+	}()
+
+	outboxRelay := relay.NewRelay[outbox.Message](
+		outbox.NewOutboxRepo(db),
+		skill.NewProducer(producerConfig, cfg.Kafka.Topic),
+		cfg.Outbox.PollInterval,
+		cfg.Outbox.MaxBackoff,
+		cfg.Outbox.BatchSize,
+	)
+	// Like the replies below, the relay runs until the server is shut down,
+	// so the writes accepted during the drain grace are still published.
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	relayDone := make(chan struct{})
+	go func() {
+		outboxRelay.Run(relayCtx)
+		close(relayDone)
+	}()
+	retention := relay.NewRetention().Add("outbox", outbox.NewOutboxRepo(db), cfg.Outbox.Retention)
+	retentionDone := make(chan struct{})
+	go func() {
+		retention.Run(ctx)
+		close(retentionDone)
+	}()
+
+	replyConsumer, err := sarama.NewConsumerFromClient(kafkaClient)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	replies := command.NewReplyListener(replyConsumer, cfg.Kafka.ReplyTopic)
+	// The replies are read until the server is shut down, after the drain
+	// grace, so requests still served then don't fall back to polling.
+	repliesCtx, stopReplies := context.WithCancel(context.Background())
+	repliesDone := make(chan struct{})
+	go func() {
+		replies.Run(repliesCtx)
+		close(repliesDone)
 	}()
 
-	r := router.NewRouter(db, producerConfig)
+	checker := health.NewChecker(2*time.Second).
+		Add("database", health.Database(db)).
+		Add("kafka", health.Kafka(kafkaClient, cfg.Kafka.Topic))
+	r := router.NewRouter(db, cfg.HTTP, checker, replies)
 
 	srv := http.Server{
-		Addr:    ":" + os.Getenv("PORT"),
+		Addr:    ":" + cfg.HTTP.Port,
 		Handler: r,
 	}
 
@@ -45,6 +112,10 @@ func main() {
 	go func() {
 		<-ctx.Done()
 		fmt.Println("shutting down...")
+		// Keep serving with /readyz at 503 until the load balancer has
+		// stopped sending new requests, then let the in-flight ones finish.
+		checker.Drain()
+		time.Sleep(cfg.HTTP.DrainGrace)
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -54,6 +125,8 @@ func main() {
 				log.Println(err, "err1")
 			}
 		}
+		stopRelay()
+		stopReplies()
 
 		close(closeChan)
 	}()
@@ -63,5 +136,8 @@ func main() {
 	}
 
 	<-closeChan
+	<-relayDone
+	<-retentionDone
+	<-repliesDone
 
 }
@@ -6,6 +6,7 @@ type Skill struct {
 	Description string   `json:"description" default:""`
 	Logo        string   `json:"logo" default:""`
 	Tags        []string `json:"tags" default:"{}"`
+	Version     int64    `json:"version,omitempty"`
 }
 
 type SkillCreateRequest struct {
@@ -38,3 +39,7 @@ type LogoUpdateRequest struct {
 type TagsUpdateRequest struct {
 	Tags []string `json:"tags"`
 }
+
+type RevertRequest struct {
+	Version int64 `json:"version"`
+}
@@ -0,0 +1,281 @@
+package skill
+
+import (
+	"database/sql"
+	"errors"
+	"gokafka/command"
+	"gokafka/errs"
+	"gokafka/response"
+	"log"
+	"net/http"
+	"skillevent"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaxBatchOperations bounds one batch request.
+const MaxBatchOperations = 100
+
+// BatchOperation is one write of a batch. Op is the action of the event it
+// publishes, and only the fields that action uses are read.
+type BatchOperation struct {
+	Op              SkillAction `json:"op"`
+	Key             string      `json:"key"`
+	ExpectedVersion int64       `json:"expected_version,omitempty"`
+	Name            string      `json:"name,omitempty"`
+	Description     string      `json:"description,omitempty"`
+	Logo            string      `json:"logo,omitempty"`
+	Tags            []string    `json:"tags,omitempty"`
+}
+
+type BatchRequest struct {
+	// Atomic publishes nothing unless every operation is valid.
+	Atomic     bool             `json:"atomic"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+type BatchStatus string
+
+const (
+	BatchAccepted BatchStatus = "accepted"
+	BatchRejected BatchStatus = "rejected"
+	// BatchAborted is a valid operation of an atomic batch that was not
+	// published because another operation was rejected.
+	BatchAborted BatchStatus = "aborted"
+	BatchFailed  BatchStatus = "failed"
+)
+
+type BatchError struct {
+	Status int               `json:"status"`
+	Code   errs.Code         `json:"code"`
+	Detail string            `json:"detail"`
+	Errors []errs.FieldError `json:"errors,omitempty"`
+}
+
+type BatchResult struct {
+	Index   int              `json:"index"`
+	Op      SkillAction      `json:"op"`
+	Key     string           `json:"key"`
+	Status  BatchStatus      `json:"status"`
+	Command *command.Command `json:"command,omitempty"`
+	Error   *BatchError      `json:"error,omitempty"`
+}
+
+type BatchMeta struct {
+	Atomic    bool `json:"atomic"`
+	Committed bool `json:"committed"`
+	Accepted  int  `json:"accepted"`
+	Rejected  int  `json:"rejected"`
+	Aborted   int  `json:"aborted"`
+	Failed    int  `json:"failed"`
+}
+
+// Mutation is a checked write ready to be published.
+type Mutation struct {
+	Action          SkillAction
+	Key             string
+	ExpectedVersion int64
+	Payload         any
+}
+
+// BatchSkills publishes a list of mixed writes in one outbox transaction and
+// answers with the result of each. In atomic mode a single rejected
+// operation aborts the whole batch, e.g.
+// POST /api/v1/skills:batch {"atomic":true,"operations":[{"op":"delete","key":"go"}]}
+func (h *skillHandler) BatchSkills(ctx *gin.Context) {
+	req := BatchRequest{}
+	if err := ctx.BindJSON(&req); err != nil {
+		response.Error(ctx, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidPayload, "Can't bind payload"))
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > MaxBatchOperations {
+		response.Error(ctx, errs.NewValidationError([]errs.FieldError{{Field: "operations", Message: "must have between 1 and " + strconv.Itoa(MaxBatchOperations) + " operations"}}))
+		return
+	}
+
+	repo := h.skillrepo.WithCaller(callerFrom(ctx))
+	results := make([]BatchResult, len(req.Operations))
+	mutations, pending := []Mutation{}, []int{}
+	planned := batchPlan{repo: repo, skills: map[string]plannedSkill{}}
+	for i, op := range req.Operations {
+		results[i] = BatchResult{Index: i, Op: op.Op, Key: op.Key}
+		mutation, err := op.mutation()
+		if err == nil {
+			err = planned.apply(op)
+		}
+		if err != nil {
+			results[i].Status, results[i].Error = BatchRejected, batchError(err)
+			continue
+		}
+		mutations, pending = append(mutations, mutation), append(pending, i)
+	}
+
+	meta := BatchMeta{Atomic: req.Atomic}
+	rejected := len(mutations) < len(req.Operations)
+	switch {
+	case req.Atomic && rejected:
+		for _, i := range pending {
+			results[i].Status = BatchAborted
+		}
+	case len(mutations) > 0:
+		cmds, err := repo.PublishBatch(mutations)
+		if err != nil {
+			log.Printf("batch of %d operations failed: %s\n", len(mutations), err)
+		}
+		for n, i := range pending {
+			if err != nil {
+				results[i].Status, results[i].Error = BatchFailed, batchError(err)
+				continue
+			}
+			results[i].Status, results[i].Command = BatchAccepted, cmds[n]
+		}
+		meta.Committed = err == nil
+	}
+
+	for _, result := range results {
+		switch result.Status {
+		case BatchAccepted:
+			meta.Accepted++
+		case BatchRejected:
+			meta.Rejected++
+		case BatchAborted:
+			meta.Aborted++
+		case BatchFailed:
+			meta.Failed++
+		}
+	}
+	response.SuccessWithMeta(ctx, http.StatusOK, results, meta)
+}
+
+// mutation validates the operation the way its own endpoint would.
+func (op BatchOperation) mutation() (Mutation, error) {
+	mutation := Mutation{Action: op.Op, Key: op.Key, ExpectedVersion: op.ExpectedVersion}
+	var err error
+	switch op.Op {
+	case CreateSkillAction:
+		var skill Skill
+		skill, err = SkillCreateRequest{Key: op.Key, Name: op.Name, Description: op.Description, Logo: op.Logo, Tags: op.Tags}.Skill()
+		mutation.ExpectedVersion, mutation.Payload = 0, skill
+	case UpdateSkillAction:
+		mutation.Payload, err = SkillUpdateRequest{Name: op.Name, Description: op.Description, Logo: op.Logo, Tags: op.Tags}.Skill(op.Key)
+	case UpdateNameAction:
+		name := strings.TrimSpace(op.Name)
+		err = validationError(skillevent.Validate(skillevent.ValidateName(name)))
+		mutation.Payload = NameUpdateMessage{Key: op.Key, Name: name}
+	case UpdateDescAction:
+		mutation.Payload = DescriptionUpdateMessage{Key: op.Key, Description: op.Description}
+	case UpdateLogoAction:
+		err = validationError(skillevent.Validate(skillevent.ValidateLogo(op.Logo)))
+		mutation.Payload = LogoUpdateMessage{Key: op.Key, Logo: op.Logo}
+	case UpdateTagsAction:
+		tags := skillevent.NormalizeTags(op.Tags)
+		err = validationError(skillevent.Validate(skillevent.ValidateTags(tags)))
+		mutation.Payload = TagsUpdateMessage{Key: op.Key, Tags: tags}
+	case DeleteSkillAction:
+		mutation.Payload = DeleteMessage{Key: op.Key}
+	default:
+		err = errs.NewValidationError([]errs.FieldError{{Field: "op", Message: "unknown operation"}})
+	}
+	return mutation, err
+}
+
+// plannedSkill is a skill as the operations accepted so far leave it. A
+// missing skill keeps the version of its tombstone, the one a skill created
+// again under its key goes on from.
+type plannedSkill struct {
+	exists  bool
+	version int64
+}
+
+// batchPlan checks each operation against the skills as the earlier
+// operations of the batch leave them, so a batch may create a skill and then
+// change it. A skill the batch has not touched yet is read from the database.
+type batchPlan struct {
+	repo   SkillRepo
+	skills map[string]plannedSkill
+}
+
+// apply checks op and, when it is accepted, records its effect. The versions
+// follow the consumer, which bumps the version on every write, delete
+// included, and starts a skill one past its tombstone.
+func (p *batchPlan) apply(op BatchOperation) error {
+	skill, ok := p.skills[op.Key]
+	if !ok {
+		version, exists, err := p.repo.SkillVersion(op.Key)
+		if err != nil {
+			return err
+		}
+		skill = plannedSkill{exists: exists, version: version}
+	}
+
+	switch {
+	case op.Op == CreateSkillAction:
+		if skill.exists {
+			return errs.NewErrorWithCode(http.StatusConflict, errs.CodeSkillExists, "Skill already exists")
+		}
+		skill = plannedSkill{exists: true, version: skill.version + 1}
+	case !skill.exists:
+		return errs.NewErrorWithCode(http.StatusNotFound, errs.CodeSkillNotFound, "Skill not found")
+	case op.ExpectedVersion != 0 && op.ExpectedVersion != skill.version:
+		return errs.NewErrorWithCode(http.StatusPreconditionFailed, errs.CodeVersionMismatch, "Skill version does not match")
+	case op.Op == DeleteSkillAction:
+		skill = plannedSkill{version: skill.version + 1}
+	default:
+		skill.version++
+	}
+	p.skills[op.Key] = skill
+	return nil
+}
+
+func batchError(err error) *BatchError {
+	var e errs.Err
+	if !errors.As(err, &e) || e.StatusCode >= http.StatusInternalServerError {
+		return &BatchError{Status: http.StatusInternalServerError, Code: errs.CodeInternal, Detail: errs.InternalMessage}
+	}
+	return &BatchError{Status: e.StatusCode, Code: e.Code, Detail: e.Message, Errors: e.Fields}
+}
+
+// SkillVersion is the current version of the skill. For a missing skill
+// exists is false and the version is the one of its tombstone, zero when no
+// skill of that key was ever deleted.
+func (r *skillRepo) SkillVersion(key string) (version int64, exists bool, err error) {
+	err = r.db.QueryRow("SELECT version FROM skill WHERE key=$1", key).Scan(&version)
+	if err == nil {
+		return version, true, nil
+	}
+	if err == sql.ErrNoRows {
+		err = r.db.QueryRow("SELECT version FROM skill_tombstone WHERE key=$1", key).Scan(&version)
+	}
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, errs.Internal("Can't read skill", err)
+	}
+	return version, false, nil
+}
+
+// PublishBatch queues every mutation in one transaction, so the batch is
+// either published whole or not at all.
+func (r *skillRepo) PublishBatch(mutations []Mutation) ([]*command.Command, error) {
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, errs.Internal("Can't publish skill event", err)
+	}
+	defer tx.Rollback()
+
+	cmds := make([]*command.Command, len(mutations))
+	for i, m := range mutations {
+		if cmds[i], err = r.enqueue(tx, m.Action, m.Key, m.ExpectedVersion, m.Payload); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errs.Internal("Can't publish skill event", err)
+	}
+	return cmds, nil
+}
@@ -0,0 +1,175 @@
+package skill
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"gokafka/errs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type batchResponse struct {
+	Data []BatchResult `json:"data"`
+	Meta BatchMeta     `json:"meta"`
+}
+
+func batchRequest(body string) (*httptest.ResponseRecorder, *gin.Context) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/skills:batch", bytes.NewReader([]byte(body)))
+	return w, c
+}
+
+func statuses(results []BatchResult) []BatchStatus {
+	got := []BatchStatus{}
+	for _, result := range results {
+		got = append(got, result.Status)
+	}
+	return got
+}
+
+func TestBatchSkills(t *testing.T) {
+	body := `{"operations":[
+		{"op":"create","key":"go","name":"Go"},
+		{"op":"update_name","key":"rust","name":"Rust","expected_version":2},
+		{"op":"update_logo","key":"go","logo":"not a url"},
+		{"op":"delete","key":"kotlin"}
+	]}`
+
+	t.Run("should publish valid operations and report each one", func(t *testing.T) {
+		//arrange
+		w, c := batchRequest(body)
+		mock := &mockRepo{versions: map[string]int64{"rust": 2}}
+		handler := NewSkillHandler(mock)
+
+		//act
+		handler.BatchSkills(c)
+
+		//assert
+		assert.Equal(t, http.StatusOK, w.Code)
+		got := batchResponse{}
+		json.Unmarshal(w.Body.Bytes(), &got)
+		assert.Equal(t, []BatchStatus{BatchAccepted, BatchAccepted, BatchRejected, BatchRejected}, statuses(got.Data))
+		assert.Equal(t, BatchMeta{Committed: true, Accepted: 2, Rejected: 2}, got.Meta)
+		assert.Equal(t, "update_name", got.Data[1].Command.Action)
+		assert.Equal(t, errs.CodeValidation, got.Data[2].Error.Code)
+		assert.Equal(t, "logo", got.Data[2].Error.Errors[0].Field)
+		assert.Equal(t, &BatchError{Status: http.StatusNotFound, Code: errs.CodeSkillNotFound, Detail: "Skill not found"}, got.Data[3].Error)
+		assert.Len(t, mock.mutations, 1)
+		assert.Equal(t, Mutation{Action: UpdateNameAction, Key: "rust", ExpectedVersion: 2, Payload: NameUpdateMessage{Key: "rust", Name: "Rust"}}, mock.mutations[0][1])
+	})
+	t.Run("should publish nothing in atomic mode when an operation is rejected", func(t *testing.T) {
+		//arrange
+		w, c := batchRequest(`{"atomic":true,"operations":[{"op":"create","key":"go","name":"Go"},{"op":"rename","key":"go"}]}`)
+		mock := &mockRepo{}
+		handler := NewSkillHandler(mock)
+
+		//act
+		handler.BatchSkills(c)
+
+		//assert
+		got := batchResponse{}
+		json.Unmarshal(w.Body.Bytes(), &got)
+		assert.Equal(t, []BatchStatus{BatchAborted, BatchRejected}, statuses(got.Data))
+		assert.Equal(t, BatchMeta{Atomic: true, Rejected: 1, Aborted: 1}, got.Meta)
+		assert.Equal(t, []errs.FieldError{{Field: "op", Message: "unknown operation"}}, got.Data[1].Error.Errors)
+		assert.Empty(t, mock.mutations)
+	})
+	t.Run("should check an operation against the skill the batch created", func(t *testing.T) {
+		//arrange
+		w, c := batchRequest(`{"atomic":true,"operations":[
+			{"op":"create","key":"go","name":"Go"},
+			{"op":"update_name","key":"go","name":"Golang","expected_version":1},
+			{"op":"update_tags","key":"go","tags":["lang"],"expected_version":2},
+			{"op":"delete","key":"go","expected_version":3}
+		]}`)
+		mock := &mockRepo{}
+		handler := NewSkillHandler(mock)
+
+		//act
+		handler.BatchSkills(c)
+
+		//assert
+		got := batchResponse{}
+		json.Unmarshal(w.Body.Bytes(), &got)
+		assert.Equal(t, BatchMeta{Atomic: true, Committed: true, Accepted: 4}, got.Meta)
+		assert.Len(t, mock.mutations, 1)
+		assert.Len(t, mock.mutations[0], 4)
+	})
+	t.Run("should reject an operation on a skill the batch deleted or a stale version of it", func(t *testing.T) {
+		//arrange
+		w, c := batchRequest(`{"operations":[
+			{"op":"update_name","key":"rust","name":"Rust","expected_version":2},
+			{"op":"update_logo","key":"rust","logo":"https://example.com/rust.svg","expected_version":2},
+			{"op":"delete","key":"rust"},
+			{"op":"update_name","key":"rust","name":"Rust"},
+			{"op":"create","key":"rust","name":"Rust"},
+			{"op":"create","key":"rust","name":"Rust"}
+		]}`)
+		mock := &mockRepo{versions: map[string]int64{"rust": 2}}
+		handler := NewSkillHandler(mock)
+
+		//act
+		handler.BatchSkills(c)
+
+		//assert
+		got := batchResponse{}
+		json.Unmarshal(w.Body.Bytes(), &got)
+		assert.Equal(t, []BatchStatus{BatchAccepted, BatchRejected, BatchAccepted, BatchRejected, BatchAccepted, BatchRejected}, statuses(got.Data))
+		assert.Equal(t, errs.CodeVersionMismatch, got.Data[1].Error.Code)
+		assert.Equal(t, errs.CodeSkillNotFound, got.Data[3].Error.Code)
+		assert.Equal(t, errs.CodeSkillExists, got.Data[5].Error.Code)
+	})
+	t.Run("should go on from the deleted skill's version when the batch creates it again", func(t *testing.T) {
+		//arrange
+		w, c := batchRequest(`{"atomic":true,"operations":[
+			{"op":"create","key":"kotlin","name":"Kotlin"},
+			{"op":"update_name","key":"kotlin","name":"Kotlin/JVM","expected_version":5},
+			{"op":"delete","key":"rust","expected_version":2},
+			{"op":"create","key":"rust","name":"Rust"},
+			{"op":"update_name","key":"rust","name":"Rust lang","expected_version":4}
+		]}`)
+		mock := &mockRepo{versions: map[string]int64{"rust": 2}, tombstones: map[string]int64{"kotlin": 4}}
+		handler := NewSkillHandler(mock)
+
+		//act
+		handler.BatchSkills(c)
+
+		//assert
+		got := batchResponse{}
+		json.Unmarshal(w.Body.Bytes(), &got)
+		assert.Equal(t, BatchMeta{Atomic: true, Committed: true, Accepted: 5}, got.Meta)
+	})
+	t.Run("should report failed operations without leaking the cause", func(t *testing.T) {
+		//arrange
+		w, c := batchRequest(`{"atomic":true,"operations":[{"op":"create","key":"go","name":"Go"}]}`)
+		mock := &mockRepo{publishErr: errs.Internal("Can't publish skill event", errors.New("db down"))}
+		handler := NewSkillHandler(mock)
+
+		//act
+		handler.BatchSkills(c)
+
+		//assert
+		got := batchResponse{}
+		json.Unmarshal(w.Body.Bytes(), &got)
+		assert.Equal(t, BatchMeta{Atomic: true, Failed: 1}, got.Meta)
+		assert.Equal(t, &BatchError{Status: http.StatusInternalServerError, Code: errs.CodeInternal, Detail: errs.InternalMessage}, got.Data[0].Error)
+	})
+	t.Run("should response unprocessable entity when there are no operations", func(t *testing.T) {
+		//arrange
+		w, c := batchRequest(`{"operations":[]}`)
+		handler := NewSkillHandler(&mockRepo{})
+
+		//act
+		handler.BatchSkills(c)
+
+		//assert
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, problem(c, http.StatusUnprocessableEntity, errs.CodeValidation, "Validation failed", errs.FieldError{Field: "operations", Message: "must have between 1 and 100 operations"}), w.Body.Bytes())
+	})
+}
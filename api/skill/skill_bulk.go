@@ -0,0 +1,463 @@
+package skill
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"gokafka/command"
+	"gokafka/errs"
+	"gokafka/response"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type BulkFormat string
+
+const (
+	FormatJSONL BulkFormat = "jsonl"
+	FormatCSV   BulkFormat = "csv"
+)
+
+const (
+	// ImportBatchSize is how many rows are published per transaction.
+	ImportBatchSize = 100
+	// exportFlushEvery is how many rows are written between flushes.
+	exportFlushEvery = 100
+	// maxImportLine bounds one JSON line so a broken file can't eat memory.
+	maxImportLine = 1 << 20
+)
+
+var csvColumns = []string{"key", "name", "description", "logo", "tags"}
+
+type ImportStatus string
+
+const (
+	ImportAccepted ImportStatus = "accepted"
+	ImportRejected ImportStatus = "rejected"
+	ImportFailed   ImportStatus = "failed"
+)
+
+// ImportRow is the result of one row of an import. Rows count from one, not
+// counting the csv header.
+type ImportRow struct {
+	Row     int               `json:"row"`
+	Key     string            `json:"key,omitempty"`
+	Status  ImportStatus      `json:"status"`
+	Command *command.Command  `json:"command,omitempty"`
+	Errors  []errs.FieldError `json:"errors,omitempty"`
+}
+
+type ImportMeta struct {
+	Total    int `json:"total"`
+	Accepted int `json:"accepted"`
+	Rejected int `json:"rejected"`
+	Failed   int `json:"failed"`
+}
+
+// ImportSkills reads a JSON Lines or csv body of skills, validates every row
+// and publishes the valid ones as create events, ImportBatchSize at a time.
+// A row is rejected when its key already names a skill or was used by an
+// earlier row of the file.
+// It answers with the result of each row, e.g.
+// POST /api/v1/skills:import with Content-Type: application/x-ndjson
+func (h *skillHandler) ImportSkills(ctx *gin.Context) {
+	format, err := importFormat(ctx)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+	next, err := rowReader(format, ctx.Request.Body)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+
+	repo := h.skillrepo.WithCaller(callerFrom(ctx))
+	rows := []ImportRow{}
+	// firstRow is the row each key was first read on, to reject it on the
+	// rows that repeat it.
+	firstRow := map[string]int{}
+	batch, batchRows := []Skill{}, []int{}
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		defer func() { batch, batchRows = batch[:0], batchRows[:0] }()
+
+		keys := make([]string, len(batch))
+		for i, skill := range batch {
+			keys[i] = skill.Key
+		}
+		existing, err := repo.ExistingKeys(keys)
+		if err != nil {
+			log.Printf("import of %d skills failed: %s\n", len(batch), err)
+			for _, row := range batchRows {
+				rows[row].Status = ImportFailed
+			}
+			return
+		}
+		skills, skillRows := []Skill{}, []int{}
+		for i, skill := range batch {
+			if existing[skill.Key] {
+				rows[batchRows[i]].Status = ImportRejected
+				rows[batchRows[i]].Errors = []errs.FieldError{{Field: "key", Message: "already names a skill"}}
+				continue
+			}
+			skills, skillRows = append(skills, skill), append(skillRows, batchRows[i])
+		}
+		if len(skills) == 0 {
+			return
+		}
+
+		cmds, err := repo.ImportSkills(skills)
+		if err != nil {
+			log.Printf("import of %d skills failed: %s\n", len(skills), err)
+		}
+		for i, row := range skillRows {
+			if err != nil {
+				rows[row].Status = ImportFailed
+				continue
+			}
+			rows[row].Status = ImportAccepted
+			rows[row].Command = cmds[i]
+		}
+	}
+
+	for number := 1; ; number++ {
+		req, err := next()
+		if err == io.EOF {
+			break
+		}
+		var bad badRow
+		if err != nil && !errors.As(err, &bad) {
+			// The body can't be read any further.
+			rows = append(rows, rejectedRow(number, "", err))
+			break
+		}
+		if err == nil {
+			var skill Skill
+			if skill, err = req.Skill(); err == nil {
+				if first, ok := firstRow[skill.Key]; ok {
+					rows = append(rows, ImportRow{Row: number, Key: skill.Key, Status: ImportRejected, Errors: []errs.FieldError{{Field: "key", Message: "repeats the key of row " + strconv.Itoa(first)}}})
+					continue
+				}
+				firstRow[skill.Key] = number
+				batchRows = append(batchRows, len(rows))
+				rows = append(rows, ImportRow{Row: number, Key: skill.Key})
+				batch = append(batch, skill)
+				if len(batch) == ImportBatchSize {
+					flush()
+				}
+				continue
+			}
+		}
+		rows = append(rows, rejectedRow(number, req.Key, err))
+	}
+	flush()
+
+	meta := ImportMeta{Total: len(rows)}
+	for _, row := range rows {
+		switch row.Status {
+		case ImportAccepted:
+			meta.Accepted++
+		case ImportRejected:
+			meta.Rejected++
+		case ImportFailed:
+			meta.Failed++
+		}
+	}
+	response.SuccessWithMeta(ctx, http.StatusOK, rows, meta)
+}
+
+func rejectedRow(number int, key string, err error) ImportRow {
+	row := ImportRow{Row: number, Key: key, Status: ImportRejected}
+	var e errs.Err
+	if errors.As(err, &e) && len(e.Fields) > 0 {
+		row.Errors = e.Fields
+	} else {
+		row.Errors = []errs.FieldError{{Field: "row", Message: err.Error()}}
+	}
+	return row
+}
+
+// importFormat is the format query parameter, or else the one the
+// Content-Type names.
+func importFormat(ctx *gin.Context) (BulkFormat, error) {
+	if format := ctx.Query("format"); format != "" {
+		return bulkFormat(format)
+	}
+	mediaType, _, _ := mime.ParseMediaType(ctx.GetHeader("Content-Type"))
+	switch mediaType {
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		return FormatJSONL, nil
+	case "text/csv":
+		return FormatCSV, nil
+	}
+	return "", errs.NewErrorWithCode(http.StatusUnsupportedMediaType, errs.CodeUnsupportedFormat, "Content-Type must be application/x-ndjson or text/csv")
+}
+
+func bulkFormat(value string) (BulkFormat, error) {
+	switch BulkFormat(value) {
+	case FormatJSONL, FormatCSV:
+		return BulkFormat(value), nil
+	}
+	return "", errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidQuery, "format must be jsonl or csv")
+}
+
+// badRow is a row that can't be parsed. Reading goes on with the next row,
+// unlike after any other error.
+type badRow struct {
+	message string
+}
+
+func (e badRow) Error() string {
+	return e.message
+}
+
+// rowReader returns a function reading one skill at a time from body. It
+// returns io.EOF after the last row.
+func rowReader(format BulkFormat, body io.Reader) (func() (SkillCreateRequest, error), error) {
+	if format == FormatCSV {
+		return csvRowReader(body)
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLine)
+	return func() (SkillCreateRequest, error) {
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			req := SkillCreateRequest{}
+			if err := json.Unmarshal([]byte(line), &req); err != nil {
+				return req, badRow{message: "invalid JSON"}
+			}
+			return req, nil
+		}
+		if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+			return SkillCreateRequest{}, errors.New("line is longer than 1MB")
+		}
+		if err := scanner.Err(); err != nil {
+			return SkillCreateRequest{}, err
+		}
+		return SkillCreateRequest{}, io.EOF
+	}, nil
+}
+
+// csvRowReader reads a csv with a header naming the columns, in any order.
+// Tags share one column as a JSON array, since a tag may hold any separator.
+func csvRowReader(body io.Reader) (func() (SkillCreateRequest, error), error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return func() (SkillCreateRequest, error) { return SkillCreateRequest{}, io.EOF }, nil
+	}
+	if err != nil {
+		return nil, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidPayload, "Can't read csv header")
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["key"]; !ok {
+		return nil, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidPayload, "csv header must have a key column")
+	}
+
+	return func() (SkillCreateRequest, error) {
+		record, err := reader.Read()
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return SkillCreateRequest{}, badRow{message: parseErr.Err.Error()}
+		}
+		if err != nil {
+			return SkillCreateRequest{}, err
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		req := SkillCreateRequest{
+			Key:         field("key"),
+			Name:        field("name"),
+			Description: field("description"),
+			Logo:        field("logo"),
+		}
+		if tags := field("tags"); tags != "" {
+			if err := json.Unmarshal([]byte(tags), &req.Tags); err != nil {
+				return SkillCreateRequest{}, badRow{message: "tags must be a JSON array of strings"}
+			}
+		}
+		return req, nil
+	}, nil
+}
+
+// ExportSkills streams every skill as JSON Lines or csv, e.g.
+// GET /api/v1/skills:export?format=csv
+// Rows are written as they are read, so an error after the first row can
+// only cut the body short.
+func (h *skillHandler) ExportSkills(ctx *gin.Context) {
+	format, err := bulkFormat(ctx.DefaultQuery("format", string(FormatJSONL)))
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+
+	writer := newSkillWriter(format, ctx.Writer)
+	started, count := false, 0
+	start := func() error {
+		started = true
+		ctx.Header("Content-Type", writer.contentType)
+		ctx.Header("Content-Disposition", `attachment; filename="skills.`+string(format)+`"`)
+		ctx.Status(http.StatusOK)
+		return writer.start()
+	}
+
+	err = h.skillrepo.ExportSkills(func(skill Skill) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := writer.write(skill); err != nil {
+			return err
+		}
+		if count++; count%exportFlushEvery == 0 {
+			return writer.flush()
+		}
+		return nil
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err != nil {
+		if !started {
+			response.Error(ctx, err)
+			return
+		}
+		log.Printf("export cut short after %d skills: %s\n", count, err)
+		ctx.Abort()
+		return
+	}
+	if err := writer.flush(); err != nil {
+		log.Printf("export cut short after %d skills: %s\n", count, err)
+	}
+}
+
+// csvTags is the tags column of a skill, a JSON array or empty without tags.
+func csvTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	encoded, _ := json.Marshal(tags)
+	return string(encoded)
+}
+
+type skillWriter struct {
+	contentType string
+	start       func() error
+	write       func(Skill) error
+	flush       func() error
+}
+
+func newSkillWriter(format BulkFormat, w gin.ResponseWriter) skillWriter {
+	if format == FormatCSV {
+		out := csv.NewWriter(w)
+		return skillWriter{
+			contentType: "text/csv; charset=utf-8",
+			start:       func() error { return out.Write(csvColumns) },
+			write: func(skill Skill) error {
+				return out.Write([]string{skill.Key, skill.Name, skill.Description, skill.Logo, csvTags(skill.Tags)})
+			},
+			flush: func() error {
+				out.Flush()
+				w.Flush()
+				return out.Error()
+			},
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	return skillWriter{
+		contentType: "application/x-ndjson",
+		start:       func() error { return nil },
+		write:       func(skill Skill) error { return encoder.Encode(skill) },
+		flush: func() error {
+			w.Flush()
+			return nil
+		},
+	}
+}
+
+// ExportSkills calls fn with each skill in key order, reading them one at a
+// time instead of loading the table.
+func (r *skillRepo) ExportSkills(fn func(Skill) error) error {
+	records, err := r.db.Query("SELECT key, name, description, logo, tags, version FROM skill ORDER BY key")
+	if err != nil {
+		return errs.Internal("Can't read skills", err)
+	}
+	defer records.Close()
+	for records.Next() {
+		skill := Skill{}
+		err := records.Scan(&skill.Key, &skill.Name, &skill.Description, &skill.Logo, pq.Array(&skill.Tags), &skill.Version)
+		if err != nil {
+			return errs.Internal("Can't read skills", err)
+		}
+		if err := fn(skill); err != nil {
+			return err
+		}
+	}
+	if err := records.Err(); err != nil {
+		return errs.Internal("Can't read skills", err)
+	}
+	return nil
+}
+
+// ImportSkills publishes a create event for each skill in one transaction, so
+// a batch is either queued whole or not at all.
+func (r *skillRepo) ImportSkills(skills []Skill) ([]*command.Command, error) {
+	mutations := make([]Mutation, len(skills))
+	for i, skill := range skills {
+		mutations[i] = Mutation{Action: CreateSkillAction, Key: skill.Key, Payload: skill}
+	}
+	return r.PublishBatch(mutations)
+}
+
+// ExistingKeys reports which of keys already name a skill.
+func (r *skillRepo) ExistingKeys(keys []string) (map[string]bool, error) {
+	existing := map[string]bool{}
+	if len(keys) == 0 {
+		return existing, nil
+	}
+	placeholders, args := make([]string, len(keys)), make([]any, len(keys))
+	for i, key := range keys {
+		placeholders[i], args[i] = "$"+strconv.Itoa(i+1), key
+	}
+	records, err := r.db.Query("SELECT key FROM skill WHERE key IN ("+strings.Join(placeholders, ", ")+")", args...)
+	if err != nil {
+		return nil, errs.Internal("Can't read skills", err)
+	}
+	defer records.Close()
+	for records.Next() {
+		var key string
+		if err := records.Scan(&key); err != nil {
+			return nil, errs.Internal("Can't read skills", err)
+		}
+		existing[key] = true
+	}
+	if err := records.Err(); err != nil {
+		return nil, errs.Internal("Can't read skills", err)
+	}
+	return existing, nil
+}
@@ -0,0 +1,249 @@
+package skill
+
+import (
+	"encoding/json"
+	"errors"
+	"gokafka/command"
+	"gokafka/errs"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type importResponse struct {
+	Data []ImportRow `json:"data"`
+	Meta ImportMeta  `json:"meta"`
+}
+
+func importRequest(contentType string, body string) (*httptest.ResponseRecorder, *gin.Context) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/skills:import", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", contentType)
+	return w, c
+}
+
+func TestImportSkills(t *testing.T) {
+	t.Run("should publish valid json lines and report each row", func(t *testing.T) {
+		//arrange
+		body := `{"key":"go","name":"Go","logo":"https://example.com/go.svg","tags":["lang"]}
+
+{"key":"Not A Slug","name":"bad"}
+not json
+{"key":"rust","name":"Rust"}
+`
+		w, c := importRequest("application/x-ndjson", body)
+		mock := &mockRepo{}
+		handler := NewSkillHandler(mock)
+
+		//act
+		handler.ImportSkills(c)
+
+		//assert
+		assert.Equal(t, http.StatusOK, w.Code)
+		got := importResponse{}
+		json.Unmarshal(w.Body.Bytes(), &got)
+		assert.Equal(t, ImportMeta{Total: 4, Accepted: 2, Rejected: 2}, got.Meta)
+		assert.Equal(t, []ImportStatus{ImportAccepted, ImportRejected, ImportRejected, ImportAccepted}, []ImportStatus{got.Data[0].Status, got.Data[1].Status, got.Data[2].Status, got.Data[3].Status})
+		assert.Equal(t, "go", got.Data[0].Command.Key)
+		assert.Equal(t, command.StatusPending, got.Data[0].Command.Status)
+		assert.Equal(t, "key", got.Data[1].Errors[0].Field)
+		assert.Equal(t, []errs.FieldError{{Field: "row", Message: "invalid JSON"}}, got.Data[2].Errors)
+		assert.Equal(t, 4, got.Data[3].Row)
+		assert.Len(t, mock.imported, 1)
+		assert.Equal(t, []string{"go", "rust"}, []string{mock.imported[0][0].Key, mock.imported[0][1].Key})
+	})
+	t.Run("should read csv columns by header and tags as a JSON array", func(t *testing.T) {
+		//arrange
+		body := "name,key,tags\nGo,go,\"[\"\"lang\"\",\"\"backend\"\"]\"\n,python,\nRust,rust,lang|systems\n"
+		w, c := importRequest("text/csv", body)
+		mock := &mockRepo{}
+		handler := NewSkillHandler(mock)
+
+		//act
+		handler.ImportSkills(c)
+
+		//assert
+		assert.Equal(t, http.StatusOK, w.Code)
+		got := importResponse{}
+		json.Unmarshal(w.Body.Bytes(), &got)
+		assert.Equal(t, ImportMeta{Total: 3, Accepted: 1, Rejected: 2}, got.Meta)
+		assert.Equal(t, Skill{Key: "go", Name: "Go", Tags: []string{"lang", "backend"}}, mock.imported[0][0])
+		assert.Equal(t, "name", got.Data[1].Errors[0].Field)
+		assert.Equal(t, []errs.FieldError{{Field: "row", Message: "tags must be a JSON array of strings"}}, got.Data[2].Errors)
+	})
+	t.Run("should publish in batches", func(t *testing.T) {
+		//arrange
+		lines := []string{}
+		for i := 0; i < ImportBatchSize+1; i++ {
+			lines = append(lines, `{"key":"skill-`+strconv.Itoa(i)+`","name":"skill"}`)
+		}
+		w, c := importRequest("application/x-ndjson", strings.Join(lines, "\n"))
+		mock := &mockRepo{}
+		handler := NewSkillHandler(mock)
+
+		//act
+		handler.ImportSkills(c)
+
+		//assert
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, mock.imported, 2)
+		assert.Len(t, mock.imported[0], ImportBatchSize)
+		assert.Len(t, mock.imported[1], 1)
+	})
+	t.Run("should report failed rows when a batch can't be published", func(t *testing.T) {
+		//arrange
+		w, c := importRequest("application/x-ndjson", `{"key":"go","name":"Go"}`)
+		mock := &mockRepo{importErr: errors.New("db down")}
+		handler := NewSkillHandler(mock)
+
+		//act
+		handler.ImportSkills(c)
+
+		//assert
+		got := importResponse{}
+		json.Unmarshal(w.Body.Bytes(), &got)
+		assert.Equal(t, ImportMeta{Total: 1, Failed: 1}, got.Meta)
+		assert.Nil(t, got.Data[0].Command)
+	})
+	t.Run("should reject keys that already name a skill or repeat an earlier row", func(t *testing.T) {
+		//arrange
+		body := `{"key":"go","name":"Go"}
+{"key":"rust","name":"Rust"}
+{"key":"go","name":"Golang"}
+{"key":"python","name":"Python"}
+`
+		w, c := importRequest("application/x-ndjson", body)
+		mock := &mockRepo{versions: map[string]int64{"rust": 3}}
+		handler := NewSkillHandler(mock)
+
+		//act
+		handler.ImportSkills(c)
+
+		//assert
+		assert.Equal(t, http.StatusOK, w.Code)
+		got := importResponse{}
+		json.Unmarshal(w.Body.Bytes(), &got)
+		assert.Equal(t, ImportMeta{Total: 4, Accepted: 2, Rejected: 2}, got.Meta)
+		assert.Equal(t, ImportRow{Row: 2, Key: "rust", Status: ImportRejected, Errors: []errs.FieldError{{Field: "key", Message: "already names a skill"}}}, got.Data[1])
+		assert.Equal(t, ImportRow{Row: 3, Key: "go", Status: ImportRejected, Errors: []errs.FieldError{{Field: "key", Message: "repeats the key of row 1"}}}, got.Data[2])
+		assert.Len(t, mock.imported, 1)
+		assert.Equal(t, []string{"go", "python"}, []string{mock.imported[0][0].Key, mock.imported[0][1].Key})
+	})
+	t.Run("should report failed rows when existing keys can't be read", func(t *testing.T) {
+		//arrange
+		w, c := importRequest("application/x-ndjson", `{"key":"go","name":"Go"}`)
+		mock := &mockRepo{existingErr: errors.New("db down")}
+		handler := NewSkillHandler(mock)
+
+		//act
+		handler.ImportSkills(c)
+
+		//assert
+		got := importResponse{}
+		json.Unmarshal(w.Body.Bytes(), &got)
+		assert.Equal(t, ImportMeta{Total: 1, Failed: 1}, got.Meta)
+		assert.Empty(t, mock.imported)
+	})
+	t.Run("should response unsupported media type when format is unknown", func(t *testing.T) {
+		//arrange
+		w, c := importRequest("application/json", `[]`)
+		handler := NewSkillHandler(&mockRepo{})
+
+		//act
+		handler.ImportSkills(c)
+
+		//assert
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+		assert.Equal(t, problem(c, http.StatusUnsupportedMediaType, errs.CodeUnsupportedFormat, "Content-Type must be application/x-ndjson or text/csv"), w.Body.Bytes())
+	})
+}
+
+func TestExportSkills(t *testing.T) {
+	skills := []Skill{
+		{Key: "go", Name: "Go", Description: "fast, simple", Tags: []string{"lang", "backend"}, Version: 2},
+		{Key: "rust", Name: "Rust", Tags: []string{}, Version: 1},
+	}
+
+	t.Run("should stream json lines by default", func(t *testing.T) {
+		//arrange
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/skills:export", nil)
+		handler := NewSkillHandler(&mockRepo{skills: skills})
+
+		//act
+		handler.ExportSkills(c)
+
+		//assert
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+		assert.Equal(t, `{"key":"go","name":"Go","description":"fast, simple","logo":"","tags":["lang","backend"],"version":2}
+{"key":"rust","name":"Rust","description":"","logo":"","tags":[],"version":1}
+`, w.Body.String())
+	})
+	t.Run("should stream csv with a header", func(t *testing.T) {
+		//arrange
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/skills:export?format=csv", nil)
+		handler := NewSkillHandler(&mockRepo{skills: skills})
+
+		//act
+		handler.ExportSkills(c)
+
+		//assert
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="skills.csv"`, w.Header().Get("Content-Disposition"))
+		assert.Equal(t, "key,name,description,logo,tags\ngo,Go,\"fast, simple\",,\"[\"\"lang\"\",\"\"backend\"\"]\"\nrust,Rust,,,\n", w.Body.String())
+	})
+	t.Run("should import exported csv with the same tags", func(t *testing.T) {
+		//arrange
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/skills:export?format=csv", nil)
+		exported := []Skill{{Key: "go", Name: "Go", Tags: []string{"lang|backend", "fast, simple", `say "hi"`}}}
+		NewSkillHandler(&mockRepo{skills: exported}).ExportSkills(c)
+		mock := &mockRepo{}
+		_, ic := importRequest("text/csv", w.Body.String())
+
+		//act
+		NewSkillHandler(mock).ImportSkills(ic)
+
+		//assert
+		assert.Equal(t, exported[0].Tags, mock.imported[0][0].Tags)
+	})
+	t.Run("should response error when nothing was written yet", func(t *testing.T) {
+		//arrange
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/skills:export", nil)
+		handler := NewSkillHandler(&mockRepo{err: errs.Internal("Can't read skills", errors.New("db down"))})
+
+		//act
+		handler.ExportSkills(c)
+
+		//assert
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+	t.Run("should response bad request when format is unknown", func(t *testing.T) {
+		//arrange
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/skills:export?format=xml", nil)
+		handler := NewSkillHandler(&mockRepo{})
+
+		//act
+		handler.ExportSkills(c)
+
+		//assert
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, problem(c, http.StatusBadRequest, errs.CodeInvalidQuery, "format must be jsonl or csv"), w.Body.Bytes())
+	})
+}
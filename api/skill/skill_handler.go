@@ -1,9 +1,14 @@
 package skill
 
 import (
+	"gokafka/command"
 	"gokafka/errs"
 	"gokafka/response"
 	"net/http"
+	"skillevent"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,17 +23,71 @@ func NewSkillHandler(skillrepo SkillRepo) *skillHandler {
 
 func (h *skillHandler) GetSkillByKey(ctx *gin.Context) {
 	key := ctx.Param("key")
+	if value := ctx.Query("as_of"); value != "" {
+		h.getSkillAsOf(ctx, key, value)
+		return
+	}
 	skill, err := h.skillrepo.GetSkillByKey(key)
 	if err != nil {
 		response.Error(ctx, err)
 		return
 	}
 
+	ctx.Header("ETag", etag(skill.Version))
+	response.Success(ctx, http.StatusOK, skill)
+}
+
+// getSkillAsOf answers ?as_of= with the skill rebuilt from its history. It has
+// no ETag, since a past version can't be the base of a conditional write.
+func (h *skillHandler) getSkillAsOf(ctx *gin.Context, key string, value string) {
+	asOf, err := asOfQuery(value)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+	skill, err := h.skillrepo.GetSkillAsOf(key, asOf)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+
 	response.Success(ctx, http.StatusOK, skill)
 }
 
 func (h *skillHandler) GetSkills(ctx *gin.Context) {
-	skills, err := h.skillrepo.GetSkills()
+	query, err := skillQuery(ctx)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+
+	page, err := h.skillrepo.GetSkills(query)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+
+	response.SuccessWithMeta(ctx, http.StatusOK, page.Skills, PageMeta{NextCursor: page.NextCursor, Total: page.Total})
+}
+
+func (h *skillHandler) SearchSkills(ctx *gin.Context) {
+	q := strings.TrimSpace(ctx.Query("q"))
+	if q == "" {
+		response.Error(ctx, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidQuery, "q is required"))
+		return
+	}
+
+	limit := DefaultPageLimit
+	if value := ctx.Query("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > MaxPageLimit {
+			response.Error(ctx, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidQuery, "limit must be between 1 and "+strconv.Itoa(MaxPageLimit)))
+			return
+		}
+	}
+
+	skills, err := h.skillrepo.SearchSkills(q, limit)
 	if err != nil {
 		response.Error(ctx, err)
 		return
@@ -37,40 +96,84 @@ func (h *skillHandler) GetSkills(ctx *gin.Context) {
 	response.Success(ctx, http.StatusOK, skills)
 }
 
-func (h *skillHandler) CreateSkill(ctx *gin.Context) {
-	skill := Skill{}
-	err := ctx.BindJSON(&skill)
+func (h *skillHandler) GetSkillHistory(ctx *gin.Context) {
+	key := ctx.Param("key")
+	query := HistoryQuery{Limit: DefaultPageLimit, Cursor: ctx.Query("cursor")}
+	if value := ctx.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > MaxPageLimit {
+			response.Error(ctx, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidQuery, "limit must be between 1 and "+strconv.Itoa(MaxPageLimit)))
+			return
+		}
+		query.Limit = limit
+	}
+
+	page, err := h.skillrepo.GetSkillHistory(key, query)
 	if err != nil {
-		response.Error(ctx, errs.NewError(http.StatusBadRequest, "Can't bind payload"))
+		response.Error(ctx, err)
 		return
 	}
 
-	skillResult, err := h.skillrepo.CreateSkill(skill)
+	response.SuccessWithMeta(ctx, http.StatusOK, page.Entries, PageMeta{NextCursor: page.NextCursor, Total: page.Total})
+}
 
+func (h *skillHandler) CreateSkill(ctx *gin.Context) {
+	req := SkillCreateRequest{}
+	err := ctx.BindJSON(&req)
+	if err != nil {
+		response.Error(ctx, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidPayload, "Can't bind payload"))
+		return
+	}
+	skill, err := req.Skill()
 	if err != nil {
 		response.Error(ctx, err)
 		return
 	}
+	wait, err := waitFor(ctx)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+	cmd, err := h.skillrepo.WithCaller(callerFrom(ctx)).CreateSkill(skill)
 
-	response.Success(ctx, http.StatusCreated, skillResult)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+
+	h.respond(ctx, cmd, wait)
 }
 
 func (h *skillHandler) UpdateSkill(ctx *gin.Context) {
-	skill := Skill{}
+	req := SkillUpdateRequest{}
 	key := ctx.Param("key")
-	err := ctx.BindJSON(&skill)
+	err := ctx.BindJSON(&req)
 	if err != nil {
-		response.Error(ctx, errs.NewError(http.StatusBadRequest, "Can't bind payload"))
+		response.Error(ctx, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidPayload, "Can't bind payload"))
 		return
 	}
-
-	skillResult, err := h.skillrepo.UpdateSkill(key, skill)
+	skill, err := req.Skill(key)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+	expectedVersion, err := ifMatch(ctx)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+	wait, err := waitFor(ctx)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+	cmd, err := h.skillrepo.WithCaller(callerFrom(ctx)).UpdateSkill(key, skill, expectedVersion)
 	if err != nil {
 		response.Error(ctx, err)
 		return
 	}
 
-	response.Success(ctx, http.StatusOK, skillResult)
+	h.respond(ctx, cmd, wait)
 }
 
 func (h *skillHandler) UpdateSkillNameByKey(ctx *gin.Context) {
@@ -78,15 +181,30 @@ func (h *skillHandler) UpdateSkillNameByKey(ctx *gin.Context) {
 	key := ctx.Param("key")
 	err := ctx.BindJSON(&req)
 	if err != nil {
-		response.Error(ctx, errs.NewError(http.StatusBadRequest, "Can't bind payload"))
+		response.Error(ctx, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidPayload, "Can't bind payload"))
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if err := validationError(skillevent.Validate(skillevent.ValidateName(name))); err != nil {
+		response.Error(ctx, err)
+		return
+	}
+	expectedVersion, err := ifMatch(ctx)
+	if err != nil {
+		response.Error(ctx, err)
 		return
 	}
-	skill, err := h.skillrepo.UpdateSkillNameByKey(key, req.Name)
+	wait, err := waitFor(ctx)
 	if err != nil {
 		response.Error(ctx, err)
 		return
 	}
-	response.Success(ctx, http.StatusOK, skill)
+	cmd, err := h.skillrepo.WithCaller(callerFrom(ctx)).UpdateSkillNameByKey(key, name, expectedVersion)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+	h.respond(ctx, cmd, wait)
 }
 
 func (h *skillHandler) UpdateSkillDescriptionByKey(ctx *gin.Context) {
@@ -94,15 +212,25 @@ func (h *skillHandler) UpdateSkillDescriptionByKey(ctx *gin.Context) {
 	key := ctx.Param("key")
 	err := ctx.BindJSON(&req)
 	if err != nil {
-		response.Error(ctx, errs.NewError(http.StatusBadRequest, "Can't bind payload"))
+		response.Error(ctx, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidPayload, "Can't bind payload"))
 		return
 	}
-	skill, err := h.skillrepo.UpdateSkillDescriptionByKey(key, req.Description)
+	expectedVersion, err := ifMatch(ctx)
 	if err != nil {
 		response.Error(ctx, err)
 		return
 	}
-	response.Success(ctx, http.StatusOK, skill)
+	wait, err := waitFor(ctx)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+	cmd, err := h.skillrepo.WithCaller(callerFrom(ctx)).UpdateSkillDescriptionByKey(key, req.Description, expectedVersion)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+	h.respond(ctx, cmd, wait)
 }
 
 func (h *skillHandler) UpdateSkillLogoByKey(ctx *gin.Context) {
@@ -110,15 +238,29 @@ func (h *skillHandler) UpdateSkillLogoByKey(ctx *gin.Context) {
 	key := ctx.Param("key")
 	err := ctx.BindJSON(&req)
 	if err != nil {
-		response.Error(ctx, errs.NewError(http.StatusBadRequest, "Can't bind payload"))
+		response.Error(ctx, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidPayload, "Can't bind payload"))
+		return
+	}
+	if err := validationError(skillevent.Validate(skillevent.ValidateLogo(req.Logo))); err != nil {
+		response.Error(ctx, err)
 		return
 	}
-	skill, err := h.skillrepo.UpdateSkillLogoByKey(key, req.Logo)
+	expectedVersion, err := ifMatch(ctx)
 	if err != nil {
 		response.Error(ctx, err)
 		return
 	}
-	response.Success(ctx, http.StatusOK, skill)
+	wait, err := waitFor(ctx)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+	cmd, err := h.skillrepo.WithCaller(callerFrom(ctx)).UpdateSkillLogoByKey(key, req.Logo, expectedVersion)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+	h.respond(ctx, cmd, wait)
 }
 
 func (h *skillHandler) UpdateSkillTagsByKey(ctx *gin.Context) {
@@ -126,24 +268,160 @@ func (h *skillHandler) UpdateSkillTagsByKey(ctx *gin.Context) {
 	key := ctx.Param("key")
 	err := ctx.BindJSON(&req)
 	if err != nil {
-		response.Error(ctx, errs.NewError(http.StatusBadRequest, "Can't bind payload"))
+		response.Error(ctx, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidPayload, "Can't bind payload"))
+		return
+	}
+	tags := skillevent.NormalizeTags(req.Tags)
+	if err := validationError(skillevent.Validate(skillevent.ValidateTags(tags))); err != nil {
+		response.Error(ctx, err)
 		return
 	}
-	skill, err := h.skillrepo.UpdateSkillTagsByKey(key, req.Tags)
+	expectedVersion, err := ifMatch(ctx)
 	if err != nil {
 		response.Error(ctx, err)
 		return
 	}
-	response.Success(ctx, http.StatusOK, skill)
+	wait, err := waitFor(ctx)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+	cmd, err := h.skillrepo.WithCaller(callerFrom(ctx)).UpdateSkillTagsByKey(key, tags, expectedVersion)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+	h.respond(ctx, cmd, wait)
 }
 
 func (h *skillHandler) DeleteSkill(ctx *gin.Context) {
 	key := ctx.Param("key")
-	err := h.skillrepo.DeleteSkillByKey(key)
+	expectedVersion, err := ifMatch(ctx)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+	wait, err := waitFor(ctx)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+	cmd, err := h.skillrepo.WithCaller(callerFrom(ctx)).DeleteSkillByKey(key, expectedVersion)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+
+	h.respond(ctx, cmd, wait)
+}
+
+func (h *skillHandler) RevertSkill(ctx *gin.Context) {
+	req := RevertRequest{}
+	key := ctx.Param("key")
+	err := ctx.BindJSON(&req)
+	if err != nil {
+		response.Error(ctx, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidPayload, "Can't bind payload"))
+		return
+	}
+	if req.Version < 1 {
+		response.Error(ctx, errs.NewValidationError([]errs.FieldError{{Field: "version", Message: "must be at least 1"}}))
+		return
+	}
+	expectedVersion, err := ifMatch(ctx)
 	if err != nil {
 		response.Error(ctx, err)
 		return
 	}
+	wait, err := waitFor(ctx)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+	cmd, err := h.skillrepo.WithCaller(callerFrom(ctx)).RevertSkill(key, req.Version, expectedVersion)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+	h.respond(ctx, cmd, wait)
+}
+
+// asOfQuery reads ?as_of=, a skill version or an RFC 3339 time.
+func asOfQuery(value string) (AsOf, error) {
+	if version, err := strconv.ParseInt(value, 10, 64); err == nil && version > 0 {
+		return AsOf{Version: version}, nil
+	}
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		return AsOf{Time: at}, nil
+	}
+	return AsOf{}, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidQuery, "as_of must be a version or an RFC 3339 time")
+}
+
+// skillQuery reads the list parameters, e.g.
+// ?limit=20&cursor=...&tags=go,web&tag_match=all&name_prefix=go&keys=go,python&sort=name
+func skillQuery(ctx *gin.Context) (SkillQuery, error) {
+	query := SkillQuery{
+		Limit:      DefaultPageLimit,
+		Cursor:     ctx.Query("cursor"),
+		Tags:       splitList(ctx.Query("tags")),
+		TagMatch:   TagMatch(ctx.DefaultQuery("tag_match", string(TagMatchAny))),
+		NamePrefix: ctx.Query("name_prefix"),
+		Keys:       splitList(ctx.Query("keys")),
+		Sort:       SortField(ctx.DefaultQuery("sort", string(SortByKey))),
+	}
+
+	if value := ctx.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > MaxPageLimit {
+			return SkillQuery{}, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidQuery, "limit must be between 1 and "+strconv.Itoa(MaxPageLimit))
+		}
+		query.Limit = limit
+	}
+	if query.TagMatch != TagMatchAny && query.TagMatch != TagMatchAll {
+		return SkillQuery{}, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidQuery, "tag_match must be any or all")
+	}
+	if query.Sort != SortByKey && query.Sort != SortByName {
+		return SkillQuery{}, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidQuery, "sort must be key or name")
+	}
+
+	return query, nil
+}
+
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func etag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// ifMatch reads the expected skill version from the If-Match header. No
+// header, or "*", means the write is not conditional and returns zero.
+// If-Match compares strongly, so a weak ETag never matches.
+func ifMatch(ctx *gin.Context) (int64, error) {
+	value := strings.TrimSpace(ctx.GetHeader("If-Match"))
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+	if strings.HasPrefix(value, "W/") {
+		return 0, errs.NewErrorWithCode(http.StatusPreconditionFailed, errs.CodePreconditionFailed, "If-Match needs a strong ETag")
+	}
+	unquoted, err := strconv.Unquote(value)
+	if err != nil {
+		unquoted = value
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || version < 1 {
+		return 0, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidIfMatch, "Invalid If-Match header")
+	}
+	return version, nil
+}
 
-	response.SuccessMsg(ctx, http.StatusOK, "Skill deleted")
+func accepted(ctx *gin.Context, cmd *command.Command) {
+	response.Accepted(ctx, "/api/v1/commands/"+cmd.ID, cmd)
 }
@@ -2,17 +2,35 @@ package skill
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"gokafka/command"
 	"gokafka/errs"
+	"gokafka/middleware"
 	"gokafka/response"
 	"net/http"
 	"net/http/httptest"
+	"platform/tracing"
+	"platform/tracing/tracingtest"
+	"skillevent"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/baggage"
 )
 
+func newCommand() command.Command {
+	return command.Command{
+		ID:     "6f1c0b7e-8a8e-4c4e-9d3b-3f1f0d2a6b11",
+		Action: string(CreateSkillAction),
+		Key:    "test-key",
+		Status: command.StatusPending,
+	}
+}
+
 func TestGetSkillByKey(t *testing.T) {
 	t.Run("should response skills by key", func(t *testing.T) {
 		//arrange
@@ -24,8 +42,9 @@ func TestGetSkillByKey(t *testing.T) {
 			Key:         "1",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
+			Version:     4,
 		}
 		mock := &mockRepo{skill: skill}
 		handler := NewSkillHandler(mock)
@@ -42,6 +61,7 @@ func TestGetSkillByKey(t *testing.T) {
 
 		assert.Equal(t, w.Code, http.StatusOK)
 		assert.Equal(t, w.Body.Bytes(), want)
+		assert.Equal(t, `"4"`, w.Header().Get("ETag"))
 
 	})
 
@@ -53,10 +73,7 @@ func TestGetSkillByKey(t *testing.T) {
 		mock := &mockRepo{err: errs.NewError(http.StatusNotFound, "Skill not found")}
 		handler := NewSkillHandler(mock)
 
-		want, _ := json.Marshal(response.Response{
-			Status:  "error",
-			Message: "Skill not found",
-		})
+		want := problem(c, http.StatusNotFound, errs.CodeNotFound, "Skill not found")
 
 		//act
 		handler.GetSkillByKey(c)
@@ -70,21 +87,23 @@ func TestGetSkills(t *testing.T) {
 	t.Run("should response skills from repository", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/skills", nil)
 		skills := []Skill{
 			{
 				Key:         "test-key",
 				Name:        "test",
 				Description: "test",
-				Logo:        "test",
+				Logo:        "https://example.com/test.svg",
 				Tags:        []string{"tag"},
 			},
 		}
-		mock := &mockRepo{skills: skills}
+		mock := &mockRepo{skills: skills, nextCursor: "next"}
 		handler := NewSkillHandler(mock)
 
 		want, _ := json.Marshal(response.Response{
 			Status: "success",
 			Data:   skills,
+			Meta:   PageMeta{NextCursor: "next", Total: 1},
 		})
 
 		//act
@@ -92,19 +111,67 @@ func TestGetSkills(t *testing.T) {
 		//assert
 		assert.Equal(t, w.Code, http.StatusOK)
 		assert.Equal(t, w.Body.Bytes(), want)
+		assert.Equal(t, SkillQuery{
+			Limit:    DefaultPageLimit,
+			Tags:     []string{},
+			TagMatch: TagMatchAny,
+			Keys:     []string{},
+			Sort:     SortByKey,
+		}, mock.query)
+	})
+	t.Run("should pass list parameters to repository", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/skills?limit=5&cursor=abc&tags=go,%20web,&tag_match=all&name_prefix=Go&keys=go,python&sort=name", nil)
+		mock := &mockRepo{}
+		handler := NewSkillHandler(mock)
+
+		//act
+		handler.GetSkills(c)
+		//assert
+		assert.Equal(t, w.Code, http.StatusOK)
+		assert.Equal(t, SkillQuery{
+			Limit:      5,
+			Cursor:     "abc",
+			Tags:       []string{"go", "web"},
+			TagMatch:   TagMatchAll,
+			NamePrefix: "Go",
+			Keys:       []string{"go", "python"},
+			Sort:       SortByName,
+		}, mock.query)
+	})
+	t.Run("should response bad request when list parameters are invalid", func(t *testing.T) {
+		cases := map[string]string{
+			"limit=0":        "limit must be between 1 and 100",
+			"limit=101":      "limit must be between 1 and 100",
+			"limit=ten":      "limit must be between 1 and 100",
+			"tag_match=some": "tag_match must be any or all",
+			"sort=logo":      "sort must be key or name",
+		}
+		for query, message := range cases {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/skills?"+query, nil)
+			handler := NewSkillHandler(&mockRepo{})
+
+			want := problem(c, http.StatusBadRequest, errs.CodeInvalidQuery, message)
+
+			//act
+			handler.GetSkills(c)
+			//assert
+			assert.Equal(t, http.StatusBadRequest, w.Code, query)
+			assert.Equal(t, want, w.Body.Bytes(), query)
+		}
 	})
 	t.Run("should response error when skill not found by key", func(t *testing.T) {
 		//arrange
 		w := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(w)
-		c.Params = append(c.Params, gin.Param{Key: "key", Value: "1"})
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/skills", nil)
 		mock := &mockRepo{err: errs.NewError(http.StatusNotFound, "Skill not found")}
 		handler := NewSkillHandler(mock)
 
-		want, _ := json.Marshal(response.Response{
-			Status:  "error",
-			Message: "Skill not found",
-		})
+		want := problem(c, http.StatusNotFound, errs.CodeNotFound, "Skill not found")
 
 		//act
 		handler.GetSkills(c)
@@ -114,6 +181,44 @@ func TestGetSkills(t *testing.T) {
 	})
 }
 
+func TestSearchSkills(t *testing.T) {
+	t.Run("should response skills found by repository", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/skills/search?q=web%20framework&limit=5", nil)
+		skills := []Skill{{Key: "gin", Name: "Gin", Tags: []string{"web"}}}
+		mock := &mockRepo{skills: skills}
+		handler := NewSkillHandler(mock)
+
+		want, _ := json.Marshal(response.Response{
+			Status: "success",
+			Data:   skills,
+		})
+
+		//act
+		handler.SearchSkills(c)
+		//assert
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, want, w.Body.Bytes())
+		assert.Equal(t, "web framework", mock.search)
+		assert.Equal(t, 5, mock.query.Limit)
+	})
+	t.Run("should response bad request when q is missing", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/skills/search?q=%20", nil)
+		handler := NewSkillHandler(&mockRepo{})
+
+		want := problem(c, http.StatusBadRequest, errs.CodeInvalidQuery, "q is required")
+
+		//act
+		handler.SearchSkills(c)
+		//assert
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, want, w.Body.Bytes())
+	})
+}
+
 func TestCreateSkill(t *testing.T) {
 	t.Run("should response created skill from repository", func(t *testing.T) {
 		w := httptest.NewRecorder()
@@ -122,22 +227,24 @@ func TestCreateSkill(t *testing.T) {
 			Key:         "test-key",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
-		mock := &mockRepo{skill: skill}
+		cmd := newCommand()
+		mock := &mockRepo{command: cmd}
 		handler := NewSkillHandler(mock)
 		body, _ := json.Marshal(skill)
 		c.Request, _ = http.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
 
 		want, _ := json.Marshal(response.Response{
 			Status: "success",
-			Data:   skill,
+			Data:   cmd,
 		})
 		//act
 		handler.CreateSkill(c)
 		//assert
-		assert.Equal(t, w.Code, http.StatusCreated)
+		assert.Equal(t, w.Code, http.StatusAccepted)
+		assert.Equal(t, "/api/v1/commands/"+cmd.ID, w.Header().Get("Location"))
 		assert.Equal(t, w.Body.Bytes(), want)
 	})
 	t.Run("should response error when skill not found by key", func(t *testing.T) {
@@ -148,16 +255,13 @@ func TestCreateSkill(t *testing.T) {
 			Key:         "test-key",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mock := &mockRepo{skill: skill}
 		handler := NewSkillHandler(mock)
 
-		want, _ := json.Marshal(response.Response{
-			Status:  "error",
-			Message: "Can't bind payload",
-		})
+		want := problem(c, http.StatusBadRequest, errs.CodeInvalidPayload, "Can't bind payload")
 
 		//act
 		handler.CreateSkill(c)
@@ -172,7 +276,7 @@ func TestCreateSkill(t *testing.T) {
 			Key:         "test-key",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mock := &mockRepo{err: errs.NewError(http.StatusInternalServerError, "could not create skill")}
@@ -180,10 +284,7 @@ func TestCreateSkill(t *testing.T) {
 		body, _ := json.Marshal(skill)
 		c.Request, _ = http.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
 
-		want, _ := json.Marshal(response.Response{
-			Status:  "error",
-			Message: "could not create skill",
-		})
+		want := problem(c, http.StatusInternalServerError, errs.CodeInternal, "could not create skill")
 		//act
 		handler.CreateSkill(c)
 		//assert
@@ -192,6 +293,43 @@ func TestCreateSkill(t *testing.T) {
 	})
 }
 
+func TestCreateSkillValidation(t *testing.T) {
+	t.Run("should response unprocessable entity listing each invalid field", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		mock := &mockRepo{command: newCommand()}
+		handler := NewSkillHandler(mock)
+		body := []byte(`{"key":"Not A Slug","name":"   ","logo":"logo.png","tags":["go"]}`)
+		c.Request, _ = http.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+
+		want := problem(c, http.StatusUnprocessableEntity, errs.CodeValidation, "Validation failed",
+			errs.FieldError{Field: "key", Message: "must be lowercase letters and digits separated by single hyphens"},
+			errs.FieldError{Field: "name", Message: "is required"},
+			errs.FieldError{Field: "logo", Message: "must be an http or https URL"},
+		)
+		//act
+		handler.CreateSkill(c)
+		//assert
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, string(want), w.Body.String())
+		assert.Equal(t, Skill{}, mock.published)
+	})
+	t.Run("should publish normalized skill", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		mock := &mockRepo{command: newCommand()}
+		handler := NewSkillHandler(mock)
+		body := []byte(`{"key":"go","name":" Go ","logo":"https://go.dev/logo.svg","tags":["Go"," go ","Web",""]}`)
+		c.Request, _ = http.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+
+		//act
+		handler.CreateSkill(c)
+		//assert
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Equal(t, Skill{Key: "go", Name: "Go", Logo: "https://go.dev/logo.svg", Tags: []string{"go", "web"}}, mock.published)
+	})
+}
+
 func TestUpdateSkill(t *testing.T) {
 	t.Run("should response updated skill from repository", func(t *testing.T) {
 		w := httptest.NewRecorder()
@@ -201,22 +339,24 @@ func TestUpdateSkill(t *testing.T) {
 			Key:         "test-key",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
-		mock := &mockRepo{skill: skill}
+		cmd := newCommand()
+		mock := &mockRepo{command: cmd}
 		handler := NewSkillHandler(mock)
 		body, _ := json.Marshal(skill)
 		c.Request, _ = http.NewRequest(http.MethodPut, "/", bytes.NewReader(body))
 
 		want, _ := json.Marshal(response.Response{
 			Status: "success",
-			Data:   skill,
+			Data:   cmd,
 		})
 		//act
 		handler.UpdateSkill(c)
 		//assert
-		assert.Equal(t, w.Code, http.StatusOK)
+		assert.Equal(t, w.Code, http.StatusAccepted)
+		assert.Equal(t, "/api/v1/commands/"+cmd.ID, w.Header().Get("Location"))
 		assert.Equal(t, w.Body.Bytes(), want)
 	})
 
@@ -228,16 +368,13 @@ func TestUpdateSkill(t *testing.T) {
 			Key:         "test-key",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mock := &mockRepo{skill: skill}
 		handler := NewSkillHandler(mock)
 
-		want, _ := json.Marshal(response.Response{
-			Status:  "error",
-			Message: "Can't bind payload",
-		})
+		want := problem(c, http.StatusBadRequest, errs.CodeInvalidPayload, "Can't bind payload")
 
 		//act
 		handler.UpdateSkill(c)
@@ -253,7 +390,7 @@ func TestUpdateSkill(t *testing.T) {
 			Key:         "test-key",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mock := &mockRepo{err: errs.NewError(http.StatusInternalServerError, "could not update skill")}
@@ -261,10 +398,7 @@ func TestUpdateSkill(t *testing.T) {
 		body, _ := json.Marshal(skill)
 		c.Request, _ = http.NewRequest(http.MethodPut, "/", bytes.NewReader(body))
 
-		want, _ := json.Marshal(response.Response{
-			Status:  "error",
-			Message: "could not update skill",
-		})
+		want := problem(c, http.StatusInternalServerError, errs.CodeInternal, "could not update skill")
 		//act
 		handler.UpdateSkill(c)
 		//assert
@@ -282,22 +416,24 @@ func TestUpdateNameByKey(t *testing.T) {
 			Key:         "test-key",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
-		mock := &mockRepo{skill: skill}
+		cmd := newCommand()
+		mock := &mockRepo{command: cmd}
 		handler := NewSkillHandler(mock)
 		body, _ := json.Marshal(skill)
 		c.Request, _ = http.NewRequest(http.MethodPatch, "/", bytes.NewReader(body))
 
 		want, _ := json.Marshal(response.Response{
 			Status: "success",
-			Data:   skill,
+			Data:   cmd,
 		})
 		//act
 		handler.UpdateSkillNameByKey(c)
 		//assert
-		assert.Equal(t, w.Code, http.StatusOK)
+		assert.Equal(t, w.Code, http.StatusAccepted)
+		assert.Equal(t, "/api/v1/commands/"+cmd.ID, w.Header().Get("Location"))
 		assert.Equal(t, w.Body.Bytes(), want)
 	})
 	t.Run("should response error when no payload", func(t *testing.T) {
@@ -308,16 +444,13 @@ func TestUpdateNameByKey(t *testing.T) {
 			Key:         "test-key",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mock := &mockRepo{skill: skill}
 		handler := NewSkillHandler(mock)
 
-		want, _ := json.Marshal(response.Response{
-			Status:  "error",
-			Message: "Can't bind payload",
-		})
+		want := problem(c, http.StatusBadRequest, errs.CodeInvalidPayload, "Can't bind payload")
 
 		//act
 		handler.UpdateSkillNameByKey(c)
@@ -333,7 +466,7 @@ func TestUpdateNameByKey(t *testing.T) {
 			Key:         "test-key",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mock := &mockRepo{err: errs.NewError(http.StatusInternalServerError, "Can't update skill")}
@@ -341,10 +474,7 @@ func TestUpdateNameByKey(t *testing.T) {
 		body, _ := json.Marshal(skill)
 		c.Request, _ = http.NewRequest(http.MethodPatch, "/", bytes.NewReader(body))
 
-		want, _ := json.Marshal(response.Response{
-			Status:  "error",
-			Message: "Can't update skill",
-		})
+		want := problem(c, http.StatusInternalServerError, errs.CodeInternal, "Can't update skill")
 		//act
 		handler.UpdateSkillNameByKey(c)
 		//assert
@@ -353,6 +483,21 @@ func TestUpdateNameByKey(t *testing.T) {
 	})
 }
 
+func TestUpdateNameByKeyValidation(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = append(c.Params, gin.Param{Key: "key", Value: "go"})
+	handler := NewSkillHandler(&mockRepo{command: newCommand()})
+	c.Request, _ = http.NewRequest(http.MethodPatch, "/", bytes.NewReader([]byte(`{"name":"  "}`)))
+
+	want := problem(c, http.StatusUnprocessableEntity, errs.CodeValidation, "Validation failed", errs.FieldError{Field: "name", Message: "is required"})
+	//act
+	handler.UpdateSkillNameByKey(c)
+	//assert
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, string(want), w.Body.String())
+}
+
 func TestUpdateDescriptionByKey(t *testing.T) {
 	t.Run("should response updated skill from repository", func(t *testing.T) {
 		w := httptest.NewRecorder()
@@ -362,22 +507,24 @@ func TestUpdateDescriptionByKey(t *testing.T) {
 			Key:         "test-key",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
-		mock := &mockRepo{skill: skill}
+		cmd := newCommand()
+		mock := &mockRepo{command: cmd}
 		handler := NewSkillHandler(mock)
 		body, _ := json.Marshal(skill)
 		c.Request, _ = http.NewRequest(http.MethodPatch, "/", bytes.NewReader(body))
 
 		want, _ := json.Marshal(response.Response{
 			Status: "success",
-			Data:   skill,
+			Data:   cmd,
 		})
 		//act
 		handler.UpdateSkillDescriptionByKey(c)
 		//assert
-		assert.Equal(t, w.Code, http.StatusOK)
+		assert.Equal(t, w.Code, http.StatusAccepted)
+		assert.Equal(t, "/api/v1/commands/"+cmd.ID, w.Header().Get("Location"))
 		assert.Equal(t, w.Body.Bytes(), want)
 	})
 	t.Run("should response error when no payload", func(t *testing.T) {
@@ -388,16 +535,13 @@ func TestUpdateDescriptionByKey(t *testing.T) {
 			Key:         "test-key",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mock := &mockRepo{skill: skill}
 		handler := NewSkillHandler(mock)
 
-		want, _ := json.Marshal(response.Response{
-			Status:  "error",
-			Message: "Can't bind payload",
-		})
+		want := problem(c, http.StatusBadRequest, errs.CodeInvalidPayload, "Can't bind payload")
 
 		//act
 		handler.UpdateSkillDescriptionByKey(c)
@@ -413,7 +557,7 @@ func TestUpdateDescriptionByKey(t *testing.T) {
 			Key:         "test-key",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mock := &mockRepo{err: errs.NewError(http.StatusInternalServerError, "Can't update skill")}
@@ -421,10 +565,7 @@ func TestUpdateDescriptionByKey(t *testing.T) {
 		body, _ := json.Marshal(skill)
 		c.Request, _ = http.NewRequest(http.MethodPatch, "/", bytes.NewReader(body))
 
-		want, _ := json.Marshal(response.Response{
-			Status:  "error",
-			Message: "Can't update skill",
-		})
+		want := problem(c, http.StatusInternalServerError, errs.CodeInternal, "Can't update skill")
 		//act
 		handler.UpdateSkillDescriptionByKey(c)
 		//assert
@@ -441,22 +582,24 @@ func TestUpdateTagsByKey(t *testing.T) {
 			Key:         "test-key",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
-		mock := &mockRepo{skill: skill}
+		cmd := newCommand()
+		mock := &mockRepo{command: cmd}
 		handler := NewSkillHandler(mock)
 		body, _ := json.Marshal(skill)
 		c.Request, _ = http.NewRequest(http.MethodPatch, "/", bytes.NewReader(body))
 
 		want, _ := json.Marshal(response.Response{
 			Status: "success",
-			Data:   skill,
+			Data:   cmd,
 		})
 		//act
 		handler.UpdateSkillTagsByKey(c)
 		//assert
-		assert.Equal(t, w.Code, http.StatusOK)
+		assert.Equal(t, w.Code, http.StatusAccepted)
+		assert.Equal(t, "/api/v1/commands/"+cmd.ID, w.Header().Get("Location"))
 		assert.Equal(t, w.Body.Bytes(), want)
 	})
 	t.Run("should response error when no payload", func(t *testing.T) {
@@ -467,16 +610,13 @@ func TestUpdateTagsByKey(t *testing.T) {
 			Key:         "test-key",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mock := &mockRepo{skill: skill}
 		handler := NewSkillHandler(mock)
 
-		want, _ := json.Marshal(response.Response{
-			Status:  "error",
-			Message: "Can't bind payload",
-		})
+		want := problem(c, http.StatusBadRequest, errs.CodeInvalidPayload, "Can't bind payload")
 
 		//act
 		handler.UpdateSkillTagsByKey(c)
@@ -492,7 +632,7 @@ func TestUpdateTagsByKey(t *testing.T) {
 			Key:         "test-key",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mock := &mockRepo{err: errs.NewError(http.StatusInternalServerError, "Can't update skill")}
@@ -500,10 +640,7 @@ func TestUpdateTagsByKey(t *testing.T) {
 		body, _ := json.Marshal(skill)
 		c.Request, _ = http.NewRequest(http.MethodPatch, "/", bytes.NewReader(body))
 
-		want, _ := json.Marshal(response.Response{
-			Status:  "error",
-			Message: "Can't update skill",
-		})
+		want := problem(c, http.StatusInternalServerError, errs.CodeInternal, "Can't update skill")
 		//act
 		handler.UpdateSkillTagsByKey(c)
 		//assert
@@ -512,6 +649,40 @@ func TestUpdateTagsByKey(t *testing.T) {
 	})
 }
 
+func TestUpdateTagsByKeyValidation(t *testing.T) {
+	t.Run("should publish normalized tags", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = append(c.Params, gin.Param{Key: "key", Value: "go"})
+		mock := &mockRepo{command: newCommand()}
+		handler := NewSkillHandler(mock)
+		c.Request, _ = http.NewRequest(http.MethodPatch, "/", bytes.NewReader([]byte(`{"tags":["Web","web "," Cloud  Native "]}`)))
+
+		//act
+		handler.UpdateSkillTagsByKey(c)
+		//assert
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Equal(t, []string{"web", "cloud native"}, mock.published.Tags)
+	})
+	t.Run("should response unprocessable entity when there are too many tags", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = append(c.Params, gin.Param{Key: "key", Value: "go"})
+		handler := NewSkillHandler(&mockRepo{command: newCommand()})
+		tags := []string{}
+		for i := 0; i <= skillevent.MaxTags; i++ {
+			tags = append(tags, fmt.Sprintf("tag-%d", i))
+		}
+		body, _ := json.Marshal(TagsUpdateRequest{Tags: tags})
+		c.Request, _ = http.NewRequest(http.MethodPatch, "/", bytes.NewReader(body))
+
+		//act
+		handler.UpdateSkillTagsByKey(c)
+		//assert
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+}
+
 func TestUpdateLogoByKey(t *testing.T) {
 	t.Run("should response updated skill from repository", func(t *testing.T) {
 		w := httptest.NewRecorder()
@@ -521,21 +692,23 @@ func TestUpdateLogoByKey(t *testing.T) {
 			Key:         "test-key",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
-		mock := &mockRepo{skill: skill}
+		cmd := newCommand()
+		mock := &mockRepo{command: cmd}
 		handler := NewSkillHandler(mock)
 		body, _ := json.Marshal(skill)
 		c.Request, _ = http.NewRequest(http.MethodPatch, "/", bytes.NewReader(body))
 		want, _ := json.Marshal(response.Response{
 			Status: "success",
-			Data:   skill,
+			Data:   cmd,
 		})
 		//act
 		handler.UpdateSkillLogoByKey(c)
 		//assert
-		assert.Equal(t, w.Code, http.StatusOK)
+		assert.Equal(t, w.Code, http.StatusAccepted)
+		assert.Equal(t, "/api/v1/commands/"+cmd.ID, w.Header().Get("Location"))
 		assert.Equal(t, w.Body.Bytes(), want)
 	})
 	t.Run("should response error when no payload", func(t *testing.T) {
@@ -546,16 +719,13 @@ func TestUpdateLogoByKey(t *testing.T) {
 			Key:         "test-key",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mock := &mockRepo{skill: skill}
 		handler := NewSkillHandler(mock)
 
-		want, _ := json.Marshal(response.Response{
-			Status:  "error",
-			Message: "Can't bind payload",
-		})
+		want := problem(c, http.StatusBadRequest, errs.CodeInvalidPayload, "Can't bind payload")
 
 		//act
 		handler.UpdateSkillLogoByKey(c)
@@ -571,7 +741,7 @@ func TestUpdateLogoByKey(t *testing.T) {
 			Key:         "test-key",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mock := &mockRepo{err: errs.NewError(http.StatusInternalServerError, "Can't update skill")}
@@ -579,10 +749,7 @@ func TestUpdateLogoByKey(t *testing.T) {
 		body, _ := json.Marshal(skill)
 		c.Request, _ = http.NewRequest(http.MethodPatch, "/", bytes.NewReader(body))
 
-		want, _ := json.Marshal(response.Response{
-			Status:  "error",
-			Message: "Can't update skill",
-		})
+		want := problem(c, http.StatusInternalServerError, errs.CodeInternal, "Can't update skill")
 		//act
 		handler.UpdateSkillLogoByKey(c)
 		//assert
@@ -595,28 +762,29 @@ func TestDeleteSkill(t *testing.T) {
 	t.Run("should delete skill", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodDelete, "/api/v1/skills/test", nil)
 		c.Params = []gin.Param{{Key: "test-key", Value: "test"}}
+		cmd := newCommand()
 		want, _ := json.Marshal(response.Response{
-			Status:  "success",
-			Message: "Skill deleted",
+			Status: "success",
+			Data:   cmd,
 		})
-		mock := &mockRepo{}
+		mock := &mockRepo{command: cmd}
 		handler := NewSkillHandler(mock)
 		//act
 		handler.DeleteSkill(c)
 		//assert
-		assert.Equal(t, w.Code, http.StatusOK)
+		assert.Equal(t, w.Code, http.StatusAccepted)
+		assert.Equal(t, "/api/v1/commands/"+cmd.ID, w.Header().Get("Location"))
 		assert.Equal(t, want, w.Body.Bytes())
 	})
 
 	t.Run("should return error when delete skill repo fail", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodDelete, "/api/v1/skills/test", nil)
 		c.Params = []gin.Param{{Key: "test-key", Value: "test"}}
-		want, _ := json.Marshal(response.Response{
-			Status:  "error",
-			Message: "Can't delete skill",
-		})
+		want := problem(c, http.StatusInternalServerError, errs.CodeInternal, "Can't delete skill")
 		mock := &mockRepo{err: errs.NewError(http.StatusInternalServerError, "Can't delete skill")}
 		handler := NewSkillHandler(mock)
 		//act
@@ -625,5 +793,278 @@ func TestDeleteSkill(t *testing.T) {
 		assert.Equal(t, w.Code, http.StatusInternalServerError)
 		assert.Equal(t, want, w.Body.Bytes())
 	})
+	t.Run("should pass If-Match version to repository", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodDelete, "/api/v1/skills/test", nil)
+		c.Request.Header.Set("If-Match", `"3"`)
+		c.Params = []gin.Param{{Key: "key", Value: "test"}}
+		mock := &mockRepo{command: newCommand()}
+		handler := NewSkillHandler(mock)
+		//act
+		handler.DeleteSkill(c)
+		//assert
+		assert.Equal(t, w.Code, http.StatusAccepted)
+		assert.Equal(t, int64(3), mock.expectedVersion)
+	})
+	t.Run("should response bad request when If-Match is not a version", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodDelete, "/api/v1/skills/test", nil)
+		c.Request.Header.Set("If-Match", `"abc"`)
+		c.Params = []gin.Param{{Key: "key", Value: "test"}}
+		want := problem(c, http.StatusBadRequest, errs.CodeInvalidIfMatch, "Invalid If-Match header")
+		mock := &mockRepo{command: newCommand()}
+		handler := NewSkillHandler(mock)
+		//act
+		handler.DeleteSkill(c)
+		//assert
+		assert.Equal(t, w.Code, http.StatusBadRequest)
+		assert.Equal(t, want, w.Body.Bytes())
+	})
+	t.Run("should response precondition failed when If-Match is a weak etag", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodDelete, "/api/v1/skills/test", nil)
+		c.Request.Header.Set("If-Match", `W/"3"`)
+		c.Params = []gin.Param{{Key: "key", Value: "test"}}
+		want := problem(c, http.StatusPreconditionFailed, errs.CodePreconditionFailed, "If-Match needs a strong ETag")
+		mock := &mockRepo{command: newCommand()}
+		handler := NewSkillHandler(mock)
+		//act
+		handler.DeleteSkill(c)
+		//assert
+		assert.Equal(t, w.Code, http.StatusPreconditionFailed)
+		assert.Equal(t, want, w.Body.Bytes())
+	})
+}
+
+func TestIfMatch(t *testing.T) {
+	cases := map[string]int64{
+		"":       0,
+		"*":      0,
+		`"7"`:    7,
+		"7":      7,
+		` "12" `: 12,
+	}
+	for header, want := range cases {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPut, "/api/v1/skills/go", nil)
+		c.Request.Header.Set("If-Match", header)
+
+		got, err := ifMatch(c)
+
+		assert.NoError(t, err, header)
+		assert.Equal(t, want, got, header)
+	}
+}
+
+// problem is the problem details body the handler is expected to write for c.
+func TestGetSkillAsOf(t *testing.T) {
+	t.Run("should response skill rebuilt at a version without etag", func(t *testing.T) {
+		//arrange
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/skills/go?as_of=2", nil)
+		c.Params = gin.Params{{Key: "key", Value: "go"}}
+		skill := Skill{Key: "go", Name: "go", Tags: []string{}, Version: 2}
+		mock := &mockRepo{skill: skill}
+		handler := NewSkillHandler(mock)
+
+		want, _ := json.Marshal(response.Response{
+			Status: "success",
+			Data:   skill,
+		})
+
+		//act
+		handler.GetSkillByKey(c)
+
+		//assert
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, want, w.Body.Bytes())
+		assert.Equal(t, AsOf{Version: 2}, mock.asOf)
+		assert.Empty(t, w.Header().Get("ETag"))
+	})
+	t.Run("should pass a timestamp to repository", func(t *testing.T) {
+		//arrange
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/skills/go?as_of=2024-07-01T10:00:00Z", nil)
+		mock := &mockRepo{}
+		handler := NewSkillHandler(mock)
+
+		//act
+		handler.GetSkillByKey(c)
+
+		//assert
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, AsOf{Time: time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC)}, mock.asOf)
+	})
+	t.Run("should response bad request when as_of is invalid", func(t *testing.T) {
+		//arrange
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/skills/go?as_of=yesterday", nil)
+		handler := NewSkillHandler(&mockRepo{})
+
+		//act
+		handler.GetSkillByKey(c)
+
+		//assert
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, problem(c, http.StatusBadRequest, errs.CodeInvalidQuery, "as_of must be a version or an RFC 3339 time"), w.Body.Bytes())
+	})
+}
+
+func TestRevertSkill(t *testing.T) {
+	t.Run("should response accepted command when revert is published", func(t *testing.T) {
+		//arrange
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/skills/go/actions/revert", bytes.NewReader([]byte(`{"version":2}`)))
+		c.Request.Header.Set("If-Match", `"5"`)
+		c.Params = gin.Params{{Key: "key", Value: "go"}}
+		cmd := newCommand()
+		mock := &mockRepo{command: cmd}
+		handler := NewSkillHandler(mock)
+
+		want, _ := json.Marshal(response.Response{
+			Status: "success",
+			Data:   cmd,
+		})
+
+		//act
+		handler.RevertSkill(c)
+
+		//assert
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Equal(t, want, w.Body.Bytes())
+		assert.Equal(t, int64(2), mock.revertVersion)
+		assert.Equal(t, int64(5), mock.expectedVersion)
+	})
+	t.Run("should response unprocessable entity when version is missing", func(t *testing.T) {
+		//arrange
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/skills/go/actions/revert", bytes.NewReader([]byte(`{}`)))
+		handler := NewSkillHandler(&mockRepo{})
 
+		//act
+		handler.RevertSkill(c)
+
+		//assert
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, problem(c, http.StatusUnprocessableEntity, errs.CodeValidation, "Validation failed", errs.FieldError{Field: "version", Message: "must be at least 1"}), w.Body.Bytes())
+	})
+}
+
+func TestGetSkillHistory(t *testing.T) {
+	t.Run("should response history from repository", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/skills/go/history?limit=5&cursor=abc", nil)
+		c.Params = gin.Params{{Key: "key", Value: "go"}}
+		history := []AuditEntry{
+			{
+				Action:  UpdateNameAction,
+				Actor:   "alice",
+				EventID: "event-id",
+				Source:  AuditSource{Topic: "skills", Partition: 1, Offset: 42},
+				Changes: []FieldChange{{Field: "name", From: json.RawMessage(`"go"`), To: json.RawMessage(`"golang"`)}},
+			},
+		}
+		mock := &mockRepo{history: history, nextCursor: "next"}
+		handler := NewSkillHandler(mock)
+
+		want, _ := json.Marshal(response.Response{
+			Status: "success",
+			Data:   history,
+			Meta:   PageMeta{NextCursor: "next", Total: 1},
+		})
+
+		//act
+		handler.GetSkillHistory(c)
+		//assert
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, want, w.Body.Bytes())
+		assert.Equal(t, HistoryQuery{Limit: 5, Cursor: "abc"}, mock.historyQuery)
+	})
+	t.Run("should response bad request when limit is invalid", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/skills/go/history?limit=0", nil)
+		handler := NewSkillHandler(&mockRepo{})
+
+		//act
+		handler.GetSkillHistory(c)
+		//assert
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, problem(c, http.StatusBadRequest, errs.CodeInvalidQuery, "limit must be between 1 and 100"), w.Body.Bytes())
+	})
+}
+
+func TestWriteCaller(t *testing.T) {
+	t.Run("should attribute write to the caller", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		mock := &mockRepo{command: newCommand()}
+		handler := NewSkillHandler(mock)
+		c.Request, _ = http.NewRequest(http.MethodDelete, "/api/v1/skills/go", nil)
+		c.Request.Header.Set("User-Agent", "test-agent")
+		c.Request.RemoteAddr = "10.0.0.1:1234"
+		c.Set(middleware.ActorKey, "alice")
+		c.Set(middleware.RequestIDKey, "req-1")
+
+		//act
+		handler.DeleteSkill(c)
+		//assert
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Equal(t, Caller{
+			Actor:        "alice",
+			Metadata:     map[string]string{"request_id": "req-1", "ip": "10.0.0.1", "user_agent": "test-agent"},
+			TraceContext: map[string]string{},
+		}, mock.caller)
+	})
+	t.Run("should keep the trace context of the request apart from the audited metadata", func(t *testing.T) {
+		tracingtest.InMemory()
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		mock := &mockRepo{command: newCommand()}
+		handler := NewSkillHandler(mock)
+		member, _ := baggage.NewMember("tenant", "acme")
+		bag, _ := baggage.New(member)
+		ctx, span := tracing.Tracer().Start(baggage.ContextWithBaggage(context.Background(), bag), "DELETE /api/v1/skills/:key")
+		defer span.End()
+		c.Request, _ = http.NewRequestWithContext(ctx, http.MethodDelete, "/api/v1/skills/go", nil)
+
+		//act
+		handler.DeleteSkill(c)
+		//assert
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Equal(t, map[string]string{
+			"traceparent": "00-" + span.SpanContext().TraceID().String() + "-" + span.SpanContext().SpanID().String() + "-01",
+		}, mock.caller.TraceContext)
+		assert.NotContains(t, mock.caller.Metadata, "traceparent")
+		assert.NotContains(t, mock.caller.Metadata, "baggage")
+	})
+}
+
+func problem(c *gin.Context, status int, code errs.Code, detail string, fields ...errs.FieldError) []byte {
+	instance := ""
+	if c.Request != nil {
+		instance = c.Request.URL.Path
+	}
+	if len(fields) == 0 {
+		fields = nil
+	}
+	body, _ := json.Marshal(response.Problem{
+		Type:     response.ProblemType(code),
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: instance,
+		Code:     code,
+		Errors:   fields,
+	})
+	return body
 }
@@ -0,0 +1,269 @@
+package skill
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"gokafka/command"
+	"gokafka/errs"
+	"gokafka/middleware"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Caller is who made a write and from where. It is published with the event
+// and the consumer stores it in the skill_audit table.
+type Caller struct {
+	Actor    string
+	Metadata map[string]string
+	// TraceContext is kept apart from Metadata, it is stored with the outbox
+	// row only and is never audited.
+	TraceContext map[string]string
+}
+
+func callerFrom(ctx *gin.Context) Caller {
+	metadata := map[string]string{}
+	if id := ctx.GetString(middleware.RequestIDKey); id != "" {
+		metadata["request_id"] = id
+	}
+	if ip := ctx.ClientIP(); ip != "" {
+		metadata["ip"] = ip
+	}
+	if agent := ctx.Request.UserAgent(); agent != "" {
+		metadata["user_agent"] = agent
+	}
+	// Only the trace context is kept for the event published later, not the
+	// baggage the client may have sent.
+	traceContext := map[string]string{}
+	propagation.TraceContext{}.Inject(ctx.Request.Context(), propagation.MapCarrier(traceContext))
+	return Caller{Actor: ctx.GetString(middleware.ActorKey), Metadata: metadata, TraceContext: traceContext}
+}
+
+// AuditSource is the kafka message an audit entry was written from.
+type AuditSource struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+// FieldChange is one field of a skill before and after a write. From is
+// null when the skill was created and To is null when it was deleted.
+type FieldChange struct {
+	Field string          `json:"field"`
+	From  json.RawMessage `json:"from"`
+	To    json.RawMessage `json:"to"`
+}
+
+type AuditEntry struct {
+	Action SkillAction `json:"action"`
+	// Version is the skill version after the change, zero once deleted.
+	Version    int64             `json:"version"`
+	Actor      string            `json:"actor"`
+	EventID    string            `json:"event_id"`
+	CommandID  string            `json:"command_id,omitempty"`
+	Source     AuditSource       `json:"source"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Changes    []FieldChange     `json:"changes"`
+	OccurredAt time.Time         `json:"occurred_at"`
+	RecordedAt time.Time         `json:"recorded_at"`
+
+	seq int64
+}
+
+type HistoryQuery struct {
+	Limit  int
+	Cursor string
+}
+
+type HistoryPage struct {
+	Entries    []AuditEntry
+	NextCursor string
+	Total      int
+}
+
+// historyCursor is the position after the last entry of a history page.
+type historyCursor struct {
+	Seq int64 `json:"q"`
+}
+
+func encodeHistoryCursor(entry AuditEntry) string {
+	data, _ := json.Marshal(historyCursor{Seq: entry.seq})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeHistoryCursor(value string) (historyCursor, error) {
+	c := historyCursor{}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || json.Unmarshal(data, &c) != nil || c.Seq < 1 {
+		return historyCursor{}, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidCursor, "Invalid cursor")
+	}
+	return c, nil
+}
+
+// GetSkillHistory pages through the audit log of a skill, newest first. The
+// log outlives the skill, so a deleted key still has its history.
+func (r *skillRepo) GetSkillHistory(key string, query HistoryQuery) (*HistoryPage, error) {
+
+	if query.Limit <= 0 {
+		query.Limit = DefaultPageLimit
+	}
+
+	page := HistoryPage{Entries: []AuditEntry{}}
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM skill_audit WHERE skill_key=$1", key).Scan(&page.Total); err != nil {
+		return nil, errs.Internal("Can't count skill history", err)
+	}
+
+	where, args := " WHERE skill_key=$1", []any{key}
+	if query.Cursor != "" {
+		after, err := decodeHistoryCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		where, args = and(where, args, "seq < $2", after.Seq)
+	}
+	args = append(args, query.Limit+1)
+	selectQuery := "SELECT seq, action, version, actor, event_id, correlation_id, source_topic, source_partition, source_offset, metadata, diff, occurred_at, recorded_at FROM skill_audit" + where + " ORDER BY seq DESC LIMIT $" + strconv.Itoa(len(args))
+
+	records, err := r.db.Query(selectQuery, args...)
+	if err != nil {
+		return nil, errs.Internal("Can't read skill history", err)
+	}
+	defer records.Close()
+	for records.Next() {
+		entry := AuditEntry{}
+		var metadata, diff string
+		err := records.Scan(&entry.seq, &entry.Action, &entry.Version, &entry.Actor, &entry.EventID, &entry.CommandID, &entry.Source.Topic, &entry.Source.Partition, &entry.Source.Offset, &metadata, &diff, &entry.OccurredAt, &entry.RecordedAt)
+		if err != nil {
+			return nil, errs.Internal("Can't read skill history", err)
+		}
+		if err := json.Unmarshal([]byte(metadata), &entry.Metadata); err != nil {
+			return nil, errs.Internal("Can't read skill history", err)
+		}
+		if err := json.Unmarshal([]byte(diff), &entry.Changes); err != nil {
+			return nil, errs.Internal("Can't read skill history", err)
+		}
+		page.Entries = append(page.Entries, entry)
+	}
+	if err := records.Err(); err != nil {
+		return nil, errs.Internal("Can't read skill history", err)
+	}
+
+	if len(page.Entries) > query.Limit {
+		page.Entries = page.Entries[:query.Limit]
+		page.NextCursor = encodeHistoryCursor(page.Entries[len(page.Entries)-1])
+	}
+
+	return &page, nil
+}
+
+// AsOf is a point in the history of a skill, either a version or a time.
+type AsOf struct {
+	Version int64
+	Time    time.Time
+}
+
+// GetSkillAsOf rebuilds the skill as it was at asOf from its audit log.
+func (r *skillRepo) GetSkillAsOf(key string, asOf AsOf) (*Skill, error) {
+	skill, err := r.skillAt(key, asOf)
+	if err != nil {
+		return nil, err
+	}
+	if skill == nil {
+		return nil, errs.NewErrorWithCode(http.StatusNotFound, errs.CodeSkillNotFound, "Skill not found")
+	}
+	return skill, nil
+}
+
+// skillAt replays the audit log of a skill up to asOf and returns nil when the
+// skill did not exist then. A re-created skill goes on from the version of its
+// delete, so a version names one state across every life of the skill.
+func (r *skillRepo) skillAt(key string, asOf AsOf) (*Skill, error) {
+	query, args := "SELECT action, version, diff FROM skill_audit WHERE skill_key=$1", []any{key}
+	if asOf.Version > 0 {
+		query += " AND seq <= (SELECT MAX(seq) FROM skill_audit WHERE skill_key=$2 AND version=$3)"
+		args = append(args, key, asOf.Version)
+	} else {
+		query += " AND recorded_at <= $2"
+		args = append(args, asOf.Time.UTC())
+	}
+
+	records, err := r.db.Query(query+" ORDER BY seq", args...)
+	if err != nil {
+		return nil, errs.Internal("Can't read skill history", err)
+	}
+	defer records.Close()
+
+	var skill *Skill
+	for records.Next() {
+		var action SkillAction
+		var version int64
+		var diff string
+		if err := records.Scan(&action, &version, &diff); err != nil {
+			return nil, errs.Internal("Can't read skill history", err)
+		}
+		changes := []FieldChange{}
+		if err := json.Unmarshal([]byte(diff), &changes); err != nil {
+			return nil, errs.Internal("Can't read skill history", err)
+		}
+		if skill, err = replay(key, skill, action, version, changes); err != nil {
+			return nil, errs.Internal("Can't read skill history", err)
+		}
+	}
+	if err := records.Err(); err != nil {
+		return nil, errs.Internal("Can't read skill history", err)
+	}
+	return skill, nil
+}
+
+// replay applies one audit entry to skill, nil being a skill that does not
+// exist.
+func replay(key string, skill *Skill, action SkillAction, version int64, changes []FieldChange) (*Skill, error) {
+	if action == DeleteSkillAction {
+		return nil, nil
+	}
+	next := Skill{Key: key, Tags: []string{}}
+	if skill != nil {
+		next = *skill
+	}
+	for _, change := range changes {
+		var err error
+		switch change.Field {
+		case "name":
+			err = json.Unmarshal(change.To, &next.Name)
+		case "description":
+			err = json.Unmarshal(change.To, &next.Description)
+		case "logo":
+			err = json.Unmarshal(change.To, &next.Logo)
+		case "tags":
+			err = json.Unmarshal(change.To, &next.Tags)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	next.Version = version
+	return &next, nil
+}
+
+// RevertSkill publishes an ordinary update that puts the skill back the way it
+// was at version.
+func (r *skillRepo) RevertSkill(key string, version int64, expectedVersion int64) (*command.Command, error) {
+
+	if err := r.checkVersion(key, expectedVersion); err != nil {
+		return nil, err
+	}
+
+	target, err := r.skillAt(key, AsOf{Version: version})
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, errs.NewErrorWithCode(http.StatusNotFound, errs.CodeVersionNotFound, "Skill version not found")
+	}
+	target.Version = 0
+
+	return r.publish(UpdateSkillAction, key, expectedVersion, target)
+}
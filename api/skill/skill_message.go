@@ -1,21 +1,12 @@
 package skill
 
-type NameUpdateMessage struct {
-	Key  string
-	Name string
-}
-
-type DescriptionUpdateMessage struct {
-	Key         string
-	Description string
-}
-
-type LogoUpdateMessage struct {
-	Key  string
-	Logo string
-}
-
-type TagsUpdateMessage struct {
-	Key  string
-	Tags []string
-}
+import "skillevent"
+
+// Event payloads are defined once in the shared skillevent module.
+type (
+	NameUpdateMessage        = skillevent.NameUpdateMessage
+	DescriptionUpdateMessage = skillevent.DescriptionUpdateMessage
+	LogoUpdateMessage        = skillevent.LogoUpdateMessage
+	TagsUpdateMessage        = skillevent.TagsUpdateMessage
+	DeleteMessage            = skillevent.DeleteMessage
+)
@@ -1,48 +1,191 @@
 package skill
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"gokafka/metrics"
+	"gokafka/outbox"
 	"log"
-	"os"
+	"platform/tracing"
+	"skillevent"
+	"strconv"
+	"time"
 
 	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type SkillAction string
+type SkillAction = skillevent.Type
 
 const (
-	CreateSkillAction SkillAction = "create"
-	UpdateSkillAction SkillAction = "update"
-	DeleteSkillAction SkillAction = "delete"
-	UpdateNameAction  SkillAction = "update_name"
-	UpdateDescAction  SkillAction = "update_desc"
-	UpdateLogoAction  SkillAction = "update_logo"
-	UpdateTagsAction  SkillAction = "update_tags"
+	CreateSkillAction = skillevent.CreateSkill
+	UpdateSkillAction = skillevent.UpdateSkill
+	DeleteSkillAction = skillevent.DeleteSkill
+	UpdateNameAction  = skillevent.UpdateName
+	UpdateDescAction  = skillevent.UpdateDesc
+	UpdateLogoAction  = skillevent.UpdateLogo
+	UpdateTagsAction  = skillevent.UpdateTags
 )
 
 type skillProcuer struct {
 	producer sarama.SyncProducer
+	topic    string
 }
 
 type SkillProcuer interface {
-	PublishMessage(action SkillAction, payload interface{}) error
+	PublishMessage(key string, event skillevent.Envelope) error
 }
 
-func NewProducer(producer sarama.SyncProducer) skillProcuer {
-	return skillProcuer{producer: producer}
+// NewProducer publishes the skill events to topic.
+func NewProducer(producer sarama.SyncProducer, topic string) skillProcuer {
+	return skillProcuer{producer: producer, topic: topic}
 }
 
-func (p skillProcuer) PublishMessage(action SkillAction, payload interface{}) error {
+func (p skillProcuer) PublishMessage(key string, event skillevent.Envelope) error {
+	return p.publish(key, event, nil)
+}
 
-	objBytes, _ := json.Marshal(payload)
+func (p skillProcuer) publish(key string, event skillevent.Envelope, traceContext map[string]string) error {
+	msg, err := p.producerMessage(key, event)
+	if err != nil {
+		return err
+	}
+	span := p.startSpan(key, event, traceContext, msg)
+	defer span.End()
 
-	msg := &sarama.ProducerMessage{Topic: os.Getenv("TOPIC"), Key: sarama.StringEncoder(action), Value: sarama.ByteEncoder(objBytes)}
+	start := time.Now()
 	partition, offset, err := p.producer.SendMessage(msg)
+	metrics.PublishDuration.WithLabelValues("single").Observe(time.Since(start).Seconds())
 	if err != nil {
+		metrics.PublishErrors.Inc()
+		failSpan(span, err)
 		log.Printf("FAILED to send message: %s\n", err)
 		return err
 	} else {
+		metrics.PublishedMessages.Inc()
+		span.SetAttributes(semconv.MessagingDestinationPartitionID(strconv.Itoa(int(partition))), semconv.MessagingKafkaMessageOffset(int(offset)))
 		log.Printf("> message sent to partition %d at offset %d\n", partition, offset)
 		return err
 	}
 }
+
+// startSpan starts the producer span of msg as a child of the request that
+// wrote the event, whose trace context was stored with the outbox row, and
+// writes its own context into the message headers for the consumer to
+// continue.
+func (p skillProcuer) startSpan(key string, event skillevent.Envelope, traceContext map[string]string, msg *sarama.ProducerMessage) trace.Span {
+	parent := propagation.TraceContext{}.Extract(context.Background(), propagation.MapCarrier(traceContext))
+	ctx, span := tracing.Tracer().Start(parent, "publish "+p.topic,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypePublish,
+			semconv.MessagingDestinationName(p.topic),
+			semconv.MessagingKafkaMessageKey(key),
+			semconv.MessagingMessageID(event.ID),
+		),
+	)
+	tracing.Inject(ctx, tracing.ProducerHeaders{Msg: msg})
+	return span
+}
+
+func failSpan(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+func (p skillProcuer) producerMessage(key string, event skillevent.Envelope) (*sarama.ProducerMessage, error) {
+	objBytes, err := skillevent.Encode(event)
+	if err != nil {
+		log.Printf("FAILED to encode event: %s\n", err)
+		return nil, err
+	}
+
+	return &sarama.ProducerMessage{
+		Topic: p.topic,
+		Key:   sarama.StringEncoder(key),
+		Value: sarama.ByteEncoder(objBytes),
+	}, nil
+}
+
+// Publish lets the outbox relay send stored messages through the producer.
+// The skill key is the message key so all events of a skill share a partition.
+// The outbox row id doubles as the event id so a re-sent row is recognised
+// as a duplicate by the consumer, and the command id correlates the event
+// with the request that produced it. The actor and request metadata ride
+// along for the consumer's audit log, the trace context only in the headers.
+func (p skillProcuer) Publish(msg outbox.Message) error {
+	return p.publish(msg.Key, envelope(msg), msg.TraceContext)
+}
+
+// PublishBatch sends msgs with one SendMessages call and reports how many of
+// them, from the start, were delivered.
+func (p skillProcuer) PublishBatch(msgs []outbox.Message) (int, error) {
+	batch := make([]*sarama.ProducerMessage, len(msgs))
+	spans := make([]trace.Span, 0, len(msgs))
+	defer func() {
+		for _, span := range spans {
+			span.End()
+		}
+	}()
+	for i, msg := range msgs {
+		event := envelope(msg)
+		producerMsg, err := p.producerMessage(msg.Key, event)
+		if err != nil {
+			return i, err
+		}
+		producerMsg.Metadata = i
+		batch[i] = producerMsg
+		spans = append(spans, p.startSpan(msg.Key, event, msg.TraceContext, producerMsg))
+	}
+
+	start := time.Now()
+	err := p.producer.SendMessages(batch)
+	metrics.PublishDuration.WithLabelValues("batch").Observe(time.Since(start).Seconds())
+	if err == nil {
+		metrics.PublishedMessages.Add(float64(len(batch)))
+		log.Printf("> %d messages sent\n", len(batch))
+		return len(batch), nil
+	}
+	log.Printf("FAILED to send messages: %s\n", err)
+
+	var failed sarama.ProducerErrors
+	if !errors.As(err, &failed) {
+		metrics.PublishErrors.Add(float64(len(batch)))
+		for _, span := range spans {
+			failSpan(span, err)
+		}
+		return 0, err
+	}
+	metrics.PublishErrors.Add(float64(len(failed)))
+	metrics.PublishedMessages.Add(float64(len(batch) - len(failed)))
+	first := len(batch)
+	for _, e := range failed {
+		if i, ok := e.Msg.Metadata.(int); ok {
+			failSpan(spans[i], e.Err)
+			if i < first {
+				first = i
+			}
+		}
+	}
+	if first == len(batch) {
+		return 0, err
+	}
+	return first, failed[0].Err
+}
+
+func envelope(msg outbox.Message) skillevent.Envelope {
+	return skillevent.Envelope{
+		ID:              msg.ID,
+		Type:            SkillAction(msg.Action),
+		OccurredAt:      msg.CreatedAt,
+		Actor:           msg.Actor,
+		CorrelationID:   msg.CommandID,
+		ExpectedVersion: msg.ExpectedVersion,
+		Metadata:        msg.Metadata,
+		Payload:         msg.Payload,
+	}
+}
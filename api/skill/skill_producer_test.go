@@ -1,10 +1,21 @@
 package skill
 
 import (
+	"encoding/json"
 	"errors"
+	"gokafka/metrics"
+	"gokafka/outbox"
+	"platform/tracing"
+	"platform/tracing/tracingtest"
+	"skillevent"
 	"testing"
+	"time"
 
 	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type mockSyncProcuer struct {
@@ -12,15 +23,24 @@ type mockSyncProcuer struct {
 	offset    int64
 	err       error
 	wasCalled bool
+	msg       *sarama.ProducerMessage
+	msgs      []*sarama.ProducerMessage
+	failOn    int
 }
 
 func (m *mockSyncProcuer) SendMessage(msg *sarama.ProducerMessage) (partition int32, offset int64, err error) {
 	m.wasCalled = true
+	m.msg = msg
 	return m.partion, m.offset, m.err
 }
 
 func (m *mockSyncProcuer) SendMessages(msgs []*sarama.ProducerMessage) error {
-	return m.err
+	m.wasCalled = true
+	m.msgs = msgs
+	if m.err != nil && m.failOn < len(msgs) {
+		return sarama.ProducerErrors{{Msg: msgs[m.failOn], Err: m.err}}
+	}
+	return nil
 }
 
 func (m *mockSyncProcuer) Close() error {
@@ -64,19 +84,24 @@ func TestPublishMessage(t *testing.T) {
 			offset:  3453466,
 			err:     nil,
 		}
-		producer := NewProducer(mockSyncProcuer)
+		producer := NewProducer(mockSyncProcuer, "skills")
 
-		action := CreateSkillAction
-		payload := Skill{
+		payload, _ := json.Marshal(Skill{
 			Key:         "1",
 			Name:        "test",
 			Description: "test",
 			Logo:        "test",
 			Tags:        []string{"tag"},
+		})
+		event := skillevent.Envelope{
+			ID:            "event-id",
+			Type:          CreateSkillAction,
+			CorrelationID: "command-id",
+			Payload:       payload,
 		}
 
 		//act
-		err := producer.PublishMessage(action, payload)
+		err := producer.PublishMessage("1", event)
 
 		//assert
 		if err != nil {
@@ -86,6 +111,28 @@ func TestPublishMessage(t *testing.T) {
 		if !mockSyncProcuer.wasCalled {
 			t.Errorf("Expected mockSyncProducer to send message to call be not call")
 		}
+
+		assert.Equal(t, "skills", mockSyncProcuer.msg.Topic)
+		assert.Equal(t, sarama.StringEncoder("1"), mockSyncProcuer.msg.Key)
+		value, _ := mockSyncProcuer.msg.Value.Encode()
+		got, err := skillevent.Decode(value, "")
+		assert.NoError(t, err)
+		assert.Equal(t, "event-id", got.ID)
+		assert.Equal(t, "command-id", got.CorrelationID)
+		assert.Equal(t, skillevent.CurrentVersion, got.SchemaVersion)
+		assert.JSONEq(t, string(payload), string(got.Payload))
+	})
+	t.Run("should not send message when event has no type", func(t *testing.T) {
+		//arrange
+		mockSyncProcuer := &mockSyncProcuer{}
+		producer := NewProducer(mockSyncProcuer, "skills")
+
+		//act
+		err := producer.PublishMessage("1", skillevent.Envelope{ID: "event-id"})
+
+		//assert
+		assert.ErrorIs(t, err, skillevent.ErrMissingType)
+		assert.False(t, mockSyncProcuer.wasCalled)
 	})
 	t.Run("should return error when producer publish message unsuccessfully", func(t *testing.T) {
 		//arrange
@@ -94,21 +141,29 @@ func TestPublishMessage(t *testing.T) {
 			offset:  3453466,
 			err:     errors.New("error"),
 		}
-		producer := NewProducer(mockSyncProcuer)
+		producer := NewProducer(mockSyncProcuer, "skills")
 
-		action := CreateSkillAction
-		payload := Skill{
+		payload, _ := json.Marshal(Skill{
 			Key:         "1",
 			Name:        "test",
 			Description: "test",
 			Logo:        "test",
 			Tags:        []string{"tag"},
+		})
+		event := skillevent.Envelope{
+			ID:            "event-id",
+			Type:          CreateSkillAction,
+			CorrelationID: "command-id",
+			Payload:       payload,
 		}
 
+		errorsBefore := testutil.ToFloat64(metrics.PublishErrors)
+
 		//act
-		err := producer.PublishMessage(action, payload)
+		err := producer.PublishMessage("1", event)
 
 		//assert
+		assert.Equal(t, errorsBefore+1, testutil.ToFloat64(metrics.PublishErrors))
 		if err == nil {
 			t.Errorf("expected no error but got %v", err)
 		}
@@ -118,3 +173,169 @@ func TestPublishMessage(t *testing.T) {
 		}
 	})
 }
+
+func TestPublishOutboxMessage(t *testing.T) {
+	//arrange
+	mockSyncProcuer := &mockSyncProcuer{}
+	producer := NewProducer(mockSyncProcuer, "skills")
+
+	createdAt := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	msg := outbox.Message{
+		ID:        "outbox-id",
+		CommandID: "command-id",
+		Action:    string(UpdateNameAction),
+		Key:       "go",
+		Actor:     "alice",
+		Metadata:  map[string]string{"request_id": "req-1"},
+		Payload:   []byte(`{"Key":"go","Name":"golang"}`),
+		CreatedAt: createdAt,
+	}
+
+	//act
+	err := producer.Publish(msg)
+
+	//assert
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+	}
+
+	assert.Equal(t, sarama.StringEncoder("go"), mockSyncProcuer.msg.Key)
+	value, _ := mockSyncProcuer.msg.Value.Encode()
+	event, err := skillevent.Decode(value, "")
+	assert.NoError(t, err)
+	assert.Equal(t, skillevent.Envelope{
+		ID:            "outbox-id",
+		Type:          UpdateNameAction,
+		SchemaVersion: skillevent.CurrentVersion,
+		OccurredAt:    createdAt,
+		Actor:         "alice",
+		CorrelationID: "command-id",
+		Metadata:      map[string]string{"request_id": "req-1"},
+		Payload:       json.RawMessage(`{"Key":"go","Name":"golang"}`),
+	}, event)
+}
+
+func TestPublishOutboxBatch(t *testing.T) {
+	msgs := []outbox.Message{
+		{ID: "1", Action: string(CreateSkillAction), Key: "go", Payload: []byte(`{}`)},
+		{ID: "2", Action: string(UpdateNameAction), Key: "go", Payload: []byte(`{}`)},
+		{ID: "3", Action: string(DeleteSkillAction), Key: "rust", Payload: []byte(`{}`)},
+	}
+
+	t.Run("should send every message in one call", func(t *testing.T) {
+		//arrange
+		mockSyncProcuer := &mockSyncProcuer{}
+		producer := NewProducer(mockSyncProcuer, "skills")
+
+		//act
+		sent, err := producer.PublishBatch(msgs)
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, 3, sent)
+		assert.Len(t, mockSyncProcuer.msgs, 3)
+		assert.Equal(t, sarama.StringEncoder("rust"), mockSyncProcuer.msgs[2].Key)
+		value, _ := mockSyncProcuer.msgs[1].Value.Encode()
+		event, _ := skillevent.Decode(value, "")
+		assert.Equal(t, "2", event.ID)
+		assert.Equal(t, UpdateNameAction, event.Type)
+	})
+	t.Run("should report the messages delivered before the first failure", func(t *testing.T) {
+		//arrange
+		mockSyncProcuer := &mockSyncProcuer{err: errors.New("broker down"), failOn: 1}
+		producer := NewProducer(mockSyncProcuer, "skills")
+		errorsBefore := testutil.ToFloat64(metrics.PublishErrors)
+		publishedBefore := testutil.ToFloat64(metrics.PublishedMessages)
+
+		//act
+		sent, err := producer.PublishBatch(msgs)
+
+		//assert
+		assert.EqualError(t, err, "broker down")
+		assert.Equal(t, 1, sent)
+		assert.Equal(t, errorsBefore+1, testutil.ToFloat64(metrics.PublishErrors))
+		assert.Equal(t, publishedBefore+2, testutil.ToFloat64(metrics.PublishedMessages))
+	})
+}
+
+func TestPublishSameSkillToSamePartition(t *testing.T) {
+	//arrange
+	mockSyncProcuer := &mockSyncProcuer{}
+	producer := NewProducer(mockSyncProcuer, "skills")
+	partitioner := sarama.NewHashPartitioner("skills")
+	actions := []SkillAction{CreateSkillAction, UpdateNameAction, UpdateTagsAction, DeleteSkillAction}
+
+	//act
+	partitions := map[int32]bool{}
+	for _, action := range actions {
+		err := producer.Publish(outbox.Message{ID: string(action), Action: string(action), Key: "go", Payload: []byte(`{}`)})
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		partition, err := partitioner.Partition(mockSyncProcuer.msg, 12)
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		partitions[partition] = true
+	}
+
+	//assert
+	assert.Len(t, partitions, 1)
+}
+
+func TestPublishTracing(t *testing.T) {
+	exporter := tracingtest.InMemory()
+
+	t.Run("should continue the request trace and carry it in the headers", func(t *testing.T) {
+		//arrange
+		exporter.Reset()
+		mockSyncProcuer := &mockSyncProcuer{partion: 2, offset: 7}
+		producer := NewProducer(mockSyncProcuer, "skills")
+		msg := outbox.Message{
+			ID:           "outbox-id",
+			Action:       string(UpdateNameAction),
+			Key:          "go",
+			TraceContext: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+			Payload:      []byte(`{}`),
+		}
+
+		//act
+		err := producer.Publish(msg)
+
+		//assert
+		assert.NoError(t, err)
+		spans := exporter.GetSpans()
+		assert.Len(t, spans, 1)
+		assert.Equal(t, "publish skills", spans[0].Name)
+		assert.Equal(t, trace.SpanKindProducer, spans[0].SpanKind)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext.TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent.SpanID().String())
+		headers := tracing.ProducerHeaders{Msg: mockSyncProcuer.msg}
+		assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+spans[0].SpanContext.SpanID().String()+"-01", headers.Get("traceparent"))
+	})
+
+	t.Run("should mark the spans of the messages that failed in a batch", func(t *testing.T) {
+		//arrange
+		exporter.Reset()
+		mockSyncProcuer := &mockSyncProcuer{err: errors.New("broker down"), failOn: 1}
+		producer := NewProducer(mockSyncProcuer, "skills")
+		msgs := []outbox.Message{
+			{ID: "1", Action: string(CreateSkillAction), Key: "go", Payload: []byte(`{}`)},
+			{ID: "2", Action: string(UpdateNameAction), Key: "go", Payload: []byte(`{}`)},
+		}
+
+		//act
+		_, err := producer.PublishBatch(msgs)
+
+		//assert
+		assert.Error(t, err)
+		spans := exporter.GetSpans()
+		assert.Len(t, spans, 2)
+		assert.Equal(t, codes.Unset, spans[0].Status.Code)
+		assert.Equal(t, codes.Error, spans[1].Status.Code)
+		for i, span := range spans {
+			assert.NotEmpty(t, tracing.ProducerHeaders{Msg: mockSyncProcuer.msgs[i]}.Get("traceparent"))
+			assert.False(t, span.Parent.IsValid())
+		}
+	})
+}
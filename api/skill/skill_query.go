@@ -0,0 +1,74 @@
+package skill
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"gokafka/errs"
+	"net/http"
+)
+
+type SortField string
+
+const (
+	SortByKey  SortField = "key"
+	SortByName SortField = "name"
+)
+
+type TagMatch string
+
+const (
+	TagMatchAny TagMatch = "any"
+	TagMatchAll TagMatch = "all"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+type SkillQuery struct {
+	Limit      int
+	Cursor     string
+	Tags       []string
+	TagMatch   TagMatch
+	NamePrefix string
+	Keys       []string
+	Sort       SortField
+}
+
+type SkillPage struct {
+	Skills     []Skill
+	NextCursor string
+	Total      int
+}
+
+type PageMeta struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      int    `json:"total"`
+}
+
+// cursor is the position after the last skill of a page. It remembers the
+// sort it was made for, since a key cursor means nothing to a name sort.
+type cursor struct {
+	Sort SortField `json:"s"`
+	Key  string    `json:"k"`
+	Name string    `json:"n,omitempty"`
+}
+
+func encodeCursor(sort SortField, skill Skill) string {
+	c := cursor{Sort: sort, Key: skill.Key}
+	if sort == SortByName {
+		c.Name = skill.Name
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string, sort SortField) (cursor, error) {
+	c := cursor{}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || json.Unmarshal(data, &c) != nil || c.Sort != sort {
+		return cursor{}, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidCursor, "Invalid cursor")
+	}
+	return c, nil
+}
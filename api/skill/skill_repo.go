@@ -1,200 +1,434 @@
 package skill
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"gokafka/command"
 	"gokafka/errs"
+	"gokafka/outbox"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/lib/pq"
 )
 
 type skillRepo struct {
 	db       *sql.DB
-	producer SkillProcuer
+	postgres bool
+	caller   Caller
+	replies  command.Replies
 }
 
 type SkillRepo interface {
 	GetSkillByKey(key string) (*Skill, error)
-	GetSkills() ([]Skill, error)
-	CreateSkill(skill Skill) (*Skill, error)
-	UpdateSkill(key string, skill Skill) (*Skill, error)
-	UpdateSkillNameByKey(key string, name string) (*Skill, error)
-	UpdateSkillDescriptionByKey(key string, description string) (*Skill, error)
-	UpdateSkillLogoByKey(key string, logo string) (*Skill, error)
-	UpdateSkillTagsByKey(key string, tags []string) (*Skill, error)
-	DeleteSkillByKey(key string) error
+	GetSkills(query SkillQuery) (*SkillPage, error)
+	SearchSkills(q string, limit int) ([]Skill, error)
+	CreateSkill(skill Skill) (*command.Command, error)
+	UpdateSkill(key string, skill Skill, expectedVersion int64) (*command.Command, error)
+	UpdateSkillNameByKey(key string, name string, expectedVersion int64) (*command.Command, error)
+	UpdateSkillDescriptionByKey(key string, description string, expectedVersion int64) (*command.Command, error)
+	UpdateSkillLogoByKey(key string, logo string, expectedVersion int64) (*command.Command, error)
+	UpdateSkillTagsByKey(key string, tags []string, expectedVersion int64) (*command.Command, error)
+	DeleteSkillByKey(key string, expectedVersion int64) (*command.Command, error)
+	WaitForCommand(ctx context.Context, id string) (*command.Command, error)
+	GetSkillHistory(key string, query HistoryQuery) (*HistoryPage, error)
+	GetSkillAsOf(key string, asOf AsOf) (*Skill, error)
+	RevertSkill(key string, version int64, expectedVersion int64) (*command.Command, error)
+	ImportSkills(skills []Skill) ([]*command.Command, error)
+	ExistingKeys(keys []string) (map[string]bool, error)
+	ExportSkills(fn func(Skill) error) error
+	SkillVersion(key string) (version int64, exists bool, err error)
+	PublishBatch(mutations []Mutation) ([]*command.Command, error)
+	WithCaller(caller Caller) SkillRepo
 }
 
 func ScanSkill(rows *sql.Row, skill *Skill) error {
-	err := rows.Scan(&skill.Key, &skill.Name, &skill.Description, &skill.Logo, pq.Array(&skill.Tags))
+	err := rows.Scan(&skill.Key, &skill.Name, &skill.Description, &skill.Logo, pq.Array(&skill.Tags), &skill.Version)
 	return err
 }
 
-func NewSkillRepo(db *sql.DB, producer SkillProcuer) *skillRepo {
-	return &skillRepo{db: db, producer: producer}
+func NewSkillRepo(db *sql.DB) *skillRepo {
+	_, postgres := db.Driver().(*pq.Driver)
+	return &skillRepo{db: db, postgres: postgres}
+}
+
+// WithReplies returns a copy of the repo that waits for commands on replies
+// instead of polling.
+func (r *skillRepo) WithReplies(replies command.Replies) *skillRepo {
+	repo := *r
+	repo.replies = replies
+	return &repo
+}
+
+// WithCaller returns a copy of the repo whose writes are attributed to caller.
+func (r *skillRepo) WithCaller(caller Caller) SkillRepo {
+	repo := *r
+	repo.caller = caller
+	return &repo
 }
 
 func (r *skillRepo) GetSkillByKey(key string) (*Skill, error) {
 	skill := Skill{}
-	query := "SELECT key, name, description, logo, tags FROM skill WHERE key=$1"
+	query := "SELECT key, name, description, logo, tags, version FROM skill WHERE key=$1"
 	record := r.db.QueryRow(query, key)
 	err := ScanSkill(record, &skill)
+	if err == sql.ErrNoRows {
+		return &Skill{}, errs.NewErrorWithCode(http.StatusNotFound, errs.CodeSkillNotFound, "Skill not found")
+	}
 	if err != nil {
-		return &Skill{}, errs.NewError(http.StatusNotFound, "Skill not found")
+		return &Skill{}, errs.Internal("Can't read skill", err)
 	}
 	return &skill, nil
 }
 
-func (r *skillRepo) GetSkills() ([]Skill, error) {
+func (r *skillRepo) GetSkills(query SkillQuery) (*SkillPage, error) {
+
+	if query.Limit <= 0 {
+		query.Limit = DefaultPageLimit
+	}
+	if query.Sort == "" {
+		query.Sort = SortByKey
+	}
+
+	where, args := r.filter(query)
+
+	var err error
+	page := SkillPage{}
+	count := "SELECT COUNT(*) FROM skill" + where
+	if err := r.db.QueryRow(count, args...).Scan(&page.Total); err != nil {
+		return nil, errs.Internal("Can't count skills", err)
+	}
+
+	if query.Cursor != "" {
+		after, err := decodeCursor(query.Cursor, query.Sort)
+		if err != nil {
+			return nil, err
+		}
+		where, args = and(where, args, after.clause(len(args)), after.args()...)
+	}
+
+	order := " ORDER BY key"
+	if query.Sort == SortByName {
+		order = " ORDER BY name, key"
+	}
+	// One extra row tells whether there is a next page.
+	args = append(args, query.Limit+1)
+	selectQuery := "SELECT key, name, description, logo, tags, version FROM skill" + where + order + " LIMIT $" + strconv.Itoa(len(args))
+
+	page.Skills, err = r.querySkills(selectQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(page.Skills) > query.Limit {
+		page.Skills = page.Skills[:query.Limit]
+		page.NextCursor = encodeCursor(query.Sort, page.Skills[len(page.Skills)-1])
+	}
+
+	return &page, nil
+}
+
+func (r *skillRepo) SearchSkills(q string, limit int) ([]Skill, error) {
+
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
 
+	if !r.postgres {
+		skills, err := r.querySkills("SELECT key, name, description, logo, tags, version FROM skill")
+		if err != nil {
+			return nil, err
+		}
+		return rankSkills(skills, q, limit), nil
+	}
+
+	return r.querySkills(searchQuery, q, limit)
+}
+
+func (r *skillRepo) querySkills(query string, args ...any) ([]Skill, error) {
 	skills := []Skill{}
-	query := "SELECT key, name, description, logo, tags FROM skill"
-	records, err := r.db.Query(query)
+	records, err := r.db.Query(query, args...)
 	if err != nil {
-		return []Skill{}, errs.NewError(http.StatusInternalServerError, err.Error())
+		return nil, errs.Internal("Can't read skills", err)
 	}
+	defer records.Close()
 	for records.Next() {
 		skill := Skill{}
-		err := records.Scan(&skill.Key, &skill.Name, &skill.Description, &skill.Logo, pq.Array(&skill.Tags))
+		err := records.Scan(&skill.Key, &skill.Name, &skill.Description, &skill.Logo, pq.Array(&skill.Tags), &skill.Version)
 		if err != nil {
-			return []Skill{}, errs.NewError(http.StatusInternalServerError, err.Error())
+			return nil, errs.Internal("Can't read skills", err)
 		}
 		skills = append(skills, skill)
 	}
-
+	if err := records.Err(); err != nil {
+		return nil, errs.Internal("Can't read skills", err)
+	}
 	return skills, nil
 }
 
-func (r *skillRepo) CreateSkill(skill Skill) (*Skill, error) {
+// filter builds the WHERE clause shared by the page and its total.
+func (r *skillRepo) filter(query SkillQuery) (string, []any) {
+	where, args := "", []any{}
 
-	if err := r.producer.PublishMessage(CreateSkillAction, skill); err != nil {
-		return nil, errs.NewError(http.StatusInternalServerError, err.Error())
+	if len(query.Keys) > 0 {
+		placeholders := make([]string, len(query.Keys))
+		for i, key := range query.Keys {
+			args = append(args, key)
+			placeholders[i] = "$" + strconv.Itoa(len(args))
+		}
+		where, args = and(where, args, "key IN ("+strings.Join(placeholders, ", ")+")")
 	}
 
-	return &skill, nil
+	if query.NamePrefix != "" {
+		prefix := likeEscaper.Replace(strings.ToLower(query.NamePrefix)) + "%"
+		where, args = and(where, args, "LOWER(name) LIKE $"+strconv.Itoa(len(args)+1)+" ESCAPE '\\'", prefix)
+	}
+
+	if len(query.Tags) > 0 {
+		where, args = and(where, args, r.tagClause(query.Tags, query.TagMatch, len(args)), r.tagArgs(query.Tags)...)
+	}
+
+	return where, args
 }
 
-func (r *skillRepo) UpdateSkill(key string, skill Skill) (*Skill, error) {
+// tagClause uses the postgres array operators. Other databases, the sqlite
+// test database, keep tags as the '{a,b}' text pq writes, so each tag is
+// matched as a whole element of that text instead, in the quoted form pq
+// writes or, when it needs no quotes, bare. A comma inside a quoted tag is
+// then never taken for a separator.
+func (r *skillRepo) tagClause(tags []string, match TagMatch, offset int) string {
+	if r.postgres {
+		if match == TagMatchAll {
+			return "tags @> $" + strconv.Itoa(offset+1)
+		}
+		return "tags && $" + strconv.Itoa(offset+1)
+	}
 
-	if skill.Key != key {
-		return nil, errs.NewError(http.StatusBadRequest, "Key does not match")
+	elements := "(',' || TRIM(tags, '{}') || ',')"
+	clauses := make([]string, len(tags))
+	for i := range tags {
+		quoted, bare := "$"+strconv.Itoa(offset+2*i+1), "$"+strconv.Itoa(offset+2*i+2)
+		clauses[i] = "(" + elements + " LIKE " + quoted + " ESCAPE '\\' OR " + elements + " LIKE " + bare + " ESCAPE '\\')"
+	}
+	if match == TagMatchAll {
+		return "(" + strings.Join(clauses, " AND ") + ")"
 	}
+	return "(" + strings.Join(clauses, " OR ") + ")"
+}
 
-	if err := r.producer.PublishMessage(UpdateSkillAction, skill); err != nil {
-		return nil, errs.NewError(http.StatusInternalServerError, err.Error())
+func (r *skillRepo) tagArgs(tags []string) []any {
+	if r.postgres {
+		return []any{pq.Array(tags)}
+	}
+	args := make([]any, 0, 2*len(tags))
+	for _, tag := range tags {
+		quoted := "%," + likeEscaper.Replace(arrayQuote(tag)) + ",%"
+		bare := quoted
+		if !needsArrayQuotes(tag) {
+			bare = "%," + likeEscaper.Replace(tag) + ",%"
+		}
+		args = append(args, quoted, bare)
 	}
+	return args
+}
 
-	return &skill, nil
+func (c cursor) clause(offset int) string {
+	if c.Sort == SortByName {
+		name, key := "$"+strconv.Itoa(offset+1), "$"+strconv.Itoa(offset+2)
+		return "(name > " + name + " OR (name = " + name + " AND key > " + key + "))"
+	}
+	return "key > $" + strconv.Itoa(offset+1)
+}
+
+func (c cursor) args() []any {
+	if c.Sort == SortByName {
+		return []any{c.Name, c.Key}
+	}
+	return []any{c.Key}
 }
 
-func (r *skillRepo) UpdateSkillNameByKey(key string, name string) (*Skill, error) {
+var likeEscaper = strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
 
-	nameUpdateMessage := NameUpdateMessage{
-		Key:  key,
-		Name: name,
+var arrayEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// arrayQuote is tag as a quoted element of a postgres array literal.
+func arrayQuote(tag string) string {
+	return `"` + arrayEscaper.Replace(tag) + `"`
+}
+
+// needsArrayQuotes tells whether tag can only be written quoted in a
+// postgres array literal.
+func needsArrayQuotes(tag string) bool {
+	return tag == "" || strings.EqualFold(tag, "null") || strings.ContainsAny(tag, "{},\"\\ \t\n\r\v\f")
+}
+
+func and(where string, args []any, clause string, clauseArgs ...any) (string, []any) {
+	if where == "" {
+		where = " WHERE " + clause
+	} else {
+		where += " AND " + clause
 	}
+	return where, append(args, clauseArgs...)
+}
 
-	err := r.producer.PublishMessage(UpdateNameAction, nameUpdateMessage)
+// publish records a pending command and its message in the outbox within one
+// transaction. The outbox relay sends the message to kafka and the consumer
+// later moves the command to applied or failed. The caller set with
+// WithCaller is stored with the message for the audit log.
+func (r *skillRepo) publish(action SkillAction, key string, expectedVersion int64, payload interface{}) (*command.Command, error) {
 
+	tx, err := r.db.Begin()
 	if err != nil {
-		return nil, errs.NewError(http.StatusInternalServerError, err.Error())
+		return nil, errs.Internal("Can't publish skill event", err)
 	}
+	defer tx.Rollback()
 
-	updateSkill, err := r.GetSkillByKey(key)
+	cmd, err := r.enqueue(tx, action, key, expectedVersion, payload)
 	if err != nil {
-		return nil, errs.NewError(http.StatusInternalServerError, err.Error())
+		return nil, err
 	}
 
-	updateSkill.Name = name
+	if err := tx.Commit(); err != nil {
+		return nil, errs.Internal("Can't publish skill event", err)
+	}
 
-	return updateSkill, nil
+	return cmd, nil
 }
 
-func (r *skillRepo) UpdateSkillDescriptionByKey(key string, description string) (*Skill, error) {
+// enqueue writes one command and its outbox message in tx.
+func (r *skillRepo) enqueue(tx *sql.Tx, action SkillAction, key string, expectedVersion int64, payload interface{}) (*command.Command, error) {
 
-	descriptionUpdateMessage := DescriptionUpdateMessage{
-		Key:         key,
-		Description: description,
+	objBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errs.Internal("Can't encode skill event", err)
 	}
 
-	err := r.producer.PublishMessage(UpdateDescAction, descriptionUpdateMessage)
+	cmd, err := command.NewCommandRepo(tx).CreateCommand(string(action), key)
+	if err != nil {
+		return nil, err
+	}
 
+	_, err = outbox.NewOutboxRepo(tx).Enqueue(outbox.Message{
+		CommandID:       cmd.ID,
+		Action:          string(action),
+		Key:             key,
+		ExpectedVersion: expectedVersion,
+		Actor:           r.caller.Actor,
+		Metadata:        r.caller.Metadata,
+		TraceContext:    r.caller.TraceContext,
+		Payload:         objBytes,
+	})
 	if err != nil {
-		return nil, errs.NewError(http.StatusInternalServerError, err.Error())
+		return nil, errs.Internal("Can't publish skill event", err)
 	}
 
-	updateSkill, err := r.GetSkillByKey(key)
+	return cmd, nil
+}
 
+// checkVersion makes sure the skill exists and, when expectedVersion is set,
+// that it is still at that version. The consumer checks the version again when
+// the event is applied since another write can land in between.
+func (r *skillRepo) checkVersion(key string, expectedVersion int64) error {
+	skill, err := r.GetSkillByKey(key)
 	if err != nil {
-		return nil, errs.NewError(http.StatusInternalServerError, err.Error())
+		return err
 	}
+	if expectedVersion != 0 && skill.Version != expectedVersion {
+		return errs.NewErrorWithCode(http.StatusPreconditionFailed, errs.CodeVersionMismatch, "Skill version does not match")
+	}
+	return nil
+}
 
-	updateSkill.Description = description
-
-	return updateSkill, nil
+func (r *skillRepo) CreateSkill(skill Skill) (*command.Command, error) {
+	return r.publish(CreateSkillAction, skill.Key, 0, skill)
 }
 
-func (r *skillRepo) UpdateSkillLogoByKey(key string, logo string) (*Skill, error) {
+func (r *skillRepo) UpdateSkill(key string, skill Skill, expectedVersion int64) (*command.Command, error) {
 
-	logoUpdateMessage := LogoUpdateMessage{
-		Key:  key,
-		Logo: logo,
+	if skill.Key != key {
+		return nil, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeKeyMismatch, "Key does not match")
 	}
 
-	err := r.producer.PublishMessage(UpdateLogoAction, logoUpdateMessage)
-
-	if err != nil {
-		return nil, errs.NewError(http.StatusInternalServerError, err.Error())
+	if err := r.checkVersion(key, expectedVersion); err != nil {
+		return nil, err
 	}
 
-	updateSkill, err := r.GetSkillByKey(key)
+	return r.publish(UpdateSkillAction, key, expectedVersion, skill)
+}
 
-	if err != nil {
-		return nil, errs.NewError(http.StatusInternalServerError, err.Error())
+func (r *skillRepo) UpdateSkillNameByKey(key string, name string, expectedVersion int64) (*command.Command, error) {
+
+	if err := r.checkVersion(key, expectedVersion); err != nil {
+		return nil, err
 	}
 
-	updateSkill.Logo = logo
+	nameUpdateMessage := NameUpdateMessage{
+		Key:  key,
+		Name: name,
+	}
 
-	return updateSkill, nil
+	return r.publish(UpdateNameAction, key, expectedVersion, nameUpdateMessage)
 }
 
-func (r *skillRepo) UpdateSkillTagsByKey(key string, tags []string) (*Skill, error) {
+func (r *skillRepo) UpdateSkillDescriptionByKey(key string, description string, expectedVersion int64) (*command.Command, error) {
 
-	tagsUpdateMessage := TagsUpdateMessage{
-		Key:  key,
-		Tags: tags,
+	if err := r.checkVersion(key, expectedVersion); err != nil {
+		return nil, err
 	}
-	err := r.producer.PublishMessage(UpdateTagsAction, tagsUpdateMessage)
 
-	if err != nil {
-		return nil, errs.NewError(http.StatusInternalServerError, err.Error())
+	descriptionUpdateMessage := DescriptionUpdateMessage{
+		Key:         key,
+		Description: description,
 	}
 
-	updateSkill, err := r.GetSkillByKey(key)
+	return r.publish(UpdateDescAction, key, expectedVersion, descriptionUpdateMessage)
+}
 
-	if err != nil {
-		return nil, errs.NewError(http.StatusInternalServerError, err.Error())
+func (r *skillRepo) UpdateSkillLogoByKey(key string, logo string, expectedVersion int64) (*command.Command, error) {
+
+	if err := r.checkVersion(key, expectedVersion); err != nil {
+		return nil, err
 	}
 
-	updateSkill.Tags = tags
+	logoUpdateMessage := LogoUpdateMessage{
+		Key:  key,
+		Logo: logo,
+	}
 
-	return updateSkill, nil
+	return r.publish(UpdateLogoAction, key, expectedVersion, logoUpdateMessage)
 }
 
-func (r *skillRepo) DeleteSkillByKey(key string) error {
-	query := "DELETE FROM skill WHERE key=$1"
-	result, err := r.db.Exec(query, key)
-	if err != nil {
-		return errs.NewError(http.StatusInternalServerError, "not be able to delete skill")
+func (r *skillRepo) UpdateSkillTagsByKey(key string, tags []string, expectedVersion int64) (*command.Command, error) {
+
+	if err := r.checkVersion(key, expectedVersion); err != nil {
+		return nil, err
 	}
 
-	resultRows, err := result.RowsAffected()
-	if err != nil {
-		return errs.NewError(http.StatusInternalServerError, "not be able to delete skill")
+	tagsUpdateMessage := TagsUpdateMessage{
+		Key:  key,
+		Tags: tags,
+	}
+
+	return r.publish(UpdateTagsAction, key, expectedVersion, tagsUpdateMessage)
+}
+
+func (r *skillRepo) DeleteSkillByKey(key string, expectedVersion int64) (*command.Command, error) {
+
+	if err := r.checkVersion(key, expectedVersion); err != nil {
+		return nil, err
 	}
-	if resultRows == 0 {
-		return errs.NewError(http.StatusInternalServerError, "not be able to delete skill")
+
+	deleteMessage := DeleteMessage{
+		Key: key,
 	}
 
-	return nil
+	return r.publish(DeleteSkillAction, key, expectedVersion, deleteMessage)
+}
+
+// WaitForCommand blocks until the consumer settles the command, see
+// command.Wait.
+func (r *skillRepo) WaitForCommand(ctx context.Context, id string) (*command.Command, error) {
+	return command.Wait(ctx, command.NewCommandRepo(r.db), id, r.replies)
 }
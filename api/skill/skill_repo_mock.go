@@ -1,36 +1,157 @@
 package skill
 
+import (
+	"context"
+	"gokafka/command"
+	"strconv"
+)
+
 type mockRepo struct {
 	SkillRepo
-	err    error
-	skill  Skill
-	skills []Skill
+	err     error
+	skill   Skill
+	skills  []Skill
+	command command.Command
+
+	query      SkillQuery
+	search     string
+	published  Skill
+	nextCursor string
+
+	expectedVersion int64
+
+	settled *command.Command
+	waitErr error
+	waited  bool
+
+	asOf          AsOf
+	revertVersion int64
+
+	imported    [][]Skill
+	importErr   error
+	existingErr error
+
+	mutations  [][]Mutation
+	checkErr   map[string]error
+	versions   map[string]int64
+	tombstones map[string]int64
+	publishErr error
+
+	caller       Caller
+	history      []AuditEntry
+	historyQuery HistoryQuery
 }
 
 func (m *mockRepo) GetSkillByKey(key string) (*Skill, error) {
 	return &m.skill, m.err
 }
-func (m *mockRepo) GetSkills() ([]Skill, error) {
+func (m *mockRepo) GetSkills(query SkillQuery) (*SkillPage, error) {
+	m.query = query
+	return &SkillPage{Skills: m.skills, NextCursor: m.nextCursor, Total: len(m.skills)}, m.err
+}
+func (m *mockRepo) SearchSkills(q string, limit int) ([]Skill, error) {
+	m.search = q
+	m.query.Limit = limit
 	return m.skills, m.err
 }
-func (m *mockRepo) CreateSkill(skill Skill) (*Skill, error) {
-	return &m.skill, m.err
+func (m *mockRepo) CreateSkill(skill Skill) (*command.Command, error) {
+	m.published = skill
+	return &m.command, m.err
 }
-func (m *mockRepo) UpdateSkill(key string, skill Skill) (*Skill, error) {
-	return &m.skill, m.err
+func (m *mockRepo) UpdateSkill(key string, skill Skill, expectedVersion int64) (*command.Command, error) {
+	m.expectedVersion = expectedVersion
+	return &m.command, m.err
 }
-func (m *mockRepo) UpdateSkillNameByKey(key string, name string) (*Skill, error) {
-	return &m.skill, m.err
+func (m *mockRepo) UpdateSkillNameByKey(key string, name string, expectedVersion int64) (*command.Command, error) {
+	m.expectedVersion = expectedVersion
+	return &m.command, m.err
 }
-func (m *mockRepo) UpdateSkillDescriptionByKey(key string, description string) (*Skill, error) {
-	return &m.skill, m.err
+func (m *mockRepo) UpdateSkillDescriptionByKey(key string, description string, expectedVersion int64) (*command.Command, error) {
+	m.expectedVersion = expectedVersion
+	return &m.command, m.err
 }
-func (m *mockRepo) UpdateSkillLogoByKey(key string, logo string) (*Skill, error) {
-	return &m.skill, m.err
+func (m *mockRepo) UpdateSkillLogoByKey(key string, logo string, expectedVersion int64) (*command.Command, error) {
+	m.expectedVersion = expectedVersion
+	return &m.command, m.err
+}
+func (m *mockRepo) UpdateSkillTagsByKey(key string, tags []string, expectedVersion int64) (*command.Command, error) {
+	m.published = Skill{Key: key, Tags: tags}
+	m.expectedVersion = expectedVersion
+	return &m.command, m.err
+}
+func (m *mockRepo) DeleteSkillByKey(key string, expectedVersion int64) (*command.Command, error) {
+	m.expectedVersion = expectedVersion
+	return &m.command, m.err
+}
+func (m *mockRepo) WaitForCommand(ctx context.Context, id string) (*command.Command, error) {
+	m.waited = true
+	if m.settled == nil {
+		return &m.command, m.waitErr
+	}
+	return m.settled, m.waitErr
+}
+func (m *mockRepo) GetSkillHistory(key string, query HistoryQuery) (*HistoryPage, error) {
+	m.historyQuery = query
+	return &HistoryPage{Entries: m.history, NextCursor: m.nextCursor, Total: len(m.history)}, m.err
 }
-func (m *mockRepo) UpdateSkillTagsByKey(key string, tags []string) (*Skill, error) {
+func (m *mockRepo) WithCaller(caller Caller) SkillRepo {
+	m.caller = caller
+	return m
+}
+func (m *mockRepo) GetSkillAsOf(key string, asOf AsOf) (*Skill, error) {
+	m.asOf = asOf
 	return &m.skill, m.err
 }
-func (m *mockRepo) DeleteSkillByKey(key string) error {
+func (m *mockRepo) RevertSkill(key string, version int64, expectedVersion int64) (*command.Command, error) {
+	m.revertVersion = version
+	m.expectedVersion = expectedVersion
+	return &m.command, m.err
+}
+func (m *mockRepo) ImportSkills(skills []Skill) ([]*command.Command, error) {
+	m.imported = append(m.imported, append([]Skill{}, skills...))
+	if m.importErr != nil {
+		return nil, m.importErr
+	}
+	cmds := make([]*command.Command, len(skills))
+	for i, skill := range skills {
+		cmds[i] = &command.Command{ID: skill.Key, Action: string(CreateSkillAction), Key: skill.Key, Status: command.StatusPending}
+	}
+	return cmds, nil
+}
+func (m *mockRepo) ExistingKeys(keys []string) (map[string]bool, error) {
+	existing := map[string]bool{}
+	for _, key := range keys {
+		if _, ok := m.versions[key]; ok {
+			existing[key] = true
+		}
+	}
+	return existing, m.existingErr
+}
+func (m *mockRepo) ExportSkills(fn func(Skill) error) error {
+	for _, skill := range m.skills {
+		if err := fn(skill); err != nil {
+			return err
+		}
+	}
 	return m.err
 }
+func (m *mockRepo) SkillVersion(key string) (int64, bool, error) {
+	if err := m.checkErr[key]; err != nil {
+		return 0, false, err
+	}
+	if version, ok := m.versions[key]; ok {
+		return version, true, nil
+	}
+	return m.tombstones[key], false, nil
+}
+func (m *mockRepo) PublishBatch(mutations []Mutation) ([]*command.Command, error) {
+	m.mutations = append(m.mutations, mutations)
+	if m.publishErr != nil {
+		return nil, m.publishErr
+	}
+	cmds := make([]*command.Command, len(mutations))
+	for i, mutation := range mutations {
+		cmds[i] = &command.Command{ID: strconv.Itoa(i), Action: string(mutation.Action), Key: mutation.Key, Status: command.StatusPending}
+	}
+	return cmds, nil
+}
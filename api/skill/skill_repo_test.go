@@ -3,8 +3,13 @@ package skill_test
 import (
 	"database/sql"
 	"errors"
+	"gokafka/command"
+	"gokafka/errs"
 	"gokafka/skill"
+	"net/http"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	_ "modernc.org/sqlite"
@@ -18,19 +23,90 @@ func newMockDB() *sql.DB {
 		name TEXT NOT NULL DEFAULT '',
 		description TEXT NOT NULL DEFAULT '',
 		logo TEXT NOT NULL DEFAULT '',
-		tags TEXT [] NOT NULL DEFAULT '{}'
+		tags TEXT [] NOT NULL DEFAULT '{}',
+		version INTEGER NOT NULL DEFAULT 1
+	);
+		CREATE TABLE IF NOT EXISTS command (
+		id TEXT PRIMARY KEY,
+		action TEXT NOT NULL,
+		skill_key TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);
+		CREATE TABLE IF NOT EXISTS outbox (
+		seq INTEGER PRIMARY KEY AUTOINCREMENT,
+		id TEXT NOT NULL UNIQUE,
+		command_id TEXT NOT NULL,
+		action TEXT NOT NULL,
+		skill_key TEXT NOT NULL,
+		expected_version BIGINT NOT NULL DEFAULT 0,
+		actor TEXT NOT NULL DEFAULT '',
+		metadata TEXT NOT NULL DEFAULT '{}',
+		trace_context TEXT NOT NULL DEFAULT '{}',
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		sent_at TIMESTAMP
+	);
+		CREATE TABLE IF NOT EXISTS skill_tombstone (
+		key TEXT PRIMARY KEY,
+		version INTEGER NOT NULL
+	);
+		CREATE TABLE IF NOT EXISTS skill_audit (
+		seq INTEGER PRIMARY KEY AUTOINCREMENT,
+		skill_key TEXT NOT NULL,
+		action TEXT NOT NULL,
+		version INTEGER NOT NULL DEFAULT 0,
+		actor TEXT NOT NULL DEFAULT '',
+		event_id TEXT NOT NULL,
+		correlation_id TEXT NOT NULL DEFAULT '',
+		source_topic TEXT NOT NULL,
+		source_partition INTEGER NOT NULL,
+		source_offset INTEGER NOT NULL,
+		metadata TEXT NOT NULL DEFAULT '{}',
+		diff TEXT NOT NULL,
+		occurred_at TIMESTAMP NOT NULL,
+		recorded_at TIMESTAMP NOT NULL
 	);
 	`
 	db.Exec(q)
 	return db
 }
 
-type MockProducer struct {
-	err error
+func getCommandStatus(db *sql.DB, id string) (status string, message string) {
+	db.QueryRow("SELECT status, error FROM command WHERE id = $1", id).Scan(&status, &message)
+	return status, message
+}
+
+func getOutboxMessage(db *sql.DB, commandID string) (action string, payload string) {
+	db.QueryRow("SELECT action, payload FROM outbox WHERE command_id = $1", commandID).Scan(&action, &payload)
+	return action, payload
+}
+
+func getOutboxCaller(db *sql.DB, commandID string) (actor string, metadata string) {
+	db.QueryRow("SELECT actor, metadata FROM outbox WHERE command_id = $1", commandID).Scan(&actor, &metadata)
+	return actor, metadata
+}
+
+func addAudit(db *sql.DB, key string, offset int64, actor string) {
+	now := time.Now().UTC()
+	db.Exec("INSERT INTO skill_audit (skill_key, action, actor, event_id, source_topic, source_partition, source_offset, metadata, diff, occurred_at, recorded_at) VALUES ($1, 'update_name', $2, $3, 'skills', 0, $4, '{\"request_id\":\"req\"}', '[{\"field\":\"name\",\"from\":\"go\",\"to\":\"golang\"}]', $5, $5)",
+		key, actor, key+":"+strconv.FormatInt(offset, 10), offset, now)
+}
+
+func addAuditEntry(db *sql.DB, key string, action skill.SkillAction, version int64, diff string, recordedAt time.Time) {
+	db.Exec("INSERT INTO skill_audit (skill_key, action, version, event_id, source_topic, source_partition, source_offset, diff, occurred_at, recorded_at) VALUES ($1, $2, $3, $4, 'skills', 0, $5, $6, $7, $7)",
+		key, string(action), version, key+":"+strconv.FormatInt(version, 10), version, diff, recordedAt)
 }
 
-func (p *MockProducer) PublishMessage(action skill.SkillAction, payload interface{}) error {
-	return p.err
+func getOutboxCount(db *sql.DB) int {
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM outbox").Scan(&count)
+	return count
 }
 func TestGetSkillByKeyRepo(t *testing.T) {
 
@@ -42,9 +118,7 @@ func TestGetSkillByKeyRepo(t *testing.T) {
 
 		db.Exec("INSERT INTO skill (key, name, description, logo, tags) VALUES ('go', 'go', 'description', 'logo', '{tag2,tag3}')")
 
-		producer := &MockProducer{}
-
-		repo := skill.NewSkillRepo(db, producer)
+		repo := skill.NewSkillRepo(db)
 
 		//act
 		skill, err := repo.GetSkillByKey("go")
@@ -58,6 +132,7 @@ func TestGetSkillByKeyRepo(t *testing.T) {
 		assert.Equal(t, skill.Name, "go")
 		assert.Equal(t, skill.Description, "description")
 		assert.Equal(t, skill.Logo, "logo")
+		assert.Equal(t, skill.Version, int64(1))
 
 	})
 }
@@ -73,18 +148,20 @@ func TestGetSkillsRepo(t *testing.T) {
 		db.Exec("INSERT INTO skill (key, name, description, logo, tags) VALUES ('go', 'go', 'description', 'logo', '{tag2,tag3}')")
 		db.Exec("INSERT INTO skill (key, name, description, logo, tags) VALUES ('python', 'python', 'dec', 'lo', '{tag2,tag3}')")
 
-		producer := &MockProducer{}
-
-		repo := skill.NewSkillRepo(db, producer)
+		repo := skill.NewSkillRepo(db)
 
 		//act
-		skills, err := repo.GetSkills()
+		page, err := repo.GetSkills(skill.SkillQuery{})
 
 		//assert
 		if err != nil {
 			t.Errorf("expected error to be nil but got %v", err)
 		}
 
+		skills := page.Skills
+		assert.Equal(t, 2, page.Total)
+		assert.Empty(t, page.NextCursor)
+
 		assert.Equal(t, skills[0].Key, "go")
 		assert.Equal(t, skills[0].Name, "go")
 		assert.Equal(t, skills[0].Description, "description")
@@ -96,48 +173,273 @@ func TestGetSkillsRepo(t *testing.T) {
 		assert.Equal(t, skills[1].Logo, "lo")
 
 	})
+	t.Run("should walk every page with the next cursor", func(t *testing.T) {
+		//arange
+		db := newSkillListDB()
+		defer db.Close()
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		keys := []string{}
+		query := skill.SkillQuery{Limit: 2, Sort: skill.SortByKey}
+		for pages := 0; pages < 10; pages++ {
+			page, err := repo.GetSkills(query)
+			if err != nil {
+				t.Fatalf("expected error to be nil but got %v", err)
+			}
+			assert.Equal(t, 5, page.Total)
+			keys = append(keys, skillKeys(page.Skills)...)
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+
+		//assert
+		assert.Equal(t, []string{"gin", "go", "go_kit", "python", "rust"}, keys)
+	})
+	t.Run("should page by name and break ties by key", func(t *testing.T) {
+		//arange
+		db := newSkillListDB()
+		defer db.Close()
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		first, _ := repo.GetSkills(skill.SkillQuery{Limit: 3, Sort: skill.SortByName})
+		second, err := repo.GetSkills(skill.SkillQuery{Limit: 3, Sort: skill.SortByName, Cursor: first.NextCursor})
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"gin", "go", "go_kit"}, skillKeys(first.Skills))
+		assert.Equal(t, []string{"python", "rust"}, skillKeys(second.Skills))
+		assert.Empty(t, second.NextCursor)
+	})
+	t.Run("should filter by any tag", func(t *testing.T) {
+		//arange
+		db := newSkillListDB()
+		defer db.Close()
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		page, err := repo.GetSkills(skill.SkillQuery{Tags: []string{"web", "systems"}, TagMatch: skill.TagMatchAny})
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"gin", "go", "rust"}, skillKeys(page.Skills))
+		assert.Equal(t, 3, page.Total)
+	})
+	t.Run("should filter by all tags", func(t *testing.T) {
+		//arange
+		db := newSkillListDB()
+		defer db.Close()
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		page, err := repo.GetSkills(skill.SkillQuery{Tags: []string{"lang", "web"}, TagMatch: skill.TagMatchAll})
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"go"}, skillKeys(page.Skills))
+		assert.Equal(t, 1, page.Total)
+	})
+	t.Run("should match tags literally without wildcards", func(t *testing.T) {
+		//arange
+		db := newSkillListDB()
+		defer db.Close()
+		repo := skill.NewSkillRepo(db)
+		db.Exec(`INSERT INTO skill (key, name, description, logo, tags) VALUES ('cpp', 'C++', '', '', '{c_,50%,"web,systems","say \"hi\""}')`)
+
+		//act
+		wildcards, _ := repo.GetSkills(skill.SkillQuery{Tags: []string{"w_b", "%"}, TagMatch: skill.TagMatchAny})
+		literal, err := repo.GetSkills(skill.SkillQuery{Tags: []string{"c_", "50%", "web,systems", `say "hi"`}, TagMatch: skill.TagMatchAll})
+		split, _ := repo.GetSkills(skill.SkillQuery{Tags: []string{"web", "systems"}, TagMatch: skill.TagMatchAll})
+
+		//assert
+		assert.NoError(t, err)
+		assert.Empty(t, wildcards.Skills)
+		assert.Equal(t, []string{"cpp"}, skillKeys(literal.Skills))
+		assert.Empty(t, split.Skills)
+	})
+	t.Run("should filter by name prefix ignoring case and wildcards", func(t *testing.T) {
+		//arange
+		db := newSkillListDB()
+		defer db.Close()
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		page, _ := repo.GetSkills(skill.SkillQuery{NamePrefix: "GO"})
+		escaped, err := repo.GetSkills(skill.SkillQuery{NamePrefix: "go_"})
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"go", "go_kit"}, skillKeys(page.Skills))
+		assert.Equal(t, []string{"go_kit"}, skillKeys(escaped.Skills))
+	})
+	t.Run("should filter by key list", func(t *testing.T) {
+		//arange
+		db := newSkillListDB()
+		defer db.Close()
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		page, err := repo.GetSkills(skill.SkillQuery{Keys: []string{"rust", "gin", "java"}, Limit: 1})
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"gin"}, skillKeys(page.Skills))
+		assert.Equal(t, 2, page.Total)
+		assert.NotEmpty(t, page.NextCursor)
+	})
+	t.Run("should return bad request when cursor is invalid", func(t *testing.T) {
+		//arange
+		db := newSkillListDB()
+		defer db.Close()
+		repo := skill.NewSkillRepo(db)
+		byKey, _ := repo.GetSkills(skill.SkillQuery{Limit: 1, Sort: skill.SortByKey})
+
+		//act
+		_, garbage := repo.GetSkills(skill.SkillQuery{Cursor: "not a cursor"})
+		_, otherSort := repo.GetSkills(skill.SkillQuery{Cursor: byKey.NextCursor, Sort: skill.SortByName})
+
+		//assert
+		assert.Equal(t, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidCursor, "Invalid cursor"), garbage)
+		assert.Equal(t, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidCursor, "Invalid cursor"), otherSort)
+	})
 }
-func TestCreateSkillRepo(t *testing.T) {
 
-	t.Run("should return skill when key is exist", func(t *testing.T) {
+func TestSearchSkillsRepo(t *testing.T) {
+	t.Run("should rank name matches above tag and description matches", func(t *testing.T) {
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		db.Exec(`INSERT INTO skill (key, name, description, logo, tags) VALUES
+			('gin', 'Gin', 'Web framework written in Go', '', '{web,go}'),
+			('go', 'Go', 'Compiled language', '', '{lang}'),
+			('python', 'Python', 'Scripting language', '', '{lang}'),
+			('echo', 'Echo', 'High performance web framework', '', '{"web"}')`)
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		skills, err := repo.SearchSkills("go", 10)
 
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"go", "gin"}, skillKeys(skills))
+	})
+	t.Run("should require every term and respect limit", func(t *testing.T) {
 		//arange
 		db := newMockDB()
 		defer db.Close()
+		db.Exec(`INSERT INTO skill (key, name, description, logo, tags) VALUES
+			('gin', 'Gin', 'Web framework written in Go', '', '{web,go}'),
+			('echo', 'Echo', 'High performance web framework', '', '{"web"}'),
+			('django', 'Django', 'Python web framework', '', '{web,python}')`)
+		repo := skill.NewSkillRepo(db)
 
-		producer := &MockProducer{err: nil}
+		//act
+		all, _ := repo.SearchSkills("Web Framework", 10)
+		limited, _ := repo.SearchSkills("web framework", 2)
+		none, err := repo.SearchSkills("web rust", 10)
 
-		repo := skill.NewSkillRepo(db, producer)
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"django", "echo", "gin"}, skillKeys(all))
+		assert.Len(t, limited, 2)
+		assert.Empty(t, none)
+	})
+}
 
-		skill := skill.Skill{
+// newSkillListDB holds tags written both unquoted and the way pq quotes them.
+func newSkillListDB() *sql.DB {
+	db := newMockDB()
+	db.Exec(`INSERT INTO skill (key, name, description, logo, tags) VALUES
+		('python', 'Python', '', '', '{lang,scripting}'),
+		('go', 'Go', '', '', '{"lang","web"}'),
+		('rust', 'Rust', '', '', '{lang,systems}'),
+		('gin', 'Gin', '', '', '{web}'),
+		('go_kit', 'Go_kit', '', '', '{"toolkit"}')`)
+	return db
+}
+
+func skillKeys(skills []skill.Skill) []string {
+	keys := []string{}
+	for _, skill := range skills {
+		keys = append(keys, skill.Key)
+	}
+	return keys
+}
+func TestCreateSkillRepo(t *testing.T) {
+
+	t.Run("should return pending command when publish successfully", func(t *testing.T) {
+
+		//arange
+		db := newMockDB()
+		defer db.Close()
+
+		repo := skill.NewSkillRepo(db)
+
+		want := skill.Skill{
 			Key:         "go",
 			Name:        "go",
 			Description: "description",
 			Logo:        "logo",
 		}
 		//act
-		resultSkill, err := repo.CreateSkill(skill)
+		cmd, err := repo.CreateSkill(want)
 
 		//assert
 		if err != nil {
 			t.Errorf("expected error to be nil but got %v", err)
 		}
 
-		assert.Equal(t, "go", resultSkill.Key)
-		assert.Equal(t, "go", resultSkill.Name)
-		assert.Equal(t, "description", resultSkill.Description)
-		assert.Equal(t, "logo", resultSkill.Logo)
+		assert.NotEmpty(t, cmd.ID)
+		assert.Equal(t, string(skill.CreateSkillAction), cmd.Action)
+		assert.Equal(t, "go", cmd.Key)
+		assert.Equal(t, command.StatusPending, cmd.Status)
+
+		status, _ := getCommandStatus(db, cmd.ID)
+		assert.Equal(t, string(command.StatusPending), status)
+
+		action, payload := getOutboxMessage(db, cmd.ID)
+		assert.Equal(t, string(skill.CreateSkillAction), action)
+		assert.JSONEq(t, `{"key":"go","name":"go","description":"description","logo":"logo","tags":null}`, payload)
+	})
+	t.Run("should store the caller with the outbox message", func(t *testing.T) {
+
+		//arange
+		db := newMockDB()
+		defer db.Close()
+
+		repo := skill.NewSkillRepo(db).WithCaller(skill.Caller{
+			Actor:        "alice",
+			Metadata:     map[string]string{"request_id": "req-1"},
+			TraceContext: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		})
+
+		//act
+		cmd, err := repo.CreateSkill(skill.Skill{Key: "go", Name: "go"})
+
+		//assert
+		if err != nil {
+			t.Errorf("expected error to be nil but got %v", err)
+		}
 
+		actor, metadata := getOutboxCaller(db, cmd.ID)
+		assert.Equal(t, "alice", actor)
+		assert.JSONEq(t, `{"request_id":"req-1"}`, metadata)
+		var traceContext string
+		db.QueryRow("SELECT trace_context FROM outbox WHERE command_id = $1", cmd.ID).Scan(&traceContext)
+		assert.JSONEq(t, `{"traceparent":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}`, traceContext)
 	})
-	t.Run("should return error when fail publish data", func(t *testing.T) {
+	t.Run("should not store command when outbox write fail", func(t *testing.T) {
 
 		//arange
 		db := newMockDB()
 		defer db.Close()
 
-		producer := &MockProducer{err: errors.New("error")}
+		db.Exec("DROP TABLE outbox")
 
-		repo := skill.NewSkillRepo(db, producer)
+		repo := skill.NewSkillRepo(db)
 
 		skill := skill.Skill{
 			Key:         "go",
@@ -146,31 +448,32 @@ func TestCreateSkillRepo(t *testing.T) {
 			Logo:        "logo",
 		}
 		//act
-		resultSkill, err := repo.CreateSkill(skill)
+		cmd, err := repo.CreateSkill(skill)
 
 		//assert
 		if err == nil {
-			t.Errorf("expected nil but got %v", err)
+			t.Errorf("expected error but got %v", err)
 		}
 
-		if resultSkill != nil {
-			t.Errorf("expected resultSkill to be nil but got %v", resultSkill)
+		if cmd != nil {
+			t.Errorf("expected command to be nil but got %v", cmd)
 		}
 
+		var count int
+		db.QueryRow("SELECT COUNT(*) FROM command").Scan(&count)
+		assert.Equal(t, 0, count)
 	})
 }
 
 func TestUpdateSkillRepo(t *testing.T) {
 
-	t.Run("should return skill when key is exist", func(t *testing.T) {
+	t.Run("should return error when key does not match", func(t *testing.T) {
 
 		//arange
 		db := newMockDB()
 		defer db.Close()
 
-		producer := &MockProducer{err: nil}
-
-		repo := skill.NewSkillRepo(db, producer)
+		repo := skill.NewSkillRepo(db)
 
 		skill := skill.Skill{
 			Key:         "go",
@@ -179,27 +482,25 @@ func TestUpdateSkillRepo(t *testing.T) {
 			Logo:        "logo",
 		}
 		//act
-		resultSkill, err := repo.UpdateSkill("python", skill)
+		cmd, err := repo.UpdateSkill("python", skill, 0)
 
 		//assert
 		if err == nil {
-			t.Errorf("expected to be nil but got %v", err)
+			t.Errorf("expected error but got %v", err)
 		}
 
-		if resultSkill != nil {
-			t.Errorf("expected resultSkill to be nil but got %v", resultSkill)
+		if cmd != nil {
+			t.Errorf("expected command to be nil but got %v", cmd)
 		}
 
 	})
-	t.Run("should return skill when key is exist", func(t *testing.T) {
+	t.Run("should return error when key is not exist", func(t *testing.T) {
 
 		//arange
 		db := newMockDB()
 		defer db.Close()
 
-		producer := &MockProducer{err: nil}
-
-		repo := skill.NewSkillRepo(db, producer)
+		repo := skill.NewSkillRepo(db)
 
 		skill := skill.Skill{
 			Key:         "go",
@@ -208,52 +509,53 @@ func TestUpdateSkillRepo(t *testing.T) {
 			Logo:        "logo",
 		}
 		//act
-		resultSkill, err := repo.UpdateSkill("go", skill)
+		cmd, err := repo.UpdateSkill("go", skill, 0)
 
 		//assert
-		if err != nil {
-			t.Errorf("expected error to be nil but got %v", err)
+		if err == nil {
+			t.Errorf("expected error but got %v", err)
 		}
 
-		assert.Equal(t, "go", resultSkill.Key)
-		assert.Equal(t, "go", resultSkill.Name)
-		assert.Equal(t, "description", resultSkill.Description)
-		assert.Equal(t, "logo", resultSkill.Logo)
+		if cmd != nil {
+			t.Errorf("expected command to be nil but got %v", cmd)
+		}
 
 	})
-	t.Run("should return error when fail publish data", func(t *testing.T) {
+	t.Run("should return pending command when key is exist", func(t *testing.T) {
 
 		//arange
 		db := newMockDB()
 		defer db.Close()
 
-		producer := &MockProducer{err: errors.New("error")}
+		db.Exec("INSERT INTO skill (key, name, description, logo, tags) VALUES ('go', 'go', 'description', 'logo', '{tag2,tag3}')")
 
-		repo := skill.NewSkillRepo(db, producer)
+		repo := skill.NewSkillRepo(db)
 
-		skill := skill.Skill{
+		want := skill.Skill{
 			Key:         "go",
 			Name:        "go",
 			Description: "description",
 			Logo:        "logo",
 		}
 		//act
-		resultSkill, err := repo.UpdateSkill("go", skill)
+		cmd, err := repo.UpdateSkill("go", want, 0)
 
 		//assert
-		if err == nil {
-			t.Errorf("expected nil but got %v", err)
+		if err != nil {
+			t.Errorf("expected error to be nil but got %v", err)
 		}
 
-		if resultSkill != nil {
-			t.Errorf("expected resultSkill to be nil but got %v", resultSkill)
-		}
+		assert.Equal(t, string(skill.UpdateSkillAction), cmd.Action)
+		assert.Equal(t, command.StatusPending, cmd.Status)
+		action, payload := getOutboxMessage(db, cmd.ID)
+		assert.Equal(t, string(skill.UpdateSkillAction), action)
+		assert.JSONEq(t, `{"key":"go","name":"go","description":"description","logo":"logo","tags":null}`, payload)
 
 	})
 }
 
 func TestUpdateSkillNameByKeyRepo(t *testing.T) {
-	t.Run("should return skill when key is exist", func(t *testing.T) {
+	t.Run("should publish name update when key is exist", func(t *testing.T) {
 
 		//arange
 		db := newMockDB()
@@ -261,28 +563,83 @@ func TestUpdateSkillNameByKeyRepo(t *testing.T) {
 
 		db.Exec("INSERT INTO skill (key, name, description, logo, tags) VALUES ('go', 'go', 'description', 'logo', '{tag2,tag3}')")
 
-		producer := &MockProducer{err: nil}
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		cmd, err := repo.UpdateSkillNameByKey("go", "gopher", 0)
+
+		//assert
+		if err != nil {
+			t.Errorf("expected to be nil but got %v", err)
+		}
+
+		assert.Equal(t, string(skill.UpdateNameAction), cmd.Action)
+		assert.Equal(t, "go", cmd.Key)
+		_, payload := getOutboxMessage(db, cmd.ID)
+		assert.JSONEq(t, `{"Key":"go","Name":"gopher"}`, payload)
+
+	})
+	t.Run("should return error when key is not exist", func(t *testing.T) {
+
+		//arange
+		db := newMockDB()
+		defer db.Close()
 
-		repo := skill.NewSkillRepo(db, producer)
+		repo := skill.NewSkillRepo(db)
 
 		//act
-		resultSkill, err := repo.UpdateSkillNameByKey("go", "gopher")
+		_, err := repo.UpdateSkillNameByKey("go", "gopher", 0)
+
+		//assert
+		if err == nil {
+			t.Errorf("expected error but got %v", err)
+		}
+
+		assert.Equal(t, 0, getOutboxCount(db))
+	})
+	t.Run("should carry expected version when it matches", func(t *testing.T) {
+
+		//arange
+		db := newMockDB()
+		defer db.Close()
+
+		db.Exec("INSERT INTO skill (key, name, description, logo, tags, version) VALUES ('go', 'go', 'description', 'logo', '{tag2,tag3}', 3)")
+
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		cmd, err := repo.UpdateSkillNameByKey("go", "gopher", 3)
 
 		//assert
 		if err != nil {
 			t.Errorf("expected to be nil but got %v", err)
 		}
 
-		assert.Equal(t, "go", resultSkill.Key)
-		assert.Equal(t, "gopher", resultSkill.Name)
-		assert.Equal(t, "description", resultSkill.Description)
-		assert.Equal(t, "logo", resultSkill.Logo)
+		var expectedVersion int64
+		db.QueryRow("SELECT expected_version FROM outbox WHERE command_id = $1", cmd.ID).Scan(&expectedVersion)
+		assert.Equal(t, int64(3), expectedVersion)
+	})
+	t.Run("should return precondition failed when version is stale", func(t *testing.T) {
+
+		//arange
+		db := newMockDB()
+		defer db.Close()
+
+		db.Exec("INSERT INTO skill (key, name, description, logo, tags, version) VALUES ('go', 'go', 'description', 'logo', '{tag2,tag3}', 4)")
+
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		_, err := repo.UpdateSkillNameByKey("go", "gopher", 3)
 
+		//assert
+		assert.Equal(t, errs.NewErrorWithCode(http.StatusPreconditionFailed, errs.CodeVersionMismatch, "Skill version does not match"), err)
+		assert.Equal(t, 0, getOutboxCount(db))
 	})
 }
 
 func TestUpdateSkillDescriptionByKeyRepo(t *testing.T) {
-	t.Run("should return skill when key is exist", func(t *testing.T) {
+	t.Run("should publish description update when key is exist", func(t *testing.T) {
 
 		//arange
 		db := newMockDB()
@@ -290,28 +647,26 @@ func TestUpdateSkillDescriptionByKeyRepo(t *testing.T) {
 
 		db.Exec("INSERT INTO skill (key, name, description, logo, tags) VALUES ('go', 'go', 'description', 'logo', '{tag2,tag3}')")
 
-		producer := &MockProducer{err: nil}
-
-		repo := skill.NewSkillRepo(db, producer)
+		repo := skill.NewSkillRepo(db)
 
 		//act
-		resultSkill, err := repo.UpdateSkillDescriptionByKey("go", "gopher description")
+		cmd, err := repo.UpdateSkillDescriptionByKey("go", "gopher description", 0)
 
 		//assert
 		if err != nil {
 			t.Errorf("expected to be nil but got %v", err)
 		}
 
-		assert.Equal(t, "go", resultSkill.Key)
-		assert.Equal(t, "go", resultSkill.Name)
-		assert.Equal(t, "gopher description", resultSkill.Description)
-		assert.Equal(t, "logo", resultSkill.Logo)
+		assert.Equal(t, string(skill.UpdateDescAction), cmd.Action)
+		assert.Equal(t, "go", cmd.Key)
+		_, payload := getOutboxMessage(db, cmd.ID)
+		assert.JSONEq(t, `{"Key":"go","Description":"gopher description"}`, payload)
 
 	})
 }
 
 func TestUpdateSkillLogoByKeyRepo(t *testing.T) {
-	t.Run("should return skill when key is exist", func(t *testing.T) {
+	t.Run("should publish logo update when key is exist", func(t *testing.T) {
 
 		//arange
 		db := newMockDB()
@@ -319,28 +674,26 @@ func TestUpdateSkillLogoByKeyRepo(t *testing.T) {
 
 		db.Exec("INSERT INTO skill (key, name, description, logo, tags) VALUES ('go', 'go', 'description', 'logo', '{tag2,tag3}')")
 
-		producer := &MockProducer{err: nil}
-
-		repo := skill.NewSkillRepo(db, producer)
+		repo := skill.NewSkillRepo(db)
 
 		//act
-		resultSkill, err := repo.UpdateSkillLogoByKey("go", "gopher logo")
+		cmd, err := repo.UpdateSkillLogoByKey("go", "gopher logo", 0)
 
 		//assert
 		if err != nil {
 			t.Errorf("expected to be nil but got %v", err)
 		}
 
-		assert.Equal(t, "go", resultSkill.Key)
-		assert.Equal(t, "go", resultSkill.Name)
-		assert.Equal(t, "description", resultSkill.Description)
-		assert.Equal(t, "gopher logo", resultSkill.Logo)
+		assert.Equal(t, string(skill.UpdateLogoAction), cmd.Action)
+		assert.Equal(t, "go", cmd.Key)
+		_, payload := getOutboxMessage(db, cmd.ID)
+		assert.JSONEq(t, `{"Key":"go","Logo":"gopher logo"}`, payload)
 
 	})
 }
 
 func TestUpdateSkillTagsByKeyRepo(t *testing.T) {
-	t.Run("should return skill when key is exist", func(t *testing.T) {
+	t.Run("should publish tags update when key is exist", func(t *testing.T) {
 
 		//arange
 		db := newMockDB()
@@ -348,43 +701,383 @@ func TestUpdateSkillTagsByKeyRepo(t *testing.T) {
 
 		db.Exec("INSERT INTO skill (key, name, description, logo, tags) VALUES ('go', 'go', 'description', 'logo', '{tag2,tag3}')")
 
-		producer := &MockProducer{err: nil}
-
-		repo := skill.NewSkillRepo(db, producer)
+		repo := skill.NewSkillRepo(db)
 
 		//act
-		resultSkill, err := repo.UpdateSkillTagsByKey("go", []string{"gopher logo"})
+		cmd, err := repo.UpdateSkillTagsByKey("go", []string{"gopher logo"}, 0)
 
 		//assert
 		if err != nil {
 			t.Errorf("expected to be nil but got %v", err)
 		}
 
-		assert.Equal(t, "go", resultSkill.Key)
-		assert.Equal(t, "go", resultSkill.Name)
-		assert.Equal(t, "description", resultSkill.Description)
-		assert.Equal(t, "logo", resultSkill.Logo)
-		assert.Equal(t, []string{"gopher logo"}, resultSkill.Tags)
+		assert.Equal(t, string(skill.UpdateTagsAction), cmd.Action)
+		assert.Equal(t, "go", cmd.Key)
+		_, payload := getOutboxMessage(db, cmd.ID)
+		assert.JSONEq(t, `{"Key":"go","Tags":["gopher logo"]}`, payload)
 
 	})
 }
 
 func TestDeleteSkillRepo(t *testing.T) {
-	//arange
-	db := newMockDB()
-	defer db.Close()
+	t.Run("should publish delete message when key is exist", func(t *testing.T) {
+		//arange
+		db := newMockDB()
+		defer db.Close()
+
+		db.Exec("INSERT INTO skill (key, name, description, logo, tags) VALUES ('go', 'go', 'description', 'logo', '{tag2,tag3}')")
+
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		cmd, err := repo.DeleteSkillByKey("go", 0)
 
-	db.Exec("INSERT INTO skill (key, name, description, logo, tags) VALUES ('go', 'go', 'description', 'logo', '{tag2,tag3}')")
+		//assert
+		if err != nil {
+			t.Errorf("expected to be nil but got %v", err)
+		}
 
-	producer := &MockProducer{err: nil}
+		assert.Equal(t, string(skill.DeleteSkillAction), cmd.Action)
+		action, payload := getOutboxMessage(db, cmd.ID)
+		assert.Equal(t, string(skill.DeleteSkillAction), action)
+		assert.JSONEq(t, `{"Key":"go"}`, payload)
+	})
+	t.Run("should return error when key is not exist", func(t *testing.T) {
+		//arange
+		db := newMockDB()
+		defer db.Close()
 
-	repo := skill.NewSkillRepo(db, producer)
+		repo := skill.NewSkillRepo(db)
 
-	//act
-	err := repo.DeleteSkillByKey("go")
+		//act
+		_, err := repo.DeleteSkillByKey("go", 0)
 
-	//assert
-	if err != nil {
-		t.Errorf("expected to be nil but got %v", err)
-	}
+		//assert
+		if err == nil {
+			t.Errorf("expected error but got %v", err)
+		}
+
+		assert.Equal(t, 0, getOutboxCount(db))
+	})
+}
+
+func TestGetSkillHistoryRepo(t *testing.T) {
+
+	t.Run("should page history newest first", func(t *testing.T) {
+
+		//arange
+		db := newMockDB()
+		defer db.Close()
+
+		addAudit(db, "go", 1, "alice")
+		addAudit(db, "go", 2, "bob")
+		addAudit(db, "go", 3, "carol")
+		addAudit(db, "python", 4, "dave")
+
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		first, err := repo.GetSkillHistory("go", skill.HistoryQuery{Limit: 2})
+
+		//assert
+		if err != nil {
+			t.Errorf("expected error to be nil but got %v", err)
+		}
+
+		assert.Equal(t, 3, first.Total)
+		assert.Len(t, first.Entries, 2)
+		assert.Equal(t, "carol", first.Entries[0].Actor)
+		assert.Equal(t, "bob", first.Entries[1].Actor)
+		assert.Equal(t, skill.AuditSource{Topic: "skills", Partition: 0, Offset: 3}, first.Entries[0].Source)
+		assert.Equal(t, map[string]string{"request_id": "req"}, first.Entries[0].Metadata)
+		assert.Equal(t, "name", first.Entries[0].Changes[0].Field)
+		assert.JSONEq(t, `"golang"`, string(first.Entries[0].Changes[0].To))
+		assert.NotEmpty(t, first.NextCursor)
+
+		second, err := repo.GetSkillHistory("go", skill.HistoryQuery{Limit: 2, Cursor: first.NextCursor})
+		assert.NoError(t, err)
+		assert.Len(t, second.Entries, 1)
+		assert.Equal(t, "alice", second.Entries[0].Actor)
+		assert.Empty(t, second.NextCursor)
+	})
+	t.Run("should return empty history when key has no entries", func(t *testing.T) {
+
+		//arange
+		db := newMockDB()
+		defer db.Close()
+
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		page, err := repo.GetSkillHistory("kotlin", skill.HistoryQuery{})
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, 0, page.Total)
+		assert.Equal(t, []skill.AuditEntry{}, page.Entries)
+	})
+	t.Run("should return bad request when cursor is invalid", func(t *testing.T) {
+
+		//arange
+		db := newMockDB()
+		defer db.Close()
+
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		_, err := repo.GetSkillHistory("go", skill.HistoryQuery{Cursor: "not-a-cursor"})
+
+		//assert
+		assert.Equal(t, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidCursor, "Invalid cursor"), err)
+	})
+}
+
+func newAuditedSkill(db *sql.DB) time.Time {
+	at := time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC)
+	addAuditEntry(db, "go", skill.CreateSkillAction, 1, `[{"field":"name","from":null,"to":"go"},{"field":"description","from":null,"to":"first"},{"field":"logo","from":null,"to":""},{"field":"tags","from":null,"to":["lang"]}]`, at)
+	addAuditEntry(db, "go", skill.UpdateNameAction, 2, `[{"field":"name","from":"go","to":"golang"}]`, at.Add(time.Hour))
+	addAuditEntry(db, "go", skill.UpdateTagsAction, 3, `[{"field":"tags","from":["lang"],"to":[]}]`, at.Add(2*time.Hour))
+	return at
+}
+
+func TestGetSkillAsOfRepo(t *testing.T) {
+
+	t.Run("should rebuild skill at a version", func(t *testing.T) {
+
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		newAuditedSkill(db)
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		got, err := repo.GetSkillAsOf("go", skill.AsOf{Version: 2})
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, &skill.Skill{Key: "go", Name: "golang", Description: "first", Tags: []string{"lang"}, Version: 2}, got)
+	})
+	t.Run("should rebuild skill at a time", func(t *testing.T) {
+
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		at := newAuditedSkill(db)
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		got, err := repo.GetSkillAsOf("go", skill.AsOf{Time: at.Add(30 * time.Minute)})
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, &skill.Skill{Key: "go", Name: "go", Description: "first", Tags: []string{"lang"}, Version: 1}, got)
+	})
+	t.Run("should return not found before the skill existed", func(t *testing.T) {
+
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		at := newAuditedSkill(db)
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		_, err := repo.GetSkillAsOf("go", skill.AsOf{Time: at.Add(-time.Minute)})
+
+		//assert
+		assert.Equal(t, errs.NewErrorWithCode(http.StatusNotFound, errs.CodeSkillNotFound, "Skill not found"), err)
+	})
+	t.Run("should return not found after the skill was deleted", func(t *testing.T) {
+
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		at := newAuditedSkill(db)
+		addAuditEntry(db, "go", skill.DeleteSkillAction, 0, `[]`, at.Add(3*time.Hour))
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		_, err := repo.GetSkillAsOf("go", skill.AsOf{Time: at.Add(4 * time.Hour)})
+
+		//assert
+		assert.Equal(t, errs.NewErrorWithCode(http.StatusNotFound, errs.CodeSkillNotFound, "Skill not found"), err)
+	})
+}
+
+func TestRevertSkillRepo(t *testing.T) {
+
+	t.Run("should publish an update restoring the version", func(t *testing.T) {
+
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		newAuditedSkill(db)
+		db.Exec("INSERT INTO skill (key, name, description, logo, tags, version) VALUES ('go', 'golang', 'first', '', '{}', 3)")
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		cmd, err := repo.RevertSkill("go", 1, 3)
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, string(skill.UpdateSkillAction), cmd.Action)
+		action, payload := getOutboxMessage(db, cmd.ID)
+		assert.Equal(t, string(skill.UpdateSkillAction), action)
+		assert.JSONEq(t, `{"key":"go","name":"go","description":"first","logo":"","tags":["lang"]}`, payload)
+	})
+	t.Run("should return not found when version is not in history", func(t *testing.T) {
+
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		newAuditedSkill(db)
+		db.Exec("INSERT INTO skill (key, name, description, logo, tags, version) VALUES ('go', 'golang', 'first', '', '{}', 3)")
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		_, err := repo.RevertSkill("go", 9, 0)
+
+		//assert
+		assert.Equal(t, errs.NewErrorWithCode(http.StatusNotFound, errs.CodeVersionNotFound, "Skill version not found"), err)
+		assert.Equal(t, 0, getOutboxCount(db))
+	})
+}
+
+func TestImportSkillsRepo(t *testing.T) {
+
+	t.Run("should queue a create command for every skill", func(t *testing.T) {
+
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		cmds, err := repo.ImportSkills([]skill.Skill{{Key: "go", Name: "Go"}, {Key: "rust", Name: "Rust"}})
+
+		//assert
+		assert.NoError(t, err)
+		assert.Len(t, cmds, 2)
+		assert.Equal(t, "rust", cmds[1].Key)
+		assert.Equal(t, 2, getOutboxCount(db))
+		action, payload := getOutboxMessage(db, cmds[0].ID)
+		assert.Equal(t, string(skill.CreateSkillAction), action)
+		assert.JSONEq(t, `{"key":"go","name":"Go","description":"","logo":"","tags":null}`, payload)
+	})
+}
+
+func TestExistingKeysRepo(t *testing.T) {
+
+	t.Run("should report only the keys that name a skill", func(t *testing.T) {
+
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		db.Exec("INSERT INTO skill (key, name, description, logo, tags) VALUES ('go', 'go', 'description', 'logo', '{tag2,tag3}')")
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		existing, err := repo.ExistingKeys([]string{"go", "rust"})
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]bool{"go": true}, existing)
+	})
+}
+
+func TestSkillVersionRepo(t *testing.T) {
+
+	t.Run("should read the version of a skill or else of its tombstone", func(t *testing.T) {
+
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		db.Exec("INSERT INTO skill (key, name, description, logo, tags, version) VALUES ('go', 'go', '', '', '{}', 3)")
+		db.Exec("INSERT INTO skill_tombstone (key, version) VALUES ('rust', 5)")
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		goVersion, goExists, err := repo.SkillVersion("go")
+		rustVersion, rustExists, _ := repo.SkillVersion("rust")
+		newVersion, newExists, _ := repo.SkillVersion("kotlin")
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), goVersion)
+		assert.True(t, goExists)
+		assert.Equal(t, int64(5), rustVersion)
+		assert.False(t, rustExists)
+		assert.Equal(t, int64(0), newVersion)
+		assert.False(t, newExists)
+	})
+}
+
+func TestExportSkillsRepo(t *testing.T) {
+
+	t.Run("should call back with every skill in key order", func(t *testing.T) {
+
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		db.Exec("INSERT INTO skill (key, name, description, logo, tags) VALUES ('rust', 'Rust', '', '', '{}')")
+		db.Exec("INSERT INTO skill (key, name, description, logo, tags) VALUES ('go', 'Go', '', '', '{lang}')")
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		keys := []string{}
+		err := repo.ExportSkills(func(s skill.Skill) error {
+			keys = append(keys, s.Key)
+			return nil
+		})
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"go", "rust"}, keys)
+	})
+	t.Run("should stop at the first callback error", func(t *testing.T) {
+
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		db.Exec("INSERT INTO skill (key, name, description, logo, tags) VALUES ('go', 'Go', '', '', '{}')")
+		db.Exec("INSERT INTO skill (key, name, description, logo, tags) VALUES ('rust', 'Rust', '', '', '{}')")
+		repo := skill.NewSkillRepo(db)
+		boom := errors.New("client gone")
+
+		//act
+		calls := 0
+		err := repo.ExportSkills(func(s skill.Skill) error {
+			calls++
+			return boom
+		})
+
+		//assert
+		assert.Equal(t, boom, err)
+		assert.Equal(t, 1, calls)
+	})
+}
+
+func TestPublishBatchRepo(t *testing.T) {
+
+	t.Run("should queue every mutation in order", func(t *testing.T) {
+
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		cmds, err := repo.PublishBatch([]skill.Mutation{
+			{Action: skill.CreateSkillAction, Key: "go", Payload: skill.Skill{Key: "go", Name: "Go"}},
+			{Action: skill.DeleteSkillAction, Key: "rust", ExpectedVersion: 3, Payload: skill.DeleteMessage{Key: "rust"}},
+		})
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, 2, getOutboxCount(db))
+		action, payload := getOutboxMessage(db, cmds[1].ID)
+		assert.Equal(t, string(skill.DeleteSkillAction), action)
+		assert.JSONEq(t, `{"Key":"rust"}`, payload)
+		status, _ := getCommandStatus(db, cmds[0].ID)
+		assert.Equal(t, string(command.StatusPending), status)
+	})
 }
@@ -0,0 +1,85 @@
+package skill
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Field weights follow the defaults of postgres ts_rank for the A, B and C
+// weights the consumer gives name, tags and description.
+const (
+	nameWeight        = 1.0
+	tagWeight         = 0.4
+	descriptionWeight = 0.2
+)
+
+// searchQuery ranks with the tsvector column the consumer keeps up to date.
+const searchQuery = `SELECT key, name, description, logo, tags, version
+	FROM skill, websearch_to_tsquery('english', $1) query
+	WHERE search @@ query
+	ORDER BY ts_rank(search, query) DESC, key
+	LIMIT $2`
+
+// rankSkills is the pure Go stand-in for the postgres full-text search used
+// when the database has no tsvector support. Every term of q must appear in
+// the skill, and skills are ordered by the weighted number of matches.
+func rankSkills(skills []Skill, q string, limit int) []Skill {
+	terms := searchTerms(q)
+	if len(terms) == 0 {
+		return []Skill{}
+	}
+
+	type ranked struct {
+		skill Skill
+		rank  float64
+	}
+	results := []ranked{}
+	for _, skill := range skills {
+		name := searchTerms(skill.Name)
+		tags := searchTerms(strings.Join(skill.Tags, " "))
+		description := searchTerms(skill.Description)
+
+		rank, matched := 0.0, true
+		for _, term := range terms {
+			score := nameWeight*count(name, term) + tagWeight*count(tags, term) + descriptionWeight*count(description, term)
+			if score == 0 {
+				matched = false
+				break
+			}
+			rank += score
+		}
+		if matched {
+			results = append(results, ranked{skill: skill, rank: rank})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].rank != results[j].rank {
+			return results[i].rank > results[j].rank
+		}
+		return results[i].skill.Key < results[j].skill.Key
+	})
+
+	found := []Skill{}
+	for i := 0; i < len(results) && i < limit; i++ {
+		found = append(found, results[i].skill)
+	}
+	return found
+}
+
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func count(terms []string, term string) float64 {
+	n := 0.0
+	for _, t := range terms {
+		if t == term {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,49 @@
+package skill
+
+import (
+	"errors"
+	"gokafka/errs"
+	"skillevent"
+	"strings"
+)
+
+// Skill validates the request and returns the normalized skill to publish.
+func (req SkillCreateRequest) Skill() (Skill, error) {
+	skill := Skill{
+		Key:         req.Key,
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Logo:        req.Logo,
+		Tags:        skillevent.NormalizeTags(req.Tags),
+	}
+	err := skillevent.ValidateSkill(skill.Key, skill.Name, skill.Logo, skill.Tags)
+	return skill, validationError(err)
+}
+
+// Skill validates the request for the skill at key. The key itself is not
+// checked since it names a skill that already exists.
+func (req SkillUpdateRequest) Skill(key string) (Skill, error) {
+	skill := Skill{
+		Key:         key,
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Logo:        req.Logo,
+		Tags:        skillevent.NormalizeTags(req.Tags),
+	}
+	err := skillevent.Validate(skillevent.ValidateName(skill.Name), skillevent.ValidateLogo(skill.Logo), skillevent.ValidateTags(skill.Tags))
+	return skill, validationError(err)
+}
+
+// validationError turns the shared validation error into the 422 the API
+// answers with, listing each field.
+func validationError(err error) error {
+	var validation *skillevent.ValidationError
+	if !errors.As(err, &validation) {
+		return err
+	}
+	fields := make([]errs.FieldError, len(validation.Fields))
+	for i, field := range validation.Fields {
+		fields[i] = errs.FieldError{Field: field.Field, Message: field.Message}
+	}
+	return errs.NewValidationError(fields)
+}
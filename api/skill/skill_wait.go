@@ -0,0 +1,109 @@
+package skill
+
+import (
+	"context"
+	"errors"
+	"gokafka/command"
+	"gokafka/errs"
+	"gokafka/response"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaxWait caps how long a write waits for the consumer.
+const MaxWait = 30 * time.Second
+
+// waitFor reads how long the client is willing to wait for its write to be
+// applied, from ?wait=5 or a "Prefer: wait=5" header (RFC 7240), in seconds.
+// Zero means answer with 202 right away. A bad wait parameter is an error, a
+// bad preference is ignored like any preference the server does not know.
+func waitFor(ctx *gin.Context) (time.Duration, error) {
+	if ctx.Request == nil {
+		return 0, nil
+	}
+
+	if value := ctx.Query("wait"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return 0, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidQuery, "wait must be a number of seconds")
+		}
+		return capWait(seconds), nil
+	}
+
+	for _, header := range ctx.Request.Header.Values("Prefer") {
+		for _, preference := range strings.Split(header, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(strings.Split(preference, ";")[0]), "=")
+			if !strings.EqualFold(strings.TrimSpace(name), "wait") {
+				continue
+			}
+			if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && seconds >= 0 {
+				return capWait(seconds), nil
+			}
+		}
+	}
+	return 0, nil
+}
+
+func capWait(seconds int) time.Duration {
+	wait := time.Duration(seconds) * time.Second
+	if wait > MaxWait {
+		return MaxWait
+	}
+	return wait
+}
+
+// respond answers a write. Without a wait it is the 202 for cmd. With one it
+// waits for the consumer and answers with the persisted skill, or with the
+// 202 after all when the consumer has not caught up in time.
+func (h *skillHandler) respond(ctx *gin.Context, cmd *command.Command, wait time.Duration) {
+	if wait <= 0 {
+		accepted(ctx, cmd)
+		return
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx.Request.Context(), wait)
+	defer cancel()
+
+	ctx.Header("Preference-Applied", "wait="+strconv.Itoa(int(wait.Seconds())))
+	settled, err := h.skillrepo.WaitForCommand(waitCtx, cmd.ID)
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		accepted(ctx, cmd)
+		return
+	}
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+
+	switch settled.Status {
+	case command.StatusConflict:
+		response.Error(ctx, errs.NewErrorWithCode(http.StatusPreconditionFailed, errs.CodeVersionMismatch, "Skill version does not match"))
+		return
+	case command.StatusFailed:
+		response.Error(ctx, errs.NewErrorWithCode(http.StatusUnprocessableEntity, errs.CodeCommandFailed, "Skill command failed, see /api/v1/commands/"+settled.ID))
+		return
+	}
+
+	if SkillAction(settled.Action) == DeleteSkillAction {
+		response.SuccessMsg(ctx, http.StatusOK, "Skill deleted")
+		return
+	}
+
+	skill, err := h.skillrepo.GetSkillByKey(settled.Key)
+	if err != nil {
+		response.Error(ctx, err)
+		return
+	}
+
+	ctx.Header("ETag", etag(skill.Version))
+	if SkillAction(settled.Action) == CreateSkillAction {
+		ctx.Header("Location", "/api/v1/skills/"+skill.Key)
+		response.Success(ctx, http.StatusCreated, skill)
+		return
+	}
+	response.Success(ctx, http.StatusOK, skill)
+}
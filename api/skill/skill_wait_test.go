@@ -0,0 +1,163 @@
+package skill
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"gokafka/command"
+	"gokafka/errs"
+	"gokafka/response"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitFor(t *testing.T) {
+	cases := map[string]struct {
+		query  string
+		prefer string
+		want   time.Duration
+	}{
+		"no wait":             {want: 0},
+		"query":               {query: "?wait=5", want: 5 * time.Second},
+		"prefer":              {prefer: "wait=3", want: 3 * time.Second},
+		"prefer list":         {prefer: "respond-async, wait=2", want: 2 * time.Second},
+		"query wins":          {query: "?wait=1", prefer: "wait=9", want: time.Second},
+		"capped":              {query: "?wait=600", want: MaxWait},
+		"bad prefer ignored":  {prefer: "wait=soon", want: 0},
+		"other prefer values": {prefer: "return=minimal", want: 0},
+	}
+	for name, tc := range cases {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/skills"+tc.query, nil)
+		if tc.prefer != "" {
+			c.Request.Header.Set("Prefer", tc.prefer)
+		}
+
+		got, err := waitFor(c)
+
+		assert.NoError(t, err, name)
+		assert.Equal(t, tc.want, got, name)
+	}
+
+	t.Run("should return bad request when wait parameter is invalid", func(t *testing.T) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/skills?wait=-1", nil)
+
+		_, err := waitFor(c)
+
+		assert.Equal(t, errs.NewErrorWithCode(http.StatusBadRequest, errs.CodeInvalidQuery, "wait must be a number of seconds"), err)
+	})
+}
+
+func TestCreateSkillWait(t *testing.T) {
+	newRequest := func(prefer string) (*httptest.ResponseRecorder, *gin.Context) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		body, _ := json.Marshal(Skill{Key: "go", Name: "Go", Tags: []string{"lang"}})
+		c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/skills", bytes.NewReader(body))
+		c.Request.Header.Set("Prefer", prefer)
+		return w, c
+	}
+
+	t.Run("should response persisted skill once the consumer applied it", func(t *testing.T) {
+		//arrange
+		w, c := newRequest("wait=5")
+		skill := Skill{Key: "go", Name: "Go", Tags: []string{"lang"}, Version: 1}
+		cmd := newCommand()
+		settled := cmd
+		settled.Status = command.StatusApplied
+		mock := &mockRepo{command: cmd, settled: &settled, skill: skill}
+		handler := NewSkillHandler(mock)
+
+		want, _ := json.Marshal(response.Response{
+			Status: "success",
+			Data:   skill,
+		})
+		//act
+		handler.CreateSkill(c)
+		//assert
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, want, w.Body.Bytes())
+		assert.Equal(t, "/api/v1/skills/go", w.Header().Get("Location"))
+		assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+		assert.Equal(t, "wait=5", w.Header().Get("Preference-Applied"))
+	})
+
+	t.Run("should response accepted when the consumer does not confirm in time", func(t *testing.T) {
+		//arrange
+		w, c := newRequest("wait=1")
+		cmd := newCommand()
+		mock := &mockRepo{command: cmd, waitErr: context.DeadlineExceeded}
+		handler := NewSkillHandler(mock)
+
+		want, _ := json.Marshal(response.Response{
+			Status: "success",
+			Data:   cmd,
+		})
+		//act
+		handler.CreateSkill(c)
+		//assert
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Equal(t, want, w.Body.Bytes())
+	})
+
+	t.Run("should response precondition failed when the consumer found a conflict", func(t *testing.T) {
+		//arrange
+		w, c := newRequest("wait=5")
+		cmd := newCommand()
+		settled := cmd
+		settled.Status = command.StatusConflict
+		mock := &mockRepo{command: cmd, settled: &settled}
+		handler := NewSkillHandler(mock)
+
+		want := problem(c, http.StatusPreconditionFailed, errs.CodeVersionMismatch, "Skill version does not match")
+		//act
+		handler.CreateSkill(c)
+		//assert
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		assert.Equal(t, want, w.Body.Bytes())
+	})
+
+	t.Run("should not wait without a wait preference", func(t *testing.T) {
+		//arrange
+		w, c := newRequest("")
+		mock := &mockRepo{command: newCommand()}
+		handler := NewSkillHandler(mock)
+		//act
+		handler.CreateSkill(c)
+		//assert
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.False(t, mock.waited)
+	})
+}
+
+func TestDeleteSkillWait(t *testing.T) {
+	t.Run("should response deleted once the consumer applied it", func(t *testing.T) {
+		//arrange
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodDelete, "/api/v1/skills/go?wait=5", nil)
+		c.Params = []gin.Param{{Key: "key", Value: "go"}}
+		cmd := newCommand()
+		cmd.Action = string(DeleteSkillAction)
+		settled := cmd
+		settled.Status = command.StatusApplied
+		mock := &mockRepo{command: cmd, settled: &settled}
+		handler := NewSkillHandler(mock)
+
+		want, _ := json.Marshal(response.Response{
+			Status:  "success",
+			Message: "Skill deleted",
+		})
+		//act
+		handler.DeleteSkill(c)
+		//assert
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, want, w.Body.Bytes())
+	})
+}
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"errors"
+	"platform/configload"
+	"platform/kafkasecurity"
+	"platform/tracing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// Config is everything the consumer reads at startup. Each value comes from,
+// in increasing priority, its default, the YAML file, the environment and
+// the command line flags.
+type Config struct {
+	HTTP     HTTPConfig     `yaml:"http"`
+	Database DatabaseConfig `yaml:"database"`
+	Kafka    KafkaConfig    `yaml:"kafka"`
+	Retry    RetryConfig    `yaml:"retry"`
+	Batch    BatchConfig    `yaml:"batch"`
+	Outbox   OutboxConfig   `yaml:"outbox"`
+	Tracing  tracing.Config `yaml:"tracing"`
+}
+
+// HTTPConfig is the listener of the metrics and health endpoints.
+type HTTPConfig struct {
+	Addr string `yaml:"addr"`
+}
+
+type DatabaseConfig struct {
+	URL string `yaml:"url"`
+}
+
+type KafkaConfig struct {
+	Brokers []string `yaml:"brokers"`
+	Version string   `yaml:"version"`
+	Group   string   `yaml:"group"`
+	Topics  []string `yaml:"topics"`
+	// Oldest starts a new group at the oldest offset instead of the newest.
+	Oldest bool `yaml:"oldest"`
+	// Verbose turns on the sarama logger.
+	Verbose bool `yaml:"verbose"`
+	// DeadLetterTopic defaults to "<first topic>.dlq".
+	DeadLetterTopic string `yaml:"dead_letter_topic"`
+	// ReplyTopic defaults to "<first topic>.reply".
+	ReplyTopic  string                   `yaml:"reply_topic"`
+	ChangeTopic string                   `yaml:"change_topic"`
+	TLS         kafkasecurity.TLSConfig  `yaml:"tls"`
+	SASL        kafkasecurity.SASLConfig `yaml:"sasl"`
+}
+
+type RetryConfig struct {
+	Attempts   int           `yaml:"attempts"`
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+}
+
+// BatchConfig is how many messages the consumer applies per transaction and
+// how long a batch waits to fill after its first message. A size of 1
+// consumes one message at a time.
+type BatchConfig struct {
+	Size int           `yaml:"size"`
+	Wait time.Duration `yaml:"wait"`
+}
+
+type OutboxConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval"`
+	MaxBackoff   time.Duration `yaml:"max_backoff"`
+	BatchSize    int           `yaml:"batch_size"`
+	// Retention is how long sent messages are kept before they are purged.
+	Retention time.Duration `yaml:"retention"`
+}
+
+func defaults() Config {
+	return Config{
+		HTTP: HTTPConfig{Addr: ":8081"},
+		Kafka: KafkaConfig{
+			Version:     sarama.DefaultVersion.String(),
+			ChangeTopic: "skill-changes",
+		},
+		Retry: RetryConfig{
+			Attempts:   3,
+			Backoff:    200 * time.Millisecond,
+			MaxBackoff: 5 * time.Second,
+		},
+		Batch: BatchConfig{Size: 1, Wait: 100 * time.Millisecond},
+		Outbox: OutboxConfig{
+			PollInterval: 500 * time.Millisecond,
+			MaxBackoff:   30 * time.Second,
+			BatchSize:    100,
+			Retention:    7 * 24 * time.Hour,
+		},
+		Tracing: tracing.Config{Exporter: "none", ServiceName: "skill-consumer"},
+	}
+}
+
+var settings = append([]configload.Setting[Config]{
+	{Key: "http.addr", Env: "HTTP_ADDR", Flag: "http-addr", Usage: "address of the metrics and health listener", Set: configload.String(func(c *Config) *string { return &c.HTTP.Addr })},
+	{Key: "database.url", Env: "DATABASE_URL", Flag: "database-url", Usage: "postgres connection string", Set: configload.String(func(c *Config) *string { return &c.Database.URL })},
+	{Key: "kafka.brokers", Env: "KAFKA_BROKER", Flag: "kafka-brokers", Usage: "comma separated kafka brokers", Set: configload.List(func(c *Config) *[]string { return &c.Kafka.Brokers })},
+	{Key: "kafka.version", Env: "KAFKA_VERSION", Flag: "kafka-version", Usage: "kafka cluster version", Set: configload.String(func(c *Config) *string { return &c.Kafka.Version })},
+	{Key: "kafka.group", Env: "GROUP", Flag: "group", Usage: "consumer group", Set: configload.String(func(c *Config) *string { return &c.Kafka.Group })},
+	{Key: "kafka.topics", Env: "TOPIC", Flag: "topics", Usage: "comma separated topics to consume", Set: configload.List(func(c *Config) *[]string { return &c.Kafka.Topics })},
+	{Key: "kafka.oldest", Env: "KAFKA_OLDEST", Flag: "oldest", Usage: "start a new group at the oldest offset", Set: configload.Bool(func(c *Config) *bool { return &c.Kafka.Oldest }), IsBool: true},
+	{Key: "kafka.verbose", Env: "KAFKA_VERBOSE", Flag: "verbose", Usage: "log sarama internals", Set: configload.Bool(func(c *Config) *bool { return &c.Kafka.Verbose }), IsBool: true},
+	{Key: "kafka.dead_letter_topic", Env: "DEAD_LETTER_TOPIC", Flag: "dead-letter-topic", Usage: "topic of the messages that can't be applied", Set: configload.String(func(c *Config) *string { return &c.Kafka.DeadLetterTopic })},
+	{Key: "kafka.reply_topic", Env: "REPLY_TOPIC", Flag: "reply-topic", Usage: "topic of the command results", Set: configload.String(func(c *Config) *string { return &c.Kafka.ReplyTopic })},
+	{Key: "kafka.change_topic", Env: "CHANGE_TOPIC", Flag: "change-topic", Usage: "topic of the skill domain events", Set: configload.String(func(c *Config) *string { return &c.Kafka.ChangeTopic })},
+	{Key: "retry.attempts", Env: "RETRY_ATTEMPTS", Flag: "retry-attempts", Usage: "attempts before a message is dead-lettered", Set: configload.Int(func(c *Config) *int { return &c.Retry.Attempts })},
+	{Key: "retry.backoff", Env: "RETRY_BACKOFF", Flag: "retry-backoff", Usage: "wait after the first failed attempt", Set: configload.Duration(func(c *Config) *time.Duration { return &c.Retry.Backoff })},
+	{Key: "retry.max_backoff", Env: "RETRY_MAX_BACKOFF", Flag: "retry-max-backoff", Usage: "longest wait between attempts", Set: configload.Duration(func(c *Config) *time.Duration { return &c.Retry.MaxBackoff })},
+	{Key: "batch.size", Env: "CONSUMER_BATCH_SIZE", Flag: "batch-size", Usage: "messages applied per transaction", Set: configload.Int(func(c *Config) *int { return &c.Batch.Size })},
+	{Key: "batch.wait", Env: "CONSUMER_BATCH_WAIT", Flag: "batch-wait", Usage: "how long a batch waits to fill", Set: configload.Duration(func(c *Config) *time.Duration { return &c.Batch.Wait })},
+	{Key: "outbox.poll_interval", Env: "OUTBOX_POLL_INTERVAL", Flag: "outbox-poll-interval", Usage: "how often the outbox is polled", Set: configload.Duration(func(c *Config) *time.Duration { return &c.Outbox.PollInterval })},
+	{Key: "outbox.max_backoff", Env: "OUTBOX_MAX_BACKOFF", Flag: "outbox-max-backoff", Usage: "longest wait between failed relays", Set: configload.Duration(func(c *Config) *time.Duration { return &c.Outbox.MaxBackoff })},
+	{Key: "outbox.batch_size", Env: "OUTBOX_BATCH_SIZE", Flag: "outbox-batch-size", Usage: "messages relayed per poll", Set: configload.Int(func(c *Config) *int { return &c.Outbox.BatchSize })},
+	{Key: "outbox.retention", Env: "OUTBOX_RETENTION", Flag: "outbox-retention", Usage: "how long sent messages are kept", Set: configload.Duration(func(c *Config) *time.Duration { return &c.Outbox.Retention })},
+	{Key: "tracing.exporter", Env: "TRACING_EXPORTER", Flag: "tracing-exporter", Usage: "span exporter: none, stdout or otlp", Set: configload.String(func(c *Config) *string { return &c.Tracing.Exporter })},
+	{Key: "tracing.endpoint", Env: "TRACING_ENDPOINT", Flag: "tracing-endpoint", Usage: "host:port of the OTLP HTTP collector", Set: configload.String(func(c *Config) *string { return &c.Tracing.Endpoint })},
+	{Key: "tracing.insecure", Env: "TRACING_INSECURE", Flag: "tracing-insecure", Usage: "send spans over plain HTTP", Set: configload.Bool(func(c *Config) *bool { return &c.Tracing.Insecure }), IsBool: true},
+	{Key: "tracing.service_name", Env: "OTEL_SERVICE_NAME", Flag: "service-name", Usage: "service name on the spans", Set: configload.String(func(c *Config) *string { return &c.Tracing.ServiceName })},
+}, securitySettings...)
+
+// derive fills the values that default to others.
+func (c *Config) derive() {
+	if len(c.Kafka.Topics) == 0 {
+		return
+	}
+	if c.Kafka.DeadLetterTopic == "" {
+		c.Kafka.DeadLetterTopic = c.Kafka.Topics[0] + ".dlq"
+	}
+	if c.Kafka.ReplyTopic == "" {
+		c.Kafka.ReplyTopic = c.Kafka.Topics[0] + ".reply"
+	}
+}
+
+// Validate reports every value that is missing or out of range.
+func (c Config) Validate() error {
+	problems := []error{}
+	if c.HTTP.Addr == "" {
+		problems = append(problems, configload.Required("http.addr"))
+	}
+	if c.Database.URL == "" {
+		problems = append(problems, configload.Required("database.url"))
+	}
+	if len(c.Kafka.Brokers) == 0 {
+		problems = append(problems, configload.Required("kafka.brokers"))
+	}
+	if _, err := sarama.ParseKafkaVersion(c.Kafka.Version); err != nil {
+		problems = append(problems, configload.Invalid("kafka.version", "must be a kafka version such as "+sarama.DefaultVersion.String()))
+	}
+	if c.Kafka.Group == "" {
+		problems = append(problems, configload.Required("kafka.group"))
+	}
+	if len(c.Kafka.Topics) == 0 {
+		problems = append(problems, configload.Required("kafka.topics"))
+	}
+	if c.Kafka.ChangeTopic == "" {
+		problems = append(problems, configload.Required("kafka.change_topic"))
+	}
+	problems = append(problems, kafkasecurity.Validate(c.Kafka.TLS, c.Kafka.SASL)...)
+	if c.Retry.Attempts < 1 {
+		problems = append(problems, configload.Invalid("retry.attempts", "must be at least 1"))
+	}
+	if c.Retry.Backoff <= 0 {
+		problems = append(problems, configload.Invalid("retry.backoff", "must be positive"))
+	}
+	if c.Retry.MaxBackoff <= 0 {
+		problems = append(problems, configload.Invalid("retry.max_backoff", "must be positive"))
+	}
+	if c.Batch.Size < 1 {
+		problems = append(problems, configload.Invalid("batch.size", "must be at least 1"))
+	}
+	if c.Batch.Wait <= 0 {
+		problems = append(problems, configload.Invalid("batch.wait", "must be positive"))
+	}
+	if c.Outbox.PollInterval <= 0 {
+		problems = append(problems, configload.Invalid("outbox.poll_interval", "must be positive"))
+	}
+	if c.Outbox.MaxBackoff <= 0 {
+		problems = append(problems, configload.Invalid("outbox.max_backoff", "must be positive"))
+	}
+	if c.Outbox.BatchSize < 1 {
+		problems = append(problems, configload.Invalid("outbox.batch_size", "must be at least 1"))
+	}
+	if c.Outbox.Retention <= 0 {
+		problems = append(problems, configload.Invalid("outbox.retention", "must be positive"))
+	}
+	problems = append(problems, tracing.Validate(c.Tracing)...)
+	return errors.Join(problems...)
+}
+
+// Load reads the configuration from the YAML file named by -config or
+// CONFIG_FILE, if any, then the environment, then args, and validates it.
+func Load(args []string) (Config, error) {
+	cfg := defaults()
+	err := configload.Load(&cfg, args, settings, func(c *Config) error {
+		c.derive()
+		return c.Validate()
+	})
+	return cfg, err
+}
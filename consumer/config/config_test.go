@@ -0,0 +1,76 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setRequired(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/app")
+	t.Setenv("KAFKA_BROKER", "kafka:9092")
+	t.Setenv("GROUP", "group1")
+	t.Setenv("TOPIC", "skills,skills-v2")
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("should derive the reply and dead-letter topics from the first topic", func(t *testing.T) {
+		//arange
+		setRequired(t)
+
+		//act
+		cfg, err := Load(nil)
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"skills", "skills-v2"}, cfg.Kafka.Topics)
+		assert.Equal(t, "skills.dlq", cfg.Kafka.DeadLetterTopic)
+		assert.Equal(t, "skills.reply", cfg.Kafka.ReplyTopic)
+		assert.Equal(t, 3, cfg.Retry.Attempts)
+		assert.Equal(t, 1, cfg.Batch.Size)
+		assert.Equal(t, 7*24*time.Hour, cfg.Outbox.Retention)
+	})
+	t.Run("should read the file, then the environment, then the flags", func(t *testing.T) {
+		//arange
+		setRequired(t)
+		path := filepath.Join(t.TempDir(), "consumer.yaml")
+		os.WriteFile(path, []byte("kafka:\n  oldest: true\n  reply_topic: replies\nbatch:\n  size: 50\n  wait: 20ms\n"), 0o600)
+		t.Setenv("CONFIG_FILE", path)
+		t.Setenv("CONSUMER_BATCH_SIZE", "100")
+
+		//act
+		cfg, err := Load([]string{"-verbose", "-retry-attempts", "5"})
+
+		//assert
+		assert.NoError(t, err)
+		assert.True(t, cfg.Kafka.Oldest)
+		assert.True(t, cfg.Kafka.Verbose)
+		assert.Equal(t, "replies", cfg.Kafka.ReplyTopic)
+		assert.Equal(t, 100, cfg.Batch.Size)
+		assert.Equal(t, 20*time.Millisecond, cfg.Batch.Wait)
+		assert.Equal(t, 5, cfg.Retry.Attempts)
+	})
+	t.Run("should report every missing or invalid value", func(t *testing.T) {
+		//arange
+		t.Setenv("DATABASE_URL", "")
+		t.Setenv("KAFKA_BROKER", "kafka:9092")
+		t.Setenv("GROUP", "")
+		t.Setenv("TOPIC", "skills")
+		t.Setenv("KAFKA_VERSION", "latest")
+		t.Setenv("TRACING_EXPORTER", "otlp")
+
+		//act
+		_, err := Load([]string{"-batch-size", "0", "-outbox-retention", "0s"})
+
+		//assert
+		assert.ErrorContains(t, err, "database.url is required, set DATABASE_URL, -database-url or database.url in the config file")
+		assert.ErrorContains(t, err, "kafka.group is required")
+		assert.ErrorContains(t, err, "kafka.version must be a kafka version")
+		assert.ErrorContains(t, err, "batch.size must be at least 1")
+		assert.ErrorContains(t, err, "outbox.retention must be positive")
+		assert.ErrorContains(t, err, "tracing.endpoint is required, set TRACING_ENDPOINT")
+	})
+}
@@ -3,32 +3,70 @@ package config
 import (
 	"log"
 	"os"
-	"strings"
+	"platform/kafkasecurity"
 
 	"github.com/IBM/sarama"
 )
 
-var (
-	brokers = os.Getenv("KAFKA_BROKER")
-	version = sarama.DefaultVersion.String()
-	group   = os.Getenv("GROUP")
-	topics  = os.Getenv("TOPIC")
-	verbose = false
-	oldest  = false
-)
+func InitConsumerGroup(cfg KafkaConfig) sarama.ConsumerGroup {
 
-func InitConsumerGroup() sarama.ConsumerGroup {
+	if cfg.Verbose {
+		sarama.Logger = log.New(os.Stdout, "[sarama] ", log.LstdFlags)
+	}
 
+	config, err := consumerConfig(cfg)
+	if err != nil {
+		log.Panicf("consumer config: %v", err)
+	}
+
+	client, err := sarama.NewConsumerGroup(cfg.Brokers, cfg.Group, config)
+	if err != nil {
+		log.Panicf("new client: %v", err)
+	}
+
+	return client
+}
+
+func consumerConfig(cfg KafkaConfig) (*sarama.Config, error) {
 	config := sarama.NewConfig()
-	if oldest {
+	version, err := sarama.ParseKafkaVersion(cfg.Version)
+	if err != nil {
+		return nil, err
+	}
+	config.Version = version
+	if cfg.Oldest {
 		config.Consumer.Offsets.Initial = sarama.OffsetOldest
 	}
 	config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRoundRobin()}
+	if err := kafkasecurity.Apply(config, cfg.TLS, cfg.SASL); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// InitProducer returns the producer for the dead-letter and reply topics.
+func InitProducer(cfg KafkaConfig) sarama.SyncProducer {
 
-	client, err := sarama.NewConsumerGroup(strings.Split(brokers, ","), group, config)
+	config, err := producerConfig(cfg)
 	if err != nil {
-		log.Panicf("new client: %v", err)
+		log.Panicf("producer config: %v", err)
 	}
 
-	return client
+	producer, err := sarama.NewSyncProducer(cfg.Brokers, config)
+	if err != nil {
+		log.Panicf("new producer: %v", err)
+	}
+
+	return producer
+}
+
+func producerConfig(cfg KafkaConfig) (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	if err := kafkasecurity.Apply(config, cfg.TLS, cfg.SASL); err != nil {
+		return nil, err
+	}
+	return config, nil
 }
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"platform/kafkasecurity"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsumerConfig(t *testing.T) {
+	t.Run("should stay plaintext without TLS or SASL", func(t *testing.T) {
+		//act
+		config, err := consumerConfig(KafkaConfig{Version: sarama.DefaultVersion.String(), Oldest: true})
+
+		//assert
+		assert.NoError(t, err)
+		assert.False(t, config.Net.TLS.Enable)
+		assert.False(t, config.Net.SASL.Enable)
+		assert.Equal(t, sarama.OffsetOldest, config.Consumer.Offsets.Initial)
+		assert.NoError(t, config.Validate())
+	})
+	t.Run("should apply the TLS and SASL settings", func(t *testing.T) {
+		//act
+		config, err := consumerConfig(KafkaConfig{
+			Version: sarama.DefaultVersion.String(),
+			TLS:     kafkasecurity.TLSConfig{Enabled: true, InsecureSkipVerify: true},
+			SASL:    kafkasecurity.SASLConfig{Mechanism: "SCRAM-SHA-512", User: "skill", Password: "secret"},
+		})
+
+		//assert
+		assert.NoError(t, err)
+		assert.True(t, config.Net.TLS.Enable)
+		assert.Equal(t, sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA512), config.Net.SASL.Mechanism)
+		assert.NoError(t, config.Validate())
+	})
+}
+
+func TestProducerConfig(t *testing.T) {
+	t.Run("should apply the TLS and SASL settings", func(t *testing.T) {
+		//act
+		config, err := producerConfig(KafkaConfig{
+			TLS:  kafkasecurity.TLSConfig{Enabled: true, InsecureSkipVerify: true},
+			SASL: kafkasecurity.SASLConfig{Mechanism: "PLAIN", User: "skill", Password: "secret"},
+		})
+
+		//assert
+		assert.NoError(t, err)
+		assert.True(t, config.Net.TLS.Enable)
+		assert.Equal(t, sarama.SASLMechanism(sarama.SASLTypePlaintext), config.Net.SASL.Mechanism)
+		assert.NoError(t, config.Validate())
+	})
+}
+
+func TestSecuritySettings(t *testing.T) {
+	t.Run("should tell which env variable sets a missing credential", func(t *testing.T) {
+		//arange
+		setRequired(t)
+		t.Setenv("KAFKA_TLS_KEY_FILE", "client-key.pem")
+		t.Setenv("KAFKA_SASL_MECHANISM", "PLAIN")
+
+		//act
+		_, err := Load(nil)
+
+		//assert
+		assert.ErrorContains(t, err, "kafka.tls needs both cert_file and key_file")
+		assert.ErrorContains(t, err, "kafka.sasl.user is required, set KAFKA_SASL_USER")
+	})
+}
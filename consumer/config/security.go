@@ -0,0 +1,16 @@
+package config
+
+import "platform/configload"
+
+// securitySettings map the env variables and flags of the TLS and SASL
+// settings onto Config. kafkasecurity checks and applies them.
+var securitySettings = []configload.Setting[Config]{
+	{Key: "kafka.tls.enabled", Env: "KAFKA_TLS_ENABLED", Flag: "kafka-tls", Usage: "connect to kafka over TLS", Set: configload.Bool(func(c *Config) *bool { return &c.Kafka.TLS.Enabled }), IsBool: true},
+	{Key: "kafka.tls.ca_file", Env: "KAFKA_TLS_CA_FILE", Flag: "kafka-tls-ca-file", Usage: "PEM file of the CA that signed the brokers", Set: configload.String(func(c *Config) *string { return &c.Kafka.TLS.CAFile })},
+	{Key: "kafka.tls.cert_file", Env: "KAFKA_TLS_CERT_FILE", Flag: "kafka-tls-cert-file", Usage: "PEM file of the client certificate", Set: configload.String(func(c *Config) *string { return &c.Kafka.TLS.CertFile })},
+	{Key: "kafka.tls.key_file", Env: "KAFKA_TLS_KEY_FILE", Flag: "kafka-tls-key-file", Usage: "PEM file of the client key", Set: configload.String(func(c *Config) *string { return &c.Kafka.TLS.KeyFile })},
+	{Key: "kafka.tls.insecure_skip_verify", Env: "KAFKA_TLS_INSECURE_SKIP_VERIFY", Flag: "kafka-tls-insecure-skip-verify", Usage: "accept any broker certificate, for dev only", Set: configload.Bool(func(c *Config) *bool { return &c.Kafka.TLS.InsecureSkipVerify }), IsBool: true},
+	{Key: "kafka.sasl.mechanism", Env: "KAFKA_SASL_MECHANISM", Flag: "kafka-sasl-mechanism", Usage: "PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512", Set: configload.String(func(c *Config) *string { return &c.Kafka.SASL.Mechanism })},
+	{Key: "kafka.sasl.user", Env: "KAFKA_SASL_USER", Flag: "kafka-sasl-user", Usage: "SASL user", Set: configload.String(func(c *Config) *string { return &c.Kafka.SASL.User })},
+	{Key: "kafka.sasl.password", Env: "KAFKA_SASL_PASSWORD", Flag: "kafka-sasl-password", Usage: "SASL password", Set: configload.String(func(c *Config) *string { return &c.Kafka.SASL.Password })},
+}
@@ -4,32 +4,20 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
-	"os"
+	"platform/schema"
 
 	_ "github.com/lib/pq"
 )
 
-func ConnectDB() *sql.DB {
-	db, err := sql.Open("postgres", os.Getenv("DATABASE_URL"))
+func ConnectDB(url string) *sql.DB {
+	db, err := sql.Open("postgres", url)
 	if err != nil {
 		log.Fatal("Connect to database error", err)
 	}
 
 	fmt.Println("Database connected")
 
-	createTb := `
-		CREATE TABLE IF NOT EXISTS skill (
-		key TEXT PRIMARY KEY,
-		name TEXT NOT NULL DEFAULT '',
-		description TEXT NOT NULL DEFAULT '',
-		logo TEXT NOT NULL DEFAULT '',
-		tags TEXT [] NOT NULL DEFAULT '{}'
-	);
-
-	`
-	_, err = db.Exec(createTb)
-
-	if err != nil {
+	if err := schema.Apply(db); err != nil {
 		log.Fatal("can't create table", err)
 	}
 
@@ -0,0 +1,58 @@
+// Package metrics holds the Prometheus collectors of the consumer and serves
+// them on /metrics.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	MessagesProcessed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "consumer_messages_processed_total",
+		Help: "Messages applied, by action.",
+	}, []string{"action"})
+
+	// MessagesFailed counts the messages that were not applied, by action
+	// and by outcome, rejected or failed.
+	MessagesFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "consumer_messages_failed_total",
+		Help: "Messages not applied, by action and outcome.",
+	}, []string{"action", "outcome"})
+
+	// ProcessingDuration is the time to settle a message, retries included.
+	// In batching mode it is the time to settle its whole batch.
+	ProcessingDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "consumer_processing_duration_seconds",
+		Help:    "Time to settle a message, by action.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"action"})
+
+	// Lag is how many messages of a partition are behind the last one
+	// settled by this consumer.
+	Lag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "consumer_lag",
+		Help: "Messages behind the high water mark, by topic and partition.",
+	}, []string{"topic", "partition"})
+)
+
+// Registry holds the collectors above and the Go runtime and process ones.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		MessagesProcessed,
+		MessagesFailed,
+		ProcessingDuration,
+		Lag,
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,29 @@
+package outbox
+
+import "time"
+
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusSent    Status = "sent"
+)
+
+// Message is a skill change waiting to be published. It is written in the
+// same transaction as the change itself.
+type Message struct {
+	ID        string
+	Key       string
+	Version   int64
+	Type      string
+	Payload   []byte
+	Status    Status
+	Attempts  int
+	LastError string
+	CreatedAt time.Time
+}
+
+// OutboxID and OutboxKey let the relay publish the events of a skill in
+// order.
+func (m Message) OutboxID() string  { return m.ID }
+func (m Message) OutboxKey() string { return m.Key }
@@ -0,0 +1,77 @@
+package outbox
+
+import (
+	"savedb/database"
+	"time"
+)
+
+type outboxRepo struct {
+	db database.DBTX
+}
+
+type OutboxRepo interface {
+	Enqueue(msg Message) (*Message, error)
+	FetchPending(limit int) ([]Message, error)
+	MarkSent(id string) error
+	MarkFailed(id string, message string) error
+	Purge(before time.Time) (int64, error)
+}
+
+func NewOutboxRepo(db database.DBTX) *outboxRepo {
+	return &outboxRepo{db: db}
+}
+
+func (r *outboxRepo) Enqueue(msg Message) (*Message, error) {
+	msg.Status = StatusPending
+	msg.CreatedAt = time.Now().UTC()
+	query := "INSERT INTO change_outbox (id, skill_key, version, type, payload, status, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)"
+	_, err := r.db.Exec(query, msg.ID, msg.Key, msg.Version, msg.Type, string(msg.Payload), msg.Status, msg.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func (r *outboxRepo) FetchPending(limit int) ([]Message, error) {
+	msgs := []Message{}
+	query := "SELECT id, skill_key, version, type, payload, status, attempts, last_error, created_at FROM change_outbox WHERE status=$1 ORDER BY seq LIMIT $2"
+	records, err := r.db.Query(query, StatusPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer records.Close()
+	for records.Next() {
+		msg := Message{}
+		var payload string
+		err := records.Scan(&msg.ID, &msg.Key, &msg.Version, &msg.Type, &payload, &msg.Status, &msg.Attempts, &msg.LastError, &msg.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		msg.Payload = []byte(payload)
+		msgs = append(msgs, msg)
+	}
+	return msgs, records.Err()
+}
+
+func (r *outboxRepo) MarkSent(id string) error {
+	query := "UPDATE change_outbox SET status=$1, sent_at=$2 WHERE id=$3"
+	_, err := r.db.Exec(query, StatusSent, time.Now().UTC(), id)
+	return err
+}
+
+func (r *outboxRepo) MarkFailed(id string, message string) error {
+	query := "UPDATE change_outbox SET attempts=attempts+1, last_error=$1 WHERE id=$2"
+	_, err := r.db.Exec(query, message, id)
+	return err
+}
+
+// Purge deletes the messages sent before the given time. Pending messages
+// are kept however old they are.
+func (r *outboxRepo) Purge(before time.Time) (int64, error) {
+	query := "DELETE FROM change_outbox WHERE status=$1 AND sent_at < $2"
+	result, err := r.db.Exec(query, StatusSent, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
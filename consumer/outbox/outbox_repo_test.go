@@ -0,0 +1,77 @@
+package outbox_test
+
+import (
+	"database/sql"
+	"savedb/outbox"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func newMockDB() *sql.DB {
+	db, _ := sql.Open("sqlite", "file:change_outbox?mode=memory&cache=shared")
+	q := `
+		CREATE TABLE IF NOT EXISTS change_outbox (
+		seq INTEGER PRIMARY KEY AUTOINCREMENT,
+		id TEXT NOT NULL UNIQUE,
+		skill_key TEXT NOT NULL,
+		version BIGINT NOT NULL,
+		type TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		sent_at TIMESTAMP,
+		UNIQUE (skill_key, version)
+	);
+	`
+	db.Exec(q)
+	return db
+}
+
+func TestEnqueueRepo(t *testing.T) {
+	//arange
+	db := newMockDB()
+	defer db.Close()
+	repo := outbox.NewOutboxRepo(db)
+
+	//act
+	_, err := repo.Enqueue(outbox.Message{ID: "go:1", Key: "go", Version: 1, Type: "SkillCreated", Payload: []byte(`{}`)})
+
+	//assert
+	if err != nil {
+		t.Errorf("expected error to be nil but got %v", err)
+	}
+	pending, _ := repo.FetchPending(10)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "go:1", pending[0].ID)
+	assert.Equal(t, "go", pending[0].Key)
+	assert.Equal(t, int64(1), pending[0].Version)
+	assert.Equal(t, "SkillCreated", pending[0].Type)
+	assert.Equal(t, outbox.StatusPending, pending[0].Status)
+}
+
+func TestPurgeRepo(t *testing.T) {
+	//arange
+	db := newMockDB()
+	defer db.Close()
+	repo := outbox.NewOutboxRepo(db)
+	repo.Enqueue(outbox.Message{ID: "go:1", Key: "go", Version: 1, Type: "SkillCreated", Payload: []byte(`{}`)})
+	repo.Enqueue(outbox.Message{ID: "go:2", Key: "go", Version: 2, Type: "SkillUpdated", Payload: []byte(`{}`)})
+	repo.MarkSent("go:1")
+
+	//act
+	kept, _ := repo.Purge(time.Now().UTC().Add(-time.Hour))
+	purged, err := repo.Purge(time.Now().UTC().Add(time.Hour))
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), kept)
+	assert.Equal(t, int64(1), purged)
+	pending, _ := repo.FetchPending(10)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "go:2", pending[0].ID)
+}
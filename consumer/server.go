@@ -7,49 +7,68 @@ import (
 	_ "fmt"
 	"log"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"platform/health"
+	"platform/relay"
+	"platform/tracing"
 	"savedb/config"
 	"savedb/database"
+	"savedb/metrics"
+	"savedb/outbox"
 	"savedb/skill"
-	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/IBM/sarama"
 )
 
-// Sarama configuration options
-var (
-	brokers = os.Getenv("KAFKA_BROKER")
-	version = sarama.DefaultVersion.String()
-	group   = os.Getenv("GROUP")
-	topics  = os.Getenv("TOPIC")
-	verbose = false
-	oldest  = false
-)
+func main() {
 
-func init() {
-	if len(brokers) == 0 {
-		panic("no Kafka bootstrap brokers defined, please set the -brokers flag")
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalln(err)
 	}
-	if len(topics) == 0 {
-		panic("no topics given to be consumed, please set the -topics flag")
-	}
-	if len(group) == 0 {
-		panic("no Kafka consumer group defined, please set the -group flag")
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatalln(err)
 	}
-}
-func main() {
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("flushing spans: %v", err)
+		}
+	}()
 
-	db := database.ConnectDB()
+	db := database.ConnectDB(cfg.Database.URL)
 	defer db.Close()
 
 	skillRepo := skill.NewSkillRepo(db)
 	skillEventHandler := skill.NewSkillEventHandler(skillRepo)
-	skillConsumer := skill.NewConsumerGroup(skillEventHandler)
 
-	client := config.InitConsumerGroup()
+	producer := config.InitProducer(cfg.Kafka)
+	defer func() {
+		if err := producer.Close(); err != nil {
+			log.Printf("closing producer: %v", err)
+		}
+	}()
+
+	retryPolicy := skill.RetryPolicy{
+		MaxAttempts:    cfg.Retry.Attempts,
+		InitialBackoff: cfg.Retry.Backoff,
+		MaxBackoff:     cfg.Retry.MaxBackoff,
+	}
+	deadLetter := skill.NewDeadLetterProducer(producer, cfg.Kafka.DeadLetterTopic)
+	results := skill.NewReplyProducer(producer, cfg.Kafka.ReplyTopic, skillRepo)
+	commandRepo := skill.NewCommandRepo(db)
+	skillConsumer := skill.NewConsumerGroup(skillEventHandler, retryPolicy, deadLetter, commandRepo, results).
+		WithBatching(skill.BatchPolicy{Size: cfg.Batch.Size, Wait: cfg.Batch.Wait})
+
+	client := config.InitConsumerGroup(cfg.Kafka)
 	defer func() {
 		if err := client.Close(); err != nil {
 			log.Panicf("closing client: %v", err)
@@ -59,10 +78,29 @@ func main() {
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	ctx, gracefully := context.WithCancel(context.Background())
+
+	outboxRelay := relay.NewRelay[outbox.Message](
+		outbox.NewOutboxRepo(db),
+		skill.NewChangeProducer(producer, cfg.Kafka.ChangeTopic),
+		cfg.Outbox.PollInterval,
+		cfg.Outbox.MaxBackoff,
+		cfg.Outbox.BatchSize,
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		outboxRelay.Run(ctx)
+	}()
+	retention := relay.NewRetention().Add("change_outbox", outbox.NewOutboxRepo(db), cfg.Outbox.Retention)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		retention.Run(ctx)
+	}()
 	go func() {
 		defer wg.Done()
 		for {
-			if err := client.Consume(ctx, strings.Split(topics, ","), skillConsumer); err != nil {
+			if err := client.Consume(ctx, cfg.Kafka.Topics, skillConsumer); err != nil {
 				if errors.Is(err, sarama.ErrClosedConsumerGroup) {
 					return
 				}
@@ -81,6 +119,21 @@ func main() {
 			skillConsumer.NewReady()
 		}
 	}()
+	checker := health.NewChecker(2*time.Second).
+		Add("database", health.Database(db)).
+		Add("group", skillConsumer.CheckSession).
+		Detail("group", func() any { return skillConsumer.Status() })
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", health.Liveness)
+	mux.HandleFunc("/readyz", checker.Readiness)
+	srv := &http.Server{Addr: cfg.HTTP.Addr, Handler: mux}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("http listener: %v", err)
+		}
+	}()
+
 	<-skillConsumer.Ready()
 	slog.Info("consumer up and running...")
 	sigCtx, unregistered := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
@@ -97,8 +150,15 @@ keepRunning:
 			break keepRunning
 		}
 	}
+	// The probe stays up while the consumer drains, reporting it unready.
+	checker.Drain()
 	gracefully()
 	wg.Wait() // waiting for gracefully consumer stopping
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("closing http listener: %v", err)
+	}
 	if err := client.Close(); err != nil {
 		log.Panicf("closing client: %v", err)
 	}
@@ -6,4 +6,5 @@ type Skill struct {
 	Description string   `json:"description" default:""`
 	Logo        string   `json:"logo" default:""`
 	Tags        []string `json:"tags" default:"{}"`
+	Version     int64    `json:"version,omitempty"`
 }
@@ -0,0 +1,84 @@
+package skill
+
+import (
+	"encoding/json"
+	"skillevent"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// AuditSource is the kafka message an event was consumed from.
+type AuditSource struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+}
+
+func auditSource(msg *sarama.ConsumerMessage) AuditSource {
+	return AuditSource{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset}
+}
+
+// FieldChange is one skill field before and after an event. From is nil when
+// the skill was created and To is nil when it was deleted.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// diffSkills lists the fields that differ between before and after, where nil
+// is a skill that does not exist.
+func diffSkills(before *Skill, after *Skill) []FieldChange {
+	changes := []FieldChange{}
+	add := func(field string, from any, to any) {
+		fromJSON, _ := json.Marshal(from)
+		toJSON, _ := json.Marshal(to)
+		if string(fromJSON) != string(toJSON) {
+			changes = append(changes, FieldChange{Field: field, From: from, To: to})
+		}
+	}
+	fields := func(skill *Skill) []any {
+		if skill == nil {
+			return []any{nil, nil, nil, nil}
+		}
+		return []any{skill.Name, skill.Description, skill.Logo, skill.Tags}
+	}
+	from, to := fields(before), fields(after)
+	for i, field := range []string{"name", "description", "logo", "tags"} {
+		add(field, from[i], to[i])
+	}
+	return changes
+}
+
+// RecordAudit appends who changed the skill, from which message and what
+// changed to skill_audit, along with the skill version after the change, zero
+// once deleted. Like RecordChange it writes nothing when the skill neither
+// existed nor exists.
+func (r *skillRepo) RecordAudit(event skillevent.Envelope, source AuditSource, before *Skill, after *Skill) error {
+	if before == nil && after == nil {
+		return nil
+	}
+	key, version := before, int64(0)
+	if after != nil {
+		key, version = after, after.Version
+	}
+
+	metadata := []byte("{}")
+	if event.Metadata != nil {
+		metadata, _ = json.Marshal(event.Metadata)
+	}
+	diff, err := json.Marshal(diffSkills(before, after))
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	occurredAt := event.OccurredAt
+	if occurredAt.IsZero() {
+		occurredAt = now
+	}
+
+	query := "INSERT INTO skill_audit (skill_key, action, version, actor, event_id, correlation_id, source_topic, source_partition, source_offset, metadata, diff, occurred_at, recorded_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)"
+	_, err = r.db.Exec(query, key.Key, string(event.Type), version, event.Actor, event.ID, event.CorrelationID, source.Topic, source.Partition, source.Offset, string(metadata), string(diff), occurredAt, now)
+	return err
+}
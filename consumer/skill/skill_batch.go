@@ -0,0 +1,254 @@
+package skill
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"skillevent"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// BatchPolicy makes the consumer apply up to Size messages of a claim in one
+// transaction, waiting at most Wait after the first one for the batch to
+// fill. A Size of one or less consumes one message at a time.
+type BatchPolicy struct {
+	Size int
+	Wait time.Duration
+}
+
+func (p BatchPolicy) enabled() bool {
+	return p.Size > 1
+}
+
+// WithBatching sets the batch policy of the consumer.
+func (s *SkillConsumer) WithBatching(policy BatchPolicy) *SkillConsumer {
+	s.batching = policy
+	return s
+}
+
+// consumeBatches is ConsumeClaim in batching mode. A batch is marked only
+// once it is committed and its results are sent, otherwise it is redelivered
+// after the rebalance and its applied events are skipped as duplicates.
+func (s *SkillConsumer) consumeBatches(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		batch, open := s.nextBatch(sess.Context(), claim.Messages())
+		if len(batch) > 0 {
+			if err := s.handleBatch(sess.Context(), batch); err != nil {
+				first, last := batch[0], batch[len(batch)-1]
+				slog.Error("could not handle batch", "topic", first.Topic, "partition", first.Partition, "from", first.Offset, "to", last.Offset, "error", err)
+				return err
+			}
+			// Marking the last message commits the offsets of the whole batch.
+			sess.MarkMessage(batch[len(batch)-1], "")
+			recordLag(claim, batch[len(batch)-1])
+		}
+		if !open {
+			break
+		}
+	}
+	return sess.Context().Err()
+}
+
+// nextBatch reads messages until the batch is full or the policy's wait has
+// passed since the first one. It reports false once the channel is closed or
+// the session is done; a batch cut short by the session is dropped, to be
+// redelivered.
+func (s *SkillConsumer) nextBatch(ctx context.Context, messages <-chan *sarama.ConsumerMessage) ([]*sarama.ConsumerMessage, bool) {
+	batch := make([]*sarama.ConsumerMessage, 0, s.batching.Size)
+	var timeout <-chan time.Time
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				slog.Info("message channel was closed")
+				return batch, false
+			}
+			batch = append(batch, msg)
+			if len(batch) >= s.batching.Size {
+				return batch, true
+			}
+			if timeout == nil {
+				timer := time.NewTimer(s.batching.Wait)
+				defer timer.Stop()
+				timeout = timer.C
+			}
+		case <-timeout:
+			return batch, true
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+// handleBatch applies msgs in one transaction and publishes their results.
+// When the batch can't be applied nothing of it is committed, so each
+// message is settled on its own with its retries, conflicts and dead letters.
+func (s *SkillConsumer) handleBatch(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+	start := time.Now()
+	if err := s.skillEventHandler.ProcessBatch(msgs); err != nil {
+		slog.Warn("batch failed, handling its messages one at a time", "size", len(msgs), "error", err)
+		for _, msg := range msgs {
+			if err := s.handleMessage(ctx, msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, msg := range msgs {
+		observe(msg, skillevent.OutcomeApplied, start)
+		updateCommand(s.commandRepo, msg, CommandApplied, "")
+		if err := s.results.PublishResult(msg, skillevent.OutcomeApplied, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProcessBatch applies msgs in order in one transaction. Runs of updates to
+// the same skill are folded in memory and the skill is written once, at the
+// end of the run, while each event still gets its own processed, change and
+// audit record. Any error rolls the whole batch back. The batch gets one span
+// linked to the trace of each message.
+func (s *skillEventHandler) ProcessBatch(msgs []*sarama.ConsumerMessage) (err error) {
+	ctx, span := startBatchSpan(msgs)
+	defer func() { endSpan(span, err) }()
+
+	return traceRepo(ctx, s.skillRepo).ProcessBatch(func(repo SkillRepo) error {
+		b := &eventBatch{handler: &skillEventHandler{skillRepo: repo}, folded: map[string]*Skill{}}
+		for _, msg := range msgs {
+			if err := b.add(msg); err != nil {
+				return err
+			}
+		}
+		return b.flush()
+	})
+}
+
+// eventBatch holds the skills whose updates are folded but not written yet.
+type eventBatch struct {
+	handler *skillEventHandler
+	folded  map[string]*Skill
+	order   []string
+}
+
+func (b *eventBatch) add(msg *sarama.ConsumerMessage) error {
+	event, err := decodeEvent(msg)
+	if err != nil {
+		return invalid(err)
+	}
+	repo := b.handler.skillRepo
+	if err := repo.MarkProcessed(event.ID); errors.Is(err, ErrDuplicateEvent) {
+		log.Printf("Skip duplicate event %s\n", event.ID)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	key := payloadKey(event)
+	update, err := foldedUpdate(event)
+	if err != nil {
+		return err
+	}
+	if update == nil {
+		// Creates and deletes go through the single event path, after the
+		// updates folded so far are written.
+		if err := b.write(key); err != nil {
+			return err
+		}
+		return b.handler.apply(auditSource(msg), event)
+	}
+
+	before, ok := b.folded[key]
+	if !ok {
+		if before, err = b.handler.current(key); err != nil {
+			return err
+		}
+		if before == nil {
+			return fmt.Errorf("skill %s: %w", key, sql.ErrNoRows)
+		}
+	}
+	if event.ExpectedVersion != 0 && event.ExpectedVersion != before.Version {
+		return fmt.Errorf("%w: skill %s is at version %d, expected %d", ErrVersionConflict, key, before.Version, event.ExpectedVersion)
+	}
+	after := *before
+	after.Tags = append([]string{}, before.Tags...)
+	update(&after)
+	after.Version++
+
+	if err := repo.RecordChange(event, before, &after); err != nil {
+		return err
+	}
+	if err := repo.RecordAudit(event, auditSource(msg), before, &after); err != nil {
+		return err
+	}
+	if !ok {
+		b.order = append(b.order, key)
+	}
+	b.folded[key] = &after
+	return nil
+}
+
+// write saves the folded updates of key, if there are any.
+func (b *eventBatch) write(key string) error {
+	skill, ok := b.folded[key]
+	if !ok {
+		return nil
+	}
+	delete(b.folded, key)
+	return b.handler.skillRepo.SaveSkill(*skill)
+}
+
+func (b *eventBatch) flush() error {
+	for _, key := range b.order {
+		if err := b.write(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// foldedUpdate decodes and checks an update event through the same step as
+// its handler and returns the change it makes to the skill. It returns nil
+// for the events that are not updates.
+func foldedUpdate(event skillevent.Envelope) (func(*Skill), error) {
+	switch event.Type {
+	case UpdateSkillAction:
+		skill, err := decodeUpdate(event)
+		if err != nil {
+			return nil, err
+		}
+		return func(s *Skill) {
+			s.Name, s.Description, s.Logo, s.Tags = skill.Name, skill.Description, skill.Logo, skill.Tags
+		}, nil
+	case UpdateNameAction:
+		msg, err := decodeName(event)
+		if err != nil {
+			return nil, err
+		}
+		return func(s *Skill) { s.Name = msg.Name }, nil
+	case UpdateDescAction:
+		msg, err := decodeDescription(event)
+		if err != nil {
+			return nil, err
+		}
+		return func(s *Skill) { s.Description = msg.Description }, nil
+	case UpdateLogoAction:
+		msg, err := decodeLogo(event)
+		if err != nil {
+			return nil, err
+		}
+		return func(s *Skill) { s.Logo = msg.Logo }, nil
+	case UpdateTagsAction:
+		msg, err := decodeTags(event)
+		if err != nil {
+			return nil, err
+		}
+		return func(s *Skill) { s.Tags = msg.Tags }, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,88 @@
+package skill
+
+import (
+	"encoding/json"
+	"log"
+	"savedb/outbox"
+	"skillevent"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// RecordChange queues the domain event for a change from before to after in
+// the change outbox. Nothing is queued when the skill neither existed nor
+// exists, e.g. for the delete of a missing skill.
+func (r *skillRepo) RecordChange(event skillevent.Envelope, before *Skill, after *Skill) error {
+	change := skillevent.Change{
+		CausationID:   event.ID,
+		CorrelationID: event.CorrelationID,
+		OccurredAt:    time.Now().UTC(),
+	}
+	switch {
+	case before == nil && after == nil:
+		return nil
+	case before == nil:
+		change.Type, change.Key = skillevent.SkillCreated, after.Key
+	case after == nil:
+		change.Type, change.Key = skillevent.SkillDeleted, before.Key
+	default:
+		change.Type, change.Key = skillevent.SkillUpdated, after.Key
+	}
+	if before != nil {
+		change.Before, _ = json.Marshal(before)
+	}
+	if after != nil {
+		change.After, _ = json.Marshal(after)
+	}
+
+	// The version is the one the change gave the skill row, which is written
+	// and so locked earlier in this transaction. A delete takes the next one,
+	// the version of the tombstone it left.
+	if after != nil {
+		change.Version = after.Version
+	} else {
+		change.Version = before.Version + 1
+	}
+	change.ID = change.Key + ":" + strconv.FormatInt(change.Version, 10)
+
+	payload, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	_, err = outbox.NewOutboxRepo(r.db).Enqueue(outbox.Message{
+		ID:      change.ID,
+		Key:     change.Key,
+		Version: change.Version,
+		Type:    string(change.Type),
+		Payload: payload,
+	})
+	return err
+}
+
+type changeProducer struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+// NewChangeProducer publishes the change outbox, keyed by skill so the
+// changes of one skill stay in order.
+func NewChangeProducer(producer sarama.SyncProducer, topic string) *changeProducer {
+	return &changeProducer{producer: producer, topic: topic}
+}
+
+func (p *changeProducer) Publish(msg outbox.Message) error {
+	change := &sarama.ProducerMessage{
+		Topic: p.topic,
+		Key:   sarama.StringEncoder(msg.Key),
+		Value: sarama.ByteEncoder(msg.Payload),
+	}
+	partition, offset, err := p.producer.SendMessage(change)
+	if err != nil {
+		log.Printf("FAILED to send change %s: %s\n", msg.ID, err)
+		return err
+	}
+	log.Printf("> change %s sent to partition %d at offset %d\n", msg.ID, partition, offset)
+	return nil
+}
@@ -0,0 +1,52 @@
+package skill
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+type CommandStatus string
+
+const (
+	CommandApplied  CommandStatus = "applied"
+	CommandFailed   CommandStatus = "failed"
+	CommandConflict CommandStatus = "conflict"
+)
+
+type commandRepo struct {
+	db *sql.DB
+}
+
+type CommandRepo interface {
+	UpdateCommandStatus(id string, status CommandStatus, message string) error
+}
+
+func NewCommandRepo(db *sql.DB) CommandRepo {
+	return &commandRepo{db: db}
+}
+
+func (r *commandRepo) UpdateCommandStatus(id string, status CommandStatus, message string) error {
+	query := "UPDATE command SET status=$1, error=$2, updated_at=$3 WHERE id=$4"
+	_, err := r.db.Exec(query, status, message, time.Now().UTC(), id)
+	return err
+}
+
+// updateCommand reports the outcome of a message back to the API. The command
+// id travels as the envelope's correlation id; messages without one, or that
+// can't be decoded at all, are left alone.
+func updateCommand(commandRepo CommandRepo, msg *sarama.ConsumerMessage, status CommandStatus, message string) {
+	event, err := decodeEvent(msg)
+	if err != nil {
+		return
+	}
+	commandID := event.CorrelationID
+	if commandID == "" {
+		return
+	}
+	if err := commandRepo.UpdateCommandStatus(commandID, status, message); err != nil {
+		log.Printf("Error: can't update command %s: %s\n", commandID, err)
+	}
+}
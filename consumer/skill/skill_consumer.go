@@ -1,7 +1,12 @@
 package skill
 
 import (
+	"context"
+	"errors"
 	"log/slog"
+	"skillevent"
+	"sync"
+	"time"
 
 	"github.com/IBM/sarama"
 )
@@ -9,20 +14,47 @@ import (
 type SkillConsumer struct {
 	ready             chan struct{}
 	skillEventHandler SkillEventHandler
+	retryPolicy       RetryPolicy
+	deadLetter        DeadLetterPublisher
+	commandRepo       CommandRepo
+	results           ResultPublisher
+	batching          BatchPolicy
+
+	// mu guards ready and claims, which the health probe reads.
+	mu sync.Mutex
+	// claims are the partitions of the current session, nil between sessions.
+	claims map[string][]int32
 }
 
-func NewConsumerGroup(skillEventHandler SkillEventHandler) *SkillConsumer {
+func NewConsumerGroup(skillEventHandler SkillEventHandler, retryPolicy RetryPolicy, deadLetter DeadLetterPublisher, commandRepo CommandRepo, results ResultPublisher) *SkillConsumer {
 	return &SkillConsumer{
 		ready:             make(chan struct{}),
 		skillEventHandler: skillEventHandler,
+		retryPolicy:       retryPolicy,
+		deadLetter:        deadLetter,
+		commandRepo:       commandRepo,
+		results:           results,
 	}
 }
 
-func (consumer *SkillConsumer) Setup(_ sarama.ConsumerGroupSession) error {
+func (consumer *SkillConsumer) Setup(sess sarama.ConsumerGroupSession) error {
+	consumer.mu.Lock()
+	defer consumer.mu.Unlock()
+	consumer.claims = map[string][]int32{}
+	for topic, partitions := range sess.Claims() {
+		consumer.claims[topic] = append([]int32{}, partitions...)
+	}
 	close(consumer.ready)
 	return nil
 }
-func (*SkillConsumer) Cleanup(_ sarama.ConsumerGroupSession) error {
+
+// Cleanup drops the lag of the partitions the session claimed, since after
+// the rebalance they may belong to another member, which reports them.
+func (consumer *SkillConsumer) Cleanup(_ sarama.ConsumerGroupSession) error {
+	consumer.mu.Lock()
+	defer consumer.mu.Unlock()
+	forgetLag(consumer.claims)
+	consumer.claims = nil
 	return nil
 }
 func (s *SkillConsumer) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
@@ -30,6 +62,9 @@ func (s *SkillConsumer) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sar
 	// Do not move the code below to a goroutine.
 	// The ConsumeClaim itself is called within a goroutine, see:
 	// https://github.com/IBM/sarama/blob/main/consumer_group.go#L27-L29
+	if s.batching.enabled() {
+		return s.consumeBatches(sess, claim)
+	}
 consume:
 	for {
 		select {
@@ -38,8 +73,14 @@ consume:
 				slog.Info("message channel was closed")
 				break consume
 			}
-			s.skillEventHandler.ProcessMessage(msg)
+			// The message is only marked once it is applied or parked on the
+			// dead-letter topic, otherwise it is redelivered after the rebalance.
+			if err := s.handleMessage(sess.Context(), msg); err != nil {
+				slog.Error("could not handle message", "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset, "error", err)
+				return err
+			}
 			sess.MarkMessage(msg, "")
+			recordLag(claim, msg)
 		// Should return when session.Context() is done.
 		// If not, will raise ErrRebalanceInProgress or read tcp <ip>:<port>: i/o timeout when kafka rebalance. see:
 		// https://github.com/IBM/sarama/issues/1192
@@ -50,10 +91,95 @@ consume:
 	return sess.Context().Err()
 }
 
+// handleMessage settles msg and publishes its result. When the result can't
+// be sent the message is not marked; on redelivery it is skipped as a
+// duplicate and only its result is sent again.
+func (s *SkillConsumer) handleMessage(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	start := time.Now()
+	attempt := 1
+	for {
+		err := s.skillEventHandler.ProcessMessage(msg)
+		if err == nil {
+			observe(msg, skillevent.OutcomeApplied, start)
+			updateCommand(s.commandRepo, msg, CommandApplied, "")
+			return s.results.PublishResult(msg, skillevent.OutcomeApplied, nil)
+		}
+		// A stale write will never apply, so it is not retried or parked.
+		if errors.Is(err, ErrVersionConflict) {
+			slog.Warn("rejected stale write", "offset", msg.Offset, "error", err)
+			observe(msg, skillevent.OutcomeRejected, start)
+			updateCommand(s.commandRepo, msg, CommandConflict, err.Error())
+			return s.results.PublishResult(msg, skillevent.OutcomeRejected, err)
+		}
+		// Invalid events are rejected to the dead-letter topic right away,
+		// retrying them can't help.
+		if errors.Is(err, ErrInvalidEvent) || attempt >= s.retryPolicy.MaxAttempts {
+			slog.Warn("sending to dead-letter topic", "offset", msg.Offset, "attempts", attempt, "error", err)
+			if dlqErr := s.deadLetter.PublishDeadLetter(msg, err, attempt); dlqErr != nil {
+				return dlqErr
+			}
+			updateCommand(s.commandRepo, msg, CommandFailed, err.Error())
+			outcome := skillevent.OutcomeFailed
+			if errors.Is(err, ErrInvalidEvent) {
+				outcome = skillevent.OutcomeRejected
+			}
+			observe(msg, outcome, start)
+			return s.results.PublishResult(msg, outcome, err)
+		}
+
+		select {
+		case <-time.After(s.retryPolicy.Backoff(attempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		attempt++
+	}
+}
+
 func (c *SkillConsumer) NewReady() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.ready = make(chan struct{})
 }
 
 func (c *SkillConsumer) Ready() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.ready
 }
+
+// GroupStatus is where the consumer stands in its group.
+type GroupStatus struct {
+	// Live is true while a session is set up and not cleaned up yet.
+	Live       bool               `json:"live"`
+	Partitions map[string][]int32 `json:"partitions"`
+}
+
+// Status reports the current session and the partitions it claims. A
+// session with no partitions is still live, it just has nothing to consume.
+func (c *SkillConsumer) Status() GroupStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := GroupStatus{Partitions: map[string][]int32{}}
+	select {
+	case <-c.ready:
+		status.Live = c.claims != nil
+	default:
+	}
+	for topic, partitions := range c.claims {
+		status.Partitions[topic] = append([]int32{}, partitions...)
+	}
+	return status
+}
+
+// ErrNoSession is reported by the readiness check while the consumer is
+// between group sessions, on start and during rebalances.
+var ErrNoSession = errors.New("no group session")
+
+// CheckSession is the readiness check of the group session.
+func (c *SkillConsumer) CheckSession(_ context.Context) error {
+	if !c.Status().Live {
+		return ErrNoSession
+	}
+	return nil
+}
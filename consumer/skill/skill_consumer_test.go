@@ -1,9 +1,19 @@
 package skill_test
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"savedb/metrics"
+	"savedb/skill"
+	"skillevent"
 	"testing"
+	"time"
 
 	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
 )
 
 type MockEventHandler struct {
@@ -13,30 +23,290 @@ type MockEventHandler struct {
 func (m *MockEventHandler) ProcessMessage(msg *sarama.ConsumerMessage) error {
 	return m.err
 }
-func (m *MockEventHandler) createSkillHandler(msg *sarama.ConsumerMessage) error {
+func (m *MockEventHandler) ProcessBatch(msgs []*sarama.ConsumerMessage) error {
 	return m.err
 }
-func (m *MockEventHandler) updateSkillHandler(msg *sarama.ConsumerMessage) error {
+func (m *MockEventHandler) createSkillHandler(event skillevent.Envelope) error {
+	return m.err
+}
+func (m *MockEventHandler) updateSkillHandler(event skillevent.Envelope) error {
+
+	return m.err
+}
+func (m *MockEventHandler) updateNameHandler(event skillevent.Envelope) error {
 
 	return m.err
 }
-func (m *MockEventHandler) updateNameHandler(msg *sarama.ConsumerMessage) error {
+func (m *MockEventHandler) updateDescriptionHandler(event skillevent.Envelope) error {
 
 	return m.err
 }
-func (m *MockEventHandler) updateDescriptionHandler(msg *sarama.ConsumerMessage) error {
+func (m *MockEventHandler) updateLogoHandler(event skillevent.Envelope) error {
 
 	return m.err
 }
-func (m *MockEventHandler) updateLogoHandler(msg *sarama.ConsumerMessage) error {
+func (m *MockEventHandler) updateTagHandler(event skillevent.Envelope) error {
 
 	return m.err
 }
-func (m *MockEventHandler) updateTagHandler(msg *sarama.ConsumerMessage) error {
+func (m *MockEventHandler) deleteSkillHandler(event skillevent.Envelope) error {
 
 	return m.err
 }
 
+type orderSession struct {
+	sarama.ConsumerGroupSession
+	marked []int64
+	claims map[string][]int32
+}
+
+func (m *orderSession) Claims() map[string][]int32 {
+	return m.claims
+}
+
+func (m *orderSession) Context() context.Context {
+	return context.Background()
+}
+
+func (m *orderSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	m.marked = append(m.marked, msg.Offset)
+}
+
+type replyProducer struct {
+	sarama.SyncProducer
+	results []skillevent.Result
+}
+
+func (m *replyProducer) SendMessage(msg *sarama.ProducerMessage) (partition int32, offset int64, err error) {
+	value, _ := msg.Value.Encode()
+	result := skillevent.Result{}
+	err = json.Unmarshal(value, &result)
+	m.results = append(m.results, result)
+	return 0, int64(len(m.results)), err
+}
+
+type orderClaim struct {
+	sarama.ConsumerGroupClaim
+	msgs      chan *sarama.ConsumerMessage
+	highWater int64
+}
+
+func (m *orderClaim) HighWaterMarkOffset() int64 {
+	return m.highWater
+}
+
+func (m *orderClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return m.msgs
+}
+
+func newSkillMessage(offset int64, eventType skillevent.Type, payload any) *sarama.ConsumerMessage {
+	data, _ := json.Marshal(payload)
+	value, _ := skillevent.Encode(skillevent.Envelope{
+		ID:      fmt.Sprintf("event-%d", offset),
+		Type:    eventType,
+		Payload: data,
+	})
+	return &sarama.ConsumerMessage{Key: []byte("go"), Value: value, Partition: 0, Offset: offset}
+}
+
+func newConsumer(db *sql.DB, replies *replyProducer) *skill.SkillConsumer {
+	return skill.NewConsumerGroup(
+		skill.NewSkillEventHandler(skill.NewSkillRepo(db)),
+		skill.RetryPolicy{MaxAttempts: 1, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		skill.NewDeadLetterProducer(nil, "skills.dlq"),
+		skill.NewCommandRepo(db),
+		skill.NewReplyProducer(replies, "skills.reply", skill.NewSkillRepo(db)),
+	)
+}
+
+func newClaim(msgs []*sarama.ConsumerMessage) *orderClaim {
+	claim := &orderClaim{msgs: make(chan *sarama.ConsumerMessage, len(msgs))}
+	for _, msg := range msgs {
+		claim.msgs <- msg
+	}
+	close(claim.msgs)
+	return claim
+}
+
 func TestConsumer(t *testing.T) {
+	t.Run("should apply updates to one skill in the order they were published", func(t *testing.T) {
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		replies := &replyProducer{}
+		consumer := newConsumer(db, replies)
+		msgs := []*sarama.ConsumerMessage{
+			newSkillMessage(0, skill.CreateSkillAction, skill.Skill{Key: "go", Name: "v0", Tags: []string{}}),
+			newSkillMessage(1, skill.UpdateNameAction, skill.NameUpdateMessage{Key: "go", Name: "v1"}),
+			newSkillMessage(2, skill.UpdateNameAction, skill.NameUpdateMessage{Key: "go", Name: "v2"}),
+			newSkillMessage(3, skill.UpdateTagsAction, skill.TagsUpdateMessage{Key: "go", Tags: []string{"lang"}}),
+			newSkillMessage(4, skill.UpdateNameAction, skill.NameUpdateMessage{Key: "go", Name: "v3"}),
+		}
+		sess := &orderSession{}
+		claim := newClaim(msgs)
+		claim.highWater = 8
+		renames := metrics.MessagesProcessed.WithLabelValues(string(skill.UpdateNameAction))
+		renamesBefore := testutil.ToFloat64(renames)
+
+		//act
+		err := consumer.ConsumeClaim(sess, claim)
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{0, 1, 2, 3, 4}, sess.marked)
+		assert.Equal(t, renamesBefore+3, testutil.ToFloat64(renames))
+		assert.Equal(t, float64(3), testutil.ToFloat64(metrics.Lag.WithLabelValues("", "0")))
+		got := getData(db, "go")
+		assert.Equal(t, "v3", got.Name)
+		assert.Equal(t, []string{"lang"}, got.Tags)
+		changes := getChanges(db, "go")
+		assert.Len(t, changes, len(msgs))
+		assert.Equal(t, skillevent.SkillCreated, changes[0].Type)
+		assert.Equal(t, int64(5), changes[4].Version)
+		assert.Equal(t, "event-4", changes[4].CausationID)
+		audits := getAudits(db, "go")
+		assert.Len(t, audits, len(msgs))
+		assert.Equal(t, int64(4), audits[4].Offset)
+		assert.JSONEq(t, `[{"field":"name","from":"v2","to":"v3"}]`, audits[4].Diff)
+		assert.Len(t, replies.results, len(msgs))
+		last := replies.results[len(replies.results)-1]
+		assert.Equal(t, "event-4", last.EventID)
+		assert.Equal(t, "go", last.Key)
+		assert.Equal(t, skillevent.OutcomeApplied, last.Outcome)
+		assert.JSONEq(t, `{"key":"go","name":"v3","description":"","logo":"","tags":["lang"],"version":5}`, string(last.Skill))
+	})
+	t.Run("should apply a batch in one transaction and mark it once committed", func(t *testing.T) {
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		replies := &replyProducer{}
+		consumer := newConsumer(db, replies).WithBatching(skill.BatchPolicy{Size: 10, Wait: 10 * time.Millisecond})
+		msgs := []*sarama.ConsumerMessage{
+			newSkillMessage(0, skill.CreateSkillAction, skill.Skill{Key: "go", Name: "v0", Tags: []string{}}),
+			newSkillMessage(1, skill.UpdateNameAction, skill.NameUpdateMessage{Key: "go", Name: "v1"}),
+			newSkillMessage(2, skill.UpdateNameAction, skill.NameUpdateMessage{Key: "go", Name: "v2"}),
+			newSkillMessage(3, skill.UpdateTagsAction, skill.TagsUpdateMessage{Key: "go", Tags: []string{"lang"}}),
+			newSkillMessage(4, skill.UpdateNameAction, skill.NameUpdateMessage{Key: "go", Name: "v3"}),
+		}
+		sess := &orderSession{}
+
+		//act
+		err := consumer.ConsumeClaim(sess, newClaim(msgs))
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{4}, sess.marked)
+		got, _ := skill.NewSkillRepo(db).GetSkillByKey("go")
+		assert.Equal(t, skill.Skill{Key: "go", Name: "v3", Description: "", Logo: "", Tags: []string{"lang"}, Version: 5}, *got)
+		changes := getChanges(db, "go")
+		assert.Len(t, changes, len(msgs))
+		assert.Equal(t, int64(5), changes[4].Version)
+		assert.Equal(t, "event-4", changes[4].CausationID)
+		audits := getAudits(db, "go")
+		assert.Len(t, audits, len(msgs))
+		assert.JSONEq(t, `[{"field":"name","from":"v1","to":"v2"}]`, audits[2].Diff)
+		assert.Equal(t, int64(4), audits[3].Version)
+		assert.JSONEq(t, `[{"field":"name","from":"v2","to":"v3"}]`, audits[4].Diff)
+		assert.Len(t, replies.results, len(msgs))
+		for _, result := range replies.results {
+			assert.Equal(t, skillevent.OutcomeApplied, result.Outcome)
+		}
+	})
+	t.Run("should fall back to one message at a time when a batch fails", func(t *testing.T) {
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		replies := &replyProducer{}
+		consumer := newConsumer(db, replies).WithBatching(skill.BatchPolicy{Size: 10, Wait: 10 * time.Millisecond})
+		stale := newSkillMessage(1, skill.UpdateNameAction, skill.NameUpdateMessage{Key: "go", Name: "stale"})
+		stale.Value, _ = skillevent.Encode(skillevent.Envelope{
+			ID:              "event-1",
+			Type:            skill.UpdateNameAction,
+			ExpectedVersion: 7,
+			Payload:         json.RawMessage(`{"key":"go","name":"stale"}`),
+		})
+		msgs := []*sarama.ConsumerMessage{
+			newSkillMessage(0, skill.CreateSkillAction, skill.Skill{Key: "go", Name: "v0", Tags: []string{}}),
+			stale,
+			newSkillMessage(2, skill.UpdateNameAction, skill.NameUpdateMessage{Key: "go", Name: "v2"}),
+		}
+		sess := &orderSession{}
+		conflicts := metrics.MessagesFailed.WithLabelValues(string(skill.UpdateNameAction), string(skillevent.OutcomeRejected))
+		conflictsBefore := testutil.ToFloat64(conflicts)
+
+		//act
+		err := consumer.ConsumeClaim(sess, newClaim(msgs))
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{2}, sess.marked)
+		assert.Equal(t, conflictsBefore+1, testutil.ToFloat64(conflicts))
+		assert.Equal(t, "v2", getData(db, "go").Name)
+		assert.Len(t, getAudits(db, "go"), 2)
+		outcomes := []skillevent.Outcome{}
+		for _, result := range replies.results {
+			outcomes = append(outcomes, result.Outcome)
+		}
+		assert.Equal(t, []skillevent.Outcome{skillevent.OutcomeApplied, skillevent.OutcomeRejected, skillevent.OutcomeApplied}, outcomes)
+	})
+}
+
+// BenchmarkConsumeClaim compares applying a claim one message at a time with
+// applying it in batches, on a few skills updated over and over.
+func BenchmarkConsumeClaim(b *testing.B) {
+	const messages, skills = 200, 4
+	for _, bench := range []struct {
+		name   string
+		policy skill.BatchPolicy
+	}{
+		{name: "one at a time", policy: skill.BatchPolicy{Size: 1}},
+		{name: "batches of 100", policy: skill.BatchPolicy{Size: 100, Wait: time.Millisecond}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			db := newMockDB()
+			defer db.Close()
+			consumer := newConsumer(db, &replyProducer{}).WithBatching(bench.policy)
+			for i := 0; i < skills; i++ {
+				skill.NewSkillRepo(db).CreateSkill(skill.Skill{Key: fmt.Sprintf("skill-%d", i), Name: "v0", Tags: []string{}})
+			}
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				msgs := make([]*sarama.ConsumerMessage, messages)
+				for i := range msgs {
+					offset := int64(n*messages + i)
+					msgs[i] = newSkillMessage(offset, skill.UpdateNameAction, skill.NameUpdateMessage{Key: fmt.Sprintf("skill-%d", i%skills), Name: fmt.Sprintf("v%d", offset)})
+				}
+				if err := consumer.ConsumeClaim(&orderSession{}, newClaim(msgs)); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.N*messages)/b.Elapsed().Seconds(), "msgs/s")
+		})
+	}
+}
+
+func TestGroupStatus(t *testing.T) {
+	//arange
+	consumer := skill.NewConsumerGroup(nil, skill.RetryPolicy{}, nil, nil, nil)
+	sess := &orderSession{claims: map[string][]int32{"skills": {0, 2}}}
+
+	//act
+	starting := consumer.Status()
+	startingErr := consumer.CheckSession(context.Background())
+	consumer.Setup(sess)
+	live := consumer.Status()
+	liveErr := consumer.CheckSession(context.Background())
+	metrics.Lag.WithLabelValues("skills", "2").Set(4)
+	consumer.Cleanup(sess)
+	rebalancing := consumer.Status()
+	consumer.NewReady()
 
+	//assert
+	assert.Equal(t, skill.GroupStatus{Partitions: map[string][]int32{}}, starting)
+	assert.ErrorIs(t, startingErr, skill.ErrNoSession)
+	assert.Equal(t, skill.GroupStatus{Live: true, Partitions: map[string][]int32{"skills": {0, 2}}}, live)
+	assert.NoError(t, liveErr)
+	assert.Equal(t, skill.GroupStatus{Partitions: map[string][]int32{}}, rebalancing)
+	assert.False(t, consumer.Status().Live)
+	assert.False(t, metrics.Lag.DeleteLabelValues("skills", "2"))
 }
@@ -1,32 +1,39 @@
 package skill
 
 import (
-	"encoding/json"
+	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"skillevent"
 
 	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-type SkillAction string
+type SkillAction = skillevent.Type
 
 const (
-	CreateSkillAction SkillAction = "create"
-	UpdateSkillAction SkillAction = "update"
-	DeleteSkillAction SkillAction = "delete"
-	UpdateNameAction  SkillAction = "update_name"
-	UpdateDescAction  SkillAction = "update_desc"
-	UpdateLogoAction  SkillAction = "update_logo"
-	UpdateTagsAction  SkillAction = "update_tags"
+	CreateSkillAction = skillevent.CreateSkill
+	UpdateSkillAction = skillevent.UpdateSkill
+	DeleteSkillAction = skillevent.DeleteSkill
+	UpdateNameAction  = skillevent.UpdateName
+	UpdateDescAction  = skillevent.UpdateDesc
+	UpdateLogoAction  = skillevent.UpdateLogo
+	UpdateTagsAction  = skillevent.UpdateTags
 )
 
 type SkillEventHandler interface {
 	ProcessMessage(msg *sarama.ConsumerMessage) error
-	createSkillHandler(msg *sarama.ConsumerMessage) error
-	updateSkillHandler(msg *sarama.ConsumerMessage) error
-	updateNameHandler(msg *sarama.ConsumerMessage) error
-	updateDescriptionHandler(msg *sarama.ConsumerMessage) error
-	updateLogoHandler(msg *sarama.ConsumerMessage) error
-	updateTagHandler(msg *sarama.ConsumerMessage) error
+	ProcessBatch(msgs []*sarama.ConsumerMessage) error
+	createSkillHandler(event skillevent.Envelope) error
+	updateSkillHandler(event skillevent.Envelope) error
+	updateNameHandler(event skillevent.Envelope) error
+	updateDescriptionHandler(event skillevent.Envelope) error
+	updateLogoHandler(event skillevent.Envelope) error
+	updateTagHandler(event skillevent.Envelope) error
+	deleteSkillHandler(event skillevent.Envelope) error
 }
 
 type skillEventHandler struct {
@@ -37,32 +44,113 @@ func NewSkillEventHandler(skillRepo SkillRepo) *skillEventHandler {
 	return &skillEventHandler{skillRepo: skillRepo}
 }
 
-func (s *skillEventHandler) ProcessMessage(msg *sarama.ConsumerMessage) error {
+// ProcessMessage applies the event of msg in its own transaction. Its span
+// continues the trace found in the message headers, down to the repo calls.
+func (s *skillEventHandler) ProcessMessage(msg *sarama.ConsumerMessage) (err error) {
+	ctx, span := startMessageSpan(msg)
+	defer func() { endSpan(span, err) }()
+
+	event, err := decodeEvent(msg)
+	if err != nil {
+		log.Printf("Error: %s\n", err)
+		return invalid(err)
+	}
+	log.Printf("Message key:%s type:%s topic:%q partition:%d offset:%d \n", string(msg.Key), event.Type, msg.Topic, msg.Partition, msg.Offset)
+	span.SetAttributes(semconv.MessagingMessageID(event.ID), attribute.String("skill.event_type", string(event.Type)))
+
+	err = traceRepo(ctx, s.skillRepo).ProcessEvent(event.ID, func(repo SkillRepo) error {
+		txHandler := &skillEventHandler{skillRepo: repo}
+		return txHandler.apply(auditSource(msg), event)
+	})
+	if errors.Is(err, ErrDuplicateEvent) {
+		log.Printf("Skip duplicate event %s\n", event.ID)
+		span.SetAttributes(attribute.Bool("skill.duplicate", true))
+		return nil
+	}
+	return err
+}
+
+// apply dispatches the event and records the change it made, if any, in the
+// change outbox and the audit log. It runs in the event's transaction, so a
+// change is published and audited exactly when it is committed.
+func (s *skillEventHandler) apply(source AuditSource, event skillevent.Envelope) error {
+	key := payloadKey(event)
+	before, err := s.current(key)
+	if err != nil {
+		return err
+	}
+	if err := s.dispatch(event); err != nil {
+		return err
+	}
+	after, err := s.current(key)
+	if err != nil {
+		return err
+	}
+	if err := s.skillRepo.RecordChange(event, before, after); err != nil {
+		return err
+	}
+	return s.skillRepo.RecordAudit(event, source, before, after)
+}
+
+// current returns the skill, or nil when there is none.
+func (s *skillEventHandler) current(key string) (*Skill, error) {
+	skill, err := s.skillRepo.GetSkillByKey(key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return skill, err
+}
+
+// payloadKey is the skill key every payload carries, as key or Key.
+func payloadKey(event skillevent.Envelope) string {
+	var payload struct{ Key string }
+	if err := event.DecodePayload(&payload); err != nil {
+		return ""
+	}
+	return payload.Key
+}
+
+func (s *skillEventHandler) dispatch(event skillevent.Envelope) error {
 	var err error = nil
-	log.Printf("Message key:%s topic:%q partition:%d offset:%d \n", string(msg.Key), msg.Topic, msg.Partition, msg.Offset)
-
-	switch string(msg.Key) {
-	case string(CreateSkillAction):
-		err = s.createSkillHandler(msg)
-	case string(UpdateSkillAction):
-		err = s.updateSkillHandler(msg)
-	case string(UpdateNameAction):
-		err = s.updateNameHandler(msg)
-	case string(UpdateDescAction):
-		err = s.updateDescriptionHandler(msg)
-	case string(UpdateLogoAction):
-		err = s.updateLogoHandler(msg)
-	case string(UpdateTagsAction):
-		err = s.updateTagHandler(msg)
+
+	switch event.Type {
+	case CreateSkillAction:
+		err = s.createSkillHandler(event)
+	case UpdateSkillAction:
+		err = s.updateSkillHandler(event)
+	case UpdateNameAction:
+		err = s.updateNameHandler(event)
+	case UpdateDescAction:
+		err = s.updateDescriptionHandler(event)
+	case UpdateLogoAction:
+		err = s.updateLogoHandler(event)
+	case UpdateTagsAction:
+		err = s.updateTagHandler(event)
+	case DeleteSkillAction:
+		err = s.deleteSkillHandler(event)
 	default:
 		log.Println("Unknown")
 	}
 	return err
 }
 
-func (s *skillEventHandler) createSkillHandler(msg *sarama.ConsumerMessage) error {
-	skill := Skill{}
-	err := json.Unmarshal(msg.Value, &skill)
+// ErrInvalidEvent marks events that can never be applied, because they can't
+// be decoded or break the skill rules. They are rejected without retrying.
+var ErrInvalidEvent = errors.New("invalid event")
+
+func invalid(err error) error {
+	return fmt.Errorf("%w: %w", ErrInvalidEvent, err)
+}
+
+// decodeEvent unwraps the envelope of a message. The message key is the skill
+// key and the action is the envelope type, except for messages published
+// before the envelope existed, which carried the action in the message key.
+func decodeEvent(msg *sarama.ConsumerMessage) (skillevent.Envelope, error) {
+	return skillevent.Decode(msg.Value, SkillAction(msg.Key))
+}
+
+func (s *skillEventHandler) createSkillHandler(event skillevent.Envelope) error {
+	skill, err := decodeCreate(event)
 	if err != nil {
 		log.Printf("Error: %s\n", err)
 		return err
@@ -75,14 +163,13 @@ func (s *skillEventHandler) createSkillHandler(msg *sarama.ConsumerMessage) erro
 	return nil
 }
 
-func (s *skillEventHandler) updateSkillHandler(msg *sarama.ConsumerMessage) error {
-	skill := Skill{}
-	err := json.Unmarshal(msg.Value, &skill)
+func (s *skillEventHandler) updateSkillHandler(event skillevent.Envelope) error {
+	skill, err := decodeUpdate(event)
 	if err != nil {
 		log.Printf("Error: %s\n", err)
 		return err
 	}
-	_, err = s.skillRepo.UpdateSkill(skill)
+	_, err = s.skillRepo.UpdateSkill(skill, event.ExpectedVersion)
 	if err != nil {
 		log.Printf("Error: %s\n", err)
 		return err
@@ -90,14 +177,13 @@ func (s *skillEventHandler) updateSkillHandler(msg *sarama.ConsumerMessage) erro
 	return nil
 }
 
-func (s *skillEventHandler) updateNameHandler(msg *sarama.ConsumerMessage) error {
-	nameUpdateMessage := NameUpdateMessage{}
-	err := json.Unmarshal(msg.Value, &nameUpdateMessage)
+func (s *skillEventHandler) updateNameHandler(event skillevent.Envelope) error {
+	nameUpdateMessage, err := decodeName(event)
 	if err != nil {
 		log.Printf("Error: %s\n", err)
 		return err
 	}
-	_, err = s.skillRepo.UpdateSkillNameByKey(nameUpdateMessage.Key, nameUpdateMessage.Name)
+	_, err = s.skillRepo.UpdateSkillNameByKey(nameUpdateMessage.Key, nameUpdateMessage.Name, event.ExpectedVersion)
 	if err != nil {
 		log.Printf("Error: %s\n", err)
 		return err
@@ -105,14 +191,13 @@ func (s *skillEventHandler) updateNameHandler(msg *sarama.ConsumerMessage) error
 	return nil
 }
 
-func (s *skillEventHandler) updateDescriptionHandler(msg *sarama.ConsumerMessage) error {
-	descriptionUpdateMessage := DescriptionUpdateMessage{}
-	err := json.Unmarshal(msg.Value, &descriptionUpdateMessage)
+func (s *skillEventHandler) updateDescriptionHandler(event skillevent.Envelope) error {
+	descriptionUpdateMessage, err := decodeDescription(event)
 	if err != nil {
 		log.Printf("Error: %s\n", err)
 		return err
 	}
-	_, err = s.skillRepo.UpdateSkillDescriptionByKey(descriptionUpdateMessage.Key, descriptionUpdateMessage.Description)
+	_, err = s.skillRepo.UpdateSkillDescriptionByKey(descriptionUpdateMessage.Key, descriptionUpdateMessage.Description, event.ExpectedVersion)
 	if err != nil {
 		log.Printf("Error: %s\n", err)
 		return err
@@ -120,14 +205,13 @@ func (s *skillEventHandler) updateDescriptionHandler(msg *sarama.ConsumerMessage
 	return nil
 }
 
-func (s *skillEventHandler) updateLogoHandler(msg *sarama.ConsumerMessage) error {
-	logoUpdateMessage := LogoUpdateMessage{}
-	err := json.Unmarshal(msg.Value, &logoUpdateMessage)
+func (s *skillEventHandler) updateLogoHandler(event skillevent.Envelope) error {
+	logoUpdateMessage, err := decodeLogo(event)
 	if err != nil {
 		log.Printf("Error: %s\n", err)
 		return err
 	}
-	_, err = s.skillRepo.UpdateSkillLogoByKey(logoUpdateMessage.Key, logoUpdateMessage.Logo)
+	_, err = s.skillRepo.UpdateSkillLogoByKey(logoUpdateMessage.Key, logoUpdateMessage.Logo, event.ExpectedVersion)
 	if err != nil {
 		log.Printf("Error: %s\n", err)
 		return err
@@ -135,14 +219,28 @@ func (s *skillEventHandler) updateLogoHandler(msg *sarama.ConsumerMessage) error
 	return nil
 }
 
-func (s *skillEventHandler) updateTagHandler(msg *sarama.ConsumerMessage) error {
-	tagsUpdateMessage := TagsUpdateMessage{}
-	err := json.Unmarshal(msg.Value, &tagsUpdateMessage)
+func (s *skillEventHandler) updateTagHandler(event skillevent.Envelope) error {
+	tagsUpdateMessage, err := decodeTags(event)
 	if err != nil {
 		log.Printf("Error: %s\n", err)
 		return err
 	}
-	_, err = s.skillRepo.UpdateSkillTagsByKey(tagsUpdateMessage.Key, tagsUpdateMessage.Tags)
+	_, err = s.skillRepo.UpdateSkillTagsByKey(tagsUpdateMessage.Key, tagsUpdateMessage.Tags, event.ExpectedVersion)
+	if err != nil {
+		log.Printf("Error: %s\n", err)
+		return err
+	}
+	return nil
+}
+
+func (s *skillEventHandler) deleteSkillHandler(event skillevent.Envelope) error {
+	deleteMessage := DeleteMessage{}
+	err := event.DecodePayload(&deleteMessage)
+	if err != nil {
+		log.Printf("Error: %s\n", err)
+		return invalid(err)
+	}
+	err = s.skillRepo.DeleteSkillByKey(deleteMessage.Key, event.ExpectedVersion)
 	if err != nil {
 		log.Printf("Error: %s\n", err)
 		return err
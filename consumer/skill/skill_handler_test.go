@@ -1,47 +1,94 @@
 package skill
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"platform/tracing/tracingtest"
+	"skillevent"
 	"testing"
 
 	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type MockSkillRepository struct {
 	skill     Skill
 	err       error
 	wasCalled bool
+	duplicate bool
+	eventID   string
+	changes   int
+	audits    []AuditSource
 }
 
+func (mockRepo *MockSkillRepository) ProcessEvent(eventID string, fn func(repo SkillRepo) error) error {
+	mockRepo.eventID = eventID
+	if mockRepo.duplicate {
+		return ErrDuplicateEvent
+	}
+	return fn(mockRepo)
+}
+func (mockRepo *MockSkillRepository) ProcessBatch(fn func(repo SkillRepo) error) error {
+	return fn(mockRepo)
+}
+func (mockRepo *MockSkillRepository) MarkProcessed(eventID string) error {
+	mockRepo.eventID = eventID
+	if mockRepo.duplicate {
+		return ErrDuplicateEvent
+	}
+	return nil
+}
+func (mockRepo *MockSkillRepository) GetSkillByKey(key string) (*Skill, error) {
+	if mockRepo.skill.Key == "" {
+		return nil, sql.ErrNoRows
+	}
+	return &mockRepo.skill, nil
+}
+func (mockRepo *MockSkillRepository) RecordChange(event skillevent.Envelope, before *Skill, after *Skill) error {
+	mockRepo.changes++
+	return nil
+}
+func (mockRepo *MockSkillRepository) RecordAudit(event skillevent.Envelope, source AuditSource, before *Skill, after *Skill) error {
+	mockRepo.audits = append(mockRepo.audits, source)
+	return nil
+}
 func (mockRepo *MockSkillRepository) CreateSkill(skill Skill) (*Skill, error) {
 	mockRepo.wasCalled = true
 	return &mockRepo.skill, mockRepo.err
 }
-func (mockRepo *MockSkillRepository) UpdateSkill(skill Skill) (*Skill, error) {
+func (mockRepo *MockSkillRepository) UpdateSkill(skill Skill, expectedVersion int64) (*Skill, error) {
 	mockRepo.wasCalled = true
 	return &mockRepo.skill, mockRepo.err
 }
-func (mockRepo *MockSkillRepository) UpdateSkillNameByKey(key string, name string) (*Skill, error) {
+func (mockRepo *MockSkillRepository) UpdateSkillNameByKey(key string, name string, expectedVersion int64) (*Skill, error) {
 	mockRepo.wasCalled = true
 	return &mockRepo.skill, mockRepo.err
 }
-func (mockRepo *MockSkillRepository) UpdateSkillDescriptionByKey(key string, description string) (*Skill, error) {
+func (mockRepo *MockSkillRepository) UpdateSkillDescriptionByKey(key string, description string, expectedVersion int64) (*Skill, error) {
 	mockRepo.wasCalled = true
 	return &mockRepo.skill, mockRepo.err
 }
-func (mockRepo *MockSkillRepository) UpdateSkillLogoByKey(key string, logo string) (*Skill, error) {
+func (mockRepo *MockSkillRepository) UpdateSkillLogoByKey(key string, logo string, expectedVersion int64) (*Skill, error) {
 	mockRepo.wasCalled = true
 	return &mockRepo.skill, mockRepo.err
 }
-func (mockRepo *MockSkillRepository) UpdateSkillTagsByKey(key string, tags []string) (*Skill, error) {
+func (mockRepo *MockSkillRepository) UpdateSkillTagsByKey(key string, tags []string, expectedVersion int64) (*Skill, error) {
 	mockRepo.wasCalled = true
 	return &mockRepo.skill, mockRepo.err
 }
-func (mockRepo *MockSkillRepository) DeleteSkillByKey(key string) error {
+func (mockRepo *MockSkillRepository) DeleteSkillByKey(key string, expectedVersion int64) error {
 	mockRepo.wasCalled = true
 	return mockRepo.err
 }
+func (mockRepo *MockSkillRepository) SaveSkill(skill Skill) error {
+	mockRepo.wasCalled = true
+	mockRepo.skill = skill
+	return mockRepo.err
+}
 
 func TestCreateSkill(t *testing.T) {
 	t.Run("should not return error when skill is created successfully", func(t *testing.T) {
@@ -51,7 +98,7 @@ func TestCreateSkill(t *testing.T) {
 			Key:         "1",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mockSkillRepo := &MockSkillRepository{skill: skill, err: nil}
@@ -77,6 +124,10 @@ func TestCreateSkill(t *testing.T) {
 		if err != nil {
 			t.Errorf("expected error to be nil but got %v", err)
 		}
+		if mockSkillRepo.changes != 1 {
+			t.Errorf("expected change to be recorded once but got %d", mockSkillRepo.changes)
+		}
+		assert.Equal(t, []AuditSource{{Topic: "skills", Partition: 0, Offset: 123456}}, mockSkillRepo.audits)
 	})
 	t.Run("should return error when can repo return error", func(t *testing.T) {
 
@@ -85,7 +136,7 @@ func TestCreateSkill(t *testing.T) {
 			Key:         "1",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mockSkillRepo := &MockSkillRepository{err: errors.New("")}
@@ -119,7 +170,7 @@ func TestCreateSkill(t *testing.T) {
 			Key:         "1",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 
@@ -163,7 +214,7 @@ func TestUpdateSkill(t *testing.T) {
 			Key:         "1",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mockSkillRepo := &MockSkillRepository{skill: skill, err: nil}
@@ -198,7 +249,7 @@ func TestUpdateSkill(t *testing.T) {
 			Key:         "1",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mockSkillRepo := &MockSkillRepository{err: errors.New("")}
@@ -232,7 +283,7 @@ func TestUpdateSkill(t *testing.T) {
 			Key:         "1",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 
@@ -275,7 +326,7 @@ func TestUpdateName(t *testing.T) {
 			Key:         "1",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mockSkillRepo := &MockSkillRepository{skill: skill, err: nil}
@@ -310,7 +361,7 @@ func TestUpdateName(t *testing.T) {
 			Key:         "1",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mockSkillRepo := &MockSkillRepository{err: errors.New("")}
@@ -344,7 +395,7 @@ func TestUpdateName(t *testing.T) {
 			Key:         "1",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 
@@ -387,7 +438,7 @@ func TestUpdateDesc(t *testing.T) {
 			Key:         "1",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mockSkillRepo := &MockSkillRepository{skill: skill, err: nil}
@@ -422,7 +473,7 @@ func TestUpdateDesc(t *testing.T) {
 			Key:         "1",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mockSkillRepo := &MockSkillRepository{err: errors.New("")}
@@ -456,7 +507,7 @@ func TestUpdateDesc(t *testing.T) {
 			Key:         "1",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 
@@ -499,7 +550,7 @@ func TestUpdateLogo(t *testing.T) {
 			Key:         "1",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mockSkillRepo := &MockSkillRepository{skill: skill, err: nil}
@@ -534,7 +585,7 @@ func TestUpdateLogo(t *testing.T) {
 			Key:         "1",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mockSkillRepo := &MockSkillRepository{err: errors.New("")}
@@ -568,7 +619,7 @@ func TestUpdateLogo(t *testing.T) {
 			Key:         "1",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 
@@ -611,7 +662,7 @@ func TestUpdateTag(t *testing.T) {
 			Key:         "1",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mockSkillRepo := &MockSkillRepository{skill: skill, err: nil}
@@ -646,7 +697,7 @@ func TestUpdateTag(t *testing.T) {
 			Key:         "1",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 		mockSkillRepo := &MockSkillRepository{err: errors.New("")}
@@ -680,7 +731,7 @@ func TestUpdateTag(t *testing.T) {
 			Key:         "1",
 			Name:        "test",
 			Description: "test",
-			Logo:        "test",
+			Logo:        "https://example.com/test.svg",
 			Tags:        []string{"tag"},
 		}
 
@@ -714,3 +765,306 @@ func TestUpdateTag(t *testing.T) {
 		}
 	})
 }
+
+func TestDelete(t *testing.T) {
+	t.Run("should not return error when skill is deleted successfully", func(t *testing.T) {
+
+		//arange
+		mockSkillRepo := &MockSkillRepository{err: nil}
+		skillEventHandler := NewSkillEventHandler(mockSkillRepo)
+
+		value, _ := json.Marshal(DeleteMessage{Key: "1"})
+
+		msg := &sarama.ConsumerMessage{
+			Key:       []byte(DeleteSkillAction),
+			Value:     value,
+			Topic:     "skills",
+			Partition: 0,
+			Offset:    123456,
+		}
+
+		//act
+		err := skillEventHandler.ProcessMessage(msg)
+
+		//assert
+		if !mockSkillRepo.wasCalled {
+			t.Error("expected wasCalled to be true")
+		}
+		if err != nil {
+			t.Errorf("expected error to be nil but got %v", err)
+		}
+	})
+
+	t.Run("should return error when can repo return error", func(t *testing.T) {
+
+		//arange
+		mockSkillRepo := &MockSkillRepository{err: errors.New("")}
+		skillEventHandler := NewSkillEventHandler(mockSkillRepo)
+
+		value, _ := json.Marshal(DeleteMessage{Key: "1"})
+
+		msg := &sarama.ConsumerMessage{
+			Key:       []byte(DeleteSkillAction),
+			Value:     value,
+			Topic:     "skills",
+			Partition: 0,
+			Offset:    123456,
+		}
+
+		//act
+		err := skillEventHandler.ProcessMessage(msg)
+
+		//assert
+		if !mockSkillRepo.wasCalled {
+			t.Error("expected wasCalled to be true")
+		}
+		if err == nil {
+			t.Errorf("expected error but got %v", err)
+		}
+	})
+	t.Run("should return error when can not json marshal to delete message", func(t *testing.T) {
+
+		//arange
+		fakeMessage := `{"key":"1"}}`
+		mockSkillRepo := &MockSkillRepository{err: nil}
+		skillEventHandler := NewSkillEventHandler(mockSkillRepo)
+
+		value, _ := json.Marshal(fakeMessage)
+
+		msg := &sarama.ConsumerMessage{
+			Key:       []byte(DeleteSkillAction),
+			Value:     value,
+			Topic:     "skills",
+			Partition: 0,
+			Offset:    123456,
+		}
+
+		//act
+		err := skillEventHandler.ProcessMessage(msg)
+
+		//assert
+		if mockSkillRepo.wasCalled {
+			t.Error("expected wasCalled to be false")
+		}
+		if err == nil {
+			t.Errorf("expected error but got %v", err)
+		}
+	})
+}
+
+func TestDuplicateEvent(t *testing.T) {
+	t.Run("should pass event id from envelope to repository", func(t *testing.T) {
+
+		//arange
+		mockSkillRepo := &MockSkillRepository{}
+		skillEventHandler := NewSkillEventHandler(mockSkillRepo)
+
+		msg := newEventMessage(skillevent.Envelope{
+			ID:   "event-id",
+			Type: CreateSkillAction,
+		}, Skill{Key: "1", Name: "one"})
+
+		//act
+		err := skillEventHandler.ProcessMessage(msg)
+
+		//assert
+		if err != nil {
+			t.Errorf("expected error to be nil but got %v", err)
+		}
+		if mockSkillRepo.eventID != "event-id" {
+			t.Errorf("expected event id to be event-id but got %q", mockSkillRepo.eventID)
+		}
+	})
+	t.Run("should skip and not return error when event is duplicate", func(t *testing.T) {
+
+		//arange
+		mockSkillRepo := &MockSkillRepository{duplicate: true}
+		skillEventHandler := NewSkillEventHandler(mockSkillRepo)
+
+		msg := newEventMessage(skillevent.Envelope{
+			ID:   "event-id",
+			Type: CreateSkillAction,
+		}, Skill{Key: "1", Name: "one"})
+
+		//act
+		err := skillEventHandler.ProcessMessage(msg)
+
+		//assert
+		if mockSkillRepo.wasCalled {
+			t.Error("expected wasCalled to be false")
+		}
+		if err != nil {
+			t.Errorf("expected error to be nil but got %v", err)
+		}
+	})
+}
+
+func newEventMessage(event skillevent.Envelope, payload any) *sarama.ConsumerMessage {
+	event.Payload, _ = json.Marshal(payload)
+	value, _ := skillevent.Encode(event)
+	return &sarama.ConsumerMessage{Key: []byte("skills"), Value: value}
+}
+
+func TestProcessEnvelope(t *testing.T) {
+	t.Run("should dispatch on envelope type and decode payload", func(t *testing.T) {
+
+		//arange
+		mockSkillRepo := &MockSkillRepository{}
+		skillEventHandler := NewSkillEventHandler(mockSkillRepo)
+
+		msg := newEventMessage(skillevent.Envelope{
+			ID:   "event-id",
+			Type: UpdateNameAction,
+		}, NameUpdateMessage{Key: "go", Name: "golang"})
+
+		//act
+		err := skillEventHandler.ProcessMessage(msg)
+
+		//assert
+		if err != nil {
+			t.Errorf("expected error to be nil but got %v", err)
+		}
+		if !mockSkillRepo.wasCalled {
+			t.Error("expected wasCalled to be true")
+		}
+	})
+	t.Run("should reject envelope with unknown schema version", func(t *testing.T) {
+
+		//arange
+		mockSkillRepo := &MockSkillRepository{}
+		skillEventHandler := NewSkillEventHandler(mockSkillRepo)
+
+		msg := &sarama.ConsumerMessage{
+			Key:   []byte(CreateSkillAction),
+			Value: []byte(`{"id":"event-id","type":"create","schema_version":2,"payload":{"key":"go"}}`),
+		}
+
+		//act
+		err := skillEventHandler.ProcessMessage(msg)
+
+		//assert
+		if !errors.Is(err, skillevent.ErrUnsupportedVersion) {
+			t.Errorf("expected ErrUnsupportedVersion but got %v", err)
+		}
+		if mockSkillRepo.wasCalled {
+			t.Error("expected wasCalled to be false")
+		}
+	})
+}
+
+func TestRejectInvalidEvent(t *testing.T) {
+	t.Run("should reject create event that breaks skill rules", func(t *testing.T) {
+
+		//arange
+		mockSkillRepo := &MockSkillRepository{}
+		skillEventHandler := NewSkillEventHandler(mockSkillRepo)
+
+		msg := newEventMessage(skillevent.Envelope{
+			ID:   "event-id",
+			Type: CreateSkillAction,
+		}, Skill{Key: "Not A Slug", Name: " ", Logo: "logo"})
+
+		//act
+		err := skillEventHandler.ProcessMessage(msg)
+
+		//assert
+		if !errors.Is(err, ErrInvalidEvent) {
+			t.Errorf("expected ErrInvalidEvent but got %v", err)
+		}
+		if mockSkillRepo.wasCalled {
+			t.Error("expected wasCalled to be false")
+		}
+	})
+	t.Run("should reject event that can't be decoded", func(t *testing.T) {
+
+		//arange
+		mockSkillRepo := &MockSkillRepository{}
+		skillEventHandler := NewSkillEventHandler(mockSkillRepo)
+
+		msg := &sarama.ConsumerMessage{Key: []byte("go"), Value: []byte(`not json`)}
+
+		//act
+		err := skillEventHandler.ProcessMessage(msg)
+
+		//assert
+		if !errors.Is(err, ErrInvalidEvent) {
+			t.Errorf("expected ErrInvalidEvent but got %v", err)
+		}
+	})
+}
+
+func TestProcessTracing(t *testing.T) {
+	exporter := tracingtest.InMemory()
+	traceparent := &sarama.RecordHeader{Key: []byte("traceparent"), Value: []byte("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")}
+
+	t.Run("should continue the trace of the message through the repo calls", func(t *testing.T) {
+
+		//arange
+		exporter.Reset()
+		mockSkillRepo := &MockSkillRepository{skill: Skill{Key: "go", Name: "go"}}
+		skillEventHandler := NewSkillEventHandler(mockSkillRepo)
+		msg := newEventMessage(skillevent.Envelope{ID: "event-id", Type: UpdateNameAction}, NameUpdateMessage{Key: "go", Name: "golang"})
+		msg.Topic = "skills"
+		msg.Headers = []*sarama.RecordHeader{traceparent}
+
+		//act
+		err := skillEventHandler.ProcessMessage(msg)
+
+		//assert
+		assert.NoError(t, err)
+		spans := map[string]sdktrace.ReadOnlySpan{}
+		for _, span := range exporter.GetSpans().Snapshots() {
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+			spans[span.Name()] = span
+		}
+		consumer, tx := spans["process skills"], spans["SkillRepo.ProcessEvent"]
+		assert.Equal(t, trace.SpanKindConsumer, consumer.SpanKind())
+		assert.Equal(t, "00f067aa0ba902b7", consumer.Parent().SpanID().String())
+		assert.Equal(t, consumer.SpanContext().SpanID(), tx.Parent().SpanID())
+		for _, name := range []string{"SkillRepo.GetSkillByKey", "SkillRepo.UpdateSkillNameByKey", "SkillRepo.RecordChange", "SkillRepo.RecordAudit"} {
+			if assert.Contains(t, spans, name) {
+				assert.Equal(t, tx.SpanContext().SpanID(), spans[name].Parent().SpanID())
+			}
+		}
+	})
+	t.Run("should link the batch span to the trace of each message", func(t *testing.T) {
+
+		//arange
+		exporter.Reset()
+		mockSkillRepo := &MockSkillRepository{skill: Skill{Key: "go", Name: "go"}}
+		skillEventHandler := NewSkillEventHandler(mockSkillRepo)
+		traced := newEventMessage(skillevent.Envelope{ID: "1", Type: UpdateNameAction}, NameUpdateMessage{Key: "go", Name: "golang"})
+		traced.Topic, traced.Headers = "skills", []*sarama.RecordHeader{traceparent}
+		untraced := newEventMessage(skillevent.Envelope{ID: "2", Type: UpdateDescAction}, DescriptionUpdateMessage{Key: "go", Description: "gopher"})
+		untraced.Topic = "skills"
+
+		//act
+		err := skillEventHandler.ProcessBatch([]*sarama.ConsumerMessage{traced, untraced})
+
+		//assert
+		assert.NoError(t, err)
+		spans := exporter.GetSpans()
+		batch := spans[len(spans)-1]
+		assert.Equal(t, "process skills", batch.Name)
+		assert.False(t, batch.Parent.IsValid())
+		if assert.Len(t, batch.Links, 1) {
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", batch.Links[0].SpanContext.TraceID().String())
+		}
+	})
+	t.Run("should mark the span of an event that can't be decoded", func(t *testing.T) {
+
+		//arange
+		exporter.Reset()
+		skillEventHandler := NewSkillEventHandler(&MockSkillRepository{})
+		msg := &sarama.ConsumerMessage{Topic: "skills", Key: []byte("go"), Value: []byte(`not json`)}
+
+		//act
+		err := skillEventHandler.ProcessMessage(msg)
+
+		//assert
+		assert.ErrorIs(t, err, ErrInvalidEvent)
+		spans := exporter.GetSpans()
+		assert.Len(t, spans, 1)
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+	})
+}
@@ -1,21 +1,89 @@
 package skill
 
-type NameUpdateMessage struct {
-	Key  string
-	Name string
+import (
+	"skillevent"
+	"strings"
+)
+
+// Event payloads are defined once in the shared skillevent module.
+type (
+	NameUpdateMessage        = skillevent.NameUpdateMessage
+	DescriptionUpdateMessage = skillevent.DescriptionUpdateMessage
+	LogoUpdateMessage        = skillevent.LogoUpdateMessage
+	TagsUpdateMessage        = skillevent.TagsUpdateMessage
+	DeleteMessage            = skillevent.DeleteMessage
+)
+
+// The decode functions below read the payload of one action, normalize it
+// and check it against the skill rules. The handlers and the batch fold both
+// go through them, so an event is accepted or rejected the same way in
+// either path. Their errors are invalid events.
+
+func decodeCreate(event skillevent.Envelope) (Skill, error) {
+	skill := Skill{}
+	if err := event.DecodePayload(&skill); err != nil {
+		return Skill{}, invalid(err)
+	}
+	skill.Name = strings.TrimSpace(skill.Name)
+	skill.Tags = skillevent.NormalizeTags(skill.Tags)
+	if err := skillevent.ValidateSkill(skill.Key, skill.Name, skill.Logo, skill.Tags); err != nil {
+		return Skill{}, invalid(err)
+	}
+	return skill, nil
+}
+
+func decodeUpdate(event skillevent.Envelope) (Skill, error) {
+	skill := Skill{}
+	if err := event.DecodePayload(&skill); err != nil {
+		return Skill{}, invalid(err)
+	}
+	skill.Name = strings.TrimSpace(skill.Name)
+	skill.Tags = skillevent.NormalizeTags(skill.Tags)
+	if err := skillevent.Validate(skillevent.ValidateName(skill.Name), skillevent.ValidateLogo(skill.Logo), skillevent.ValidateTags(skill.Tags)); err != nil {
+		return Skill{}, invalid(err)
+	}
+	return skill, nil
+}
+
+func decodeName(event skillevent.Envelope) (NameUpdateMessage, error) {
+	msg := NameUpdateMessage{}
+	if err := event.DecodePayload(&msg); err != nil {
+		return NameUpdateMessage{}, invalid(err)
+	}
+	msg.Name = strings.TrimSpace(msg.Name)
+	if err := skillevent.Validate(skillevent.ValidateName(msg.Name)); err != nil {
+		return NameUpdateMessage{}, invalid(err)
+	}
+	return msg, nil
 }
 
-type DescriptionUpdateMessage struct {
-	Key         string
-	Description string
+func decodeDescription(event skillevent.Envelope) (DescriptionUpdateMessage, error) {
+	msg := DescriptionUpdateMessage{}
+	if err := event.DecodePayload(&msg); err != nil {
+		return DescriptionUpdateMessage{}, invalid(err)
+	}
+	return msg, nil
 }
 
-type LogoUpdateMessage struct {
-	Key  string
-	Logo string
+func decodeLogo(event skillevent.Envelope) (LogoUpdateMessage, error) {
+	msg := LogoUpdateMessage{}
+	if err := event.DecodePayload(&msg); err != nil {
+		return LogoUpdateMessage{}, invalid(err)
+	}
+	if err := skillevent.Validate(skillevent.ValidateLogo(msg.Logo)); err != nil {
+		return LogoUpdateMessage{}, invalid(err)
+	}
+	return msg, nil
 }
 
-type TagsUpdateMessage struct {
-	Key  string
-	Tags []string
+func decodeTags(event skillevent.Envelope) (TagsUpdateMessage, error) {
+	msg := TagsUpdateMessage{}
+	if err := event.DecodePayload(&msg); err != nil {
+		return TagsUpdateMessage{}, invalid(err)
+	}
+	msg.Tags = skillevent.NormalizeTags(msg.Tags)
+	if err := skillevent.Validate(skillevent.ValidateTags(msg.Tags)); err != nil {
+		return TagsUpdateMessage{}, invalid(err)
+	}
+	return msg, nil
 }
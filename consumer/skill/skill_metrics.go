@@ -0,0 +1,56 @@
+package skill
+
+import (
+	"savedb/metrics"
+	"skillevent"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// unknownAction labels the messages that can't be decoded or carry an
+// action this consumer doesn't know, so they don't each get their own series.
+const unknownAction = "unknown"
+
+func actionOf(msg *sarama.ConsumerMessage) string {
+	event, err := decodeEvent(msg)
+	if err != nil {
+		return unknownAction
+	}
+	switch event.Type {
+	case CreateSkillAction, UpdateSkillAction, UpdateNameAction, UpdateDescAction, UpdateLogoAction, UpdateTagsAction, DeleteSkillAction:
+		return string(event.Type)
+	}
+	return unknownAction
+}
+
+// observe records how msg was settled and how long it took since start.
+func observe(msg *sarama.ConsumerMessage, outcome skillevent.Outcome, start time.Time) {
+	action := actionOf(msg)
+	metrics.ProcessingDuration.WithLabelValues(action).Observe(time.Since(start).Seconds())
+	if outcome == skillevent.OutcomeApplied {
+		metrics.MessagesProcessed.WithLabelValues(action).Inc()
+		return
+	}
+	metrics.MessagesFailed.WithLabelValues(action, string(outcome)).Inc()
+}
+
+// recordLag sets how far the partition of msg is behind its high water mark,
+// the offset its next message will get.
+func recordLag(claim sarama.ConsumerGroupClaim, msg *sarama.ConsumerMessage) {
+	lag := claim.HighWaterMarkOffset() - msg.Offset - 1
+	if lag < 0 {
+		lag = 0
+	}
+	metrics.Lag.WithLabelValues(msg.Topic, strconv.Itoa(int(msg.Partition))).Set(float64(lag))
+}
+
+// forgetLag deletes the lag of every claimed partition.
+func forgetLag(claims map[string][]int32) {
+	for topic, partitions := range claims {
+		for _, partition := range partitions {
+			metrics.Lag.DeleteLabelValues(topic, strconv.Itoa(int(partition)))
+		}
+	}
+}
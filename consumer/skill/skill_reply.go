@@ -0,0 +1,85 @@
+package skill
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"skillevent"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// ResultPublisher tells the API and other services what became of every
+// consumed message.
+type ResultPublisher interface {
+	PublishResult(msg *sarama.ConsumerMessage, outcome skillevent.Outcome, cause error) error
+}
+
+type replyProducer struct {
+	producer  sarama.SyncProducer
+	topic     string
+	skillRepo SkillRepo
+}
+
+func NewReplyProducer(producer sarama.SyncProducer, topic string, skillRepo SkillRepo) *replyProducer {
+	return &replyProducer{producer: producer, topic: topic, skillRepo: skillRepo}
+}
+
+// PublishResult sends the result of msg, keyed by skill so the results of one
+// skill stay in order. The skill state is read after the message settled.
+func (p *replyProducer) PublishResult(msg *sarama.ConsumerMessage, outcome skillevent.Outcome, cause error) error {
+	result := newResult(msg, outcome, cause)
+
+	skill, err := p.skillRepo.GetSkillByKey(result.Key)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil {
+		result.Skill, _ = json.Marshal(skill)
+	}
+
+	value, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	reply := &sarama.ProducerMessage{
+		Topic: p.topic,
+		Key:   sarama.StringEncoder(result.Key),
+		Value: sarama.ByteEncoder(value),
+	}
+	partition, offset, err := p.producer.SendMessage(reply)
+	if err != nil {
+		log.Printf("FAILED to send result: %s\n", err)
+		return err
+	}
+	log.Printf("> result sent to partition %d at offset %d\n", partition, offset)
+	return nil
+}
+
+// newResult fills in what the message tells about itself. A message that
+// can't be decoded still gets a result, keyed by its kafka key.
+func newResult(msg *sarama.ConsumerMessage, outcome skillevent.Outcome, cause error) skillevent.Result {
+	result := skillevent.Result{
+		Key:         string(msg.Key),
+		Outcome:     outcome,
+		ProcessedAt: time.Now().UTC(),
+	}
+	if cause != nil {
+		result.Error = cause.Error()
+	}
+
+	event, err := decodeEvent(msg)
+	if err != nil {
+		return result
+	}
+	result.EventID = event.ID
+	result.CorrelationID = event.CorrelationID
+	result.Type = event.Type
+
+	if key := payloadKey(event); key != "" {
+		result.Key = key
+	}
+	return result
+}
@@ -0,0 +1,55 @@
+package skill
+
+import (
+	"encoding/json"
+	"errors"
+	"skillevent"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishResult(t *testing.T) {
+	t.Run("should publish result with skill state keyed by skill", func(t *testing.T) {
+		//arange
+		producer := &mockSyncProducer{}
+		repo := &MockSkillRepository{skill: Skill{Key: "go", Name: "go", Tags: []string{}, Version: 1}}
+		reply := NewReplyProducer(producer, "skills.reply", repo)
+
+		//act
+		err := reply.PublishResult(newCreateMessage(), skillevent.OutcomeApplied, nil)
+
+		//assert
+		assert.NoError(t, err)
+		assert.Len(t, producer.msgs, 1)
+		assert.Equal(t, "skills.reply", producer.msgs[0].Topic)
+		key, _ := producer.msgs[0].Key.Encode()
+		assert.Equal(t, "go", string(key))
+		value, _ := producer.msgs[0].Value.Encode()
+		result := skillevent.Result{}
+		assert.NoError(t, json.Unmarshal(value, &result))
+		assert.Equal(t, "event-id", result.EventID)
+		assert.Equal(t, "command-id", result.CorrelationID)
+		assert.Equal(t, CreateSkillAction, result.Type)
+		assert.Equal(t, skillevent.OutcomeApplied, result.Outcome)
+		assert.JSONEq(t, `{"key":"go","name":"go","description":"","logo":"","tags":[],"version":1}`, string(result.Skill))
+	})
+	t.Run("should publish result without skill when it does not exist", func(t *testing.T) {
+		//arange
+		producer := &mockSyncProducer{}
+		repo := &MockSkillRepository{}
+		reply := NewReplyProducer(producer, "skills.reply", repo)
+
+		//act
+		err := reply.PublishResult(newCreateMessage(), skillevent.OutcomeFailed, errors.New("database is unavailable"))
+
+		//assert
+		assert.NoError(t, err)
+		value, _ := producer.msgs[0].Value.Encode()
+		result := skillevent.Result{}
+		assert.NoError(t, json.Unmarshal(value, &result))
+		assert.Equal(t, skillevent.OutcomeFailed, result.Outcome)
+		assert.Equal(t, "database is unavailable", result.Error)
+		assert.Nil(t, result.Skill)
+	})
+}
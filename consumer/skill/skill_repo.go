@@ -2,93 +2,212 @@ package skill
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"savedb/database"
+	"skillevent"
+	"time"
 
 	"github.com/lib/pq"
 )
 
+var (
+	ErrDuplicateEvent  = errors.New("event has already been processed")
+	ErrVersionConflict = errors.New("skill version conflict")
+)
+
 type skillRepo struct {
-	db *sql.DB
+	db   database.DBTX
+	conn *sql.DB
 }
 
 type SkillRepo interface {
+	ProcessEvent(eventID string, fn func(repo SkillRepo) error) error
+	ProcessBatch(fn func(repo SkillRepo) error) error
+	MarkProcessed(eventID string) error
+	GetSkillByKey(key string) (*Skill, error)
+	RecordChange(event skillevent.Envelope, before *Skill, after *Skill) error
+	RecordAudit(event skillevent.Envelope, source AuditSource, before *Skill, after *Skill) error
 	CreateSkill(skill Skill) (*Skill, error)
-	UpdateSkill(skill Skill) (*Skill, error)
-	UpdateSkillNameByKey(key string, name string) (*Skill, error)
-	UpdateSkillDescriptionByKey(key string, description string) (*Skill, error)
-	UpdateSkillLogoByKey(key string, logo string) (*Skill, error)
-	UpdateSkillTagsByKey(key string, tags []string) (*Skill, error)
-	DeleteSkillByKey(key string) error
+	UpdateSkill(skill Skill, expectedVersion int64) (*Skill, error)
+	UpdateSkillNameByKey(key string, name string, expectedVersion int64) (*Skill, error)
+	UpdateSkillDescriptionByKey(key string, description string, expectedVersion int64) (*Skill, error)
+	UpdateSkillLogoByKey(key string, logo string, expectedVersion int64) (*Skill, error)
+	UpdateSkillTagsByKey(key string, tags []string, expectedVersion int64) (*Skill, error)
+	DeleteSkillByKey(key string, expectedVersion int64) error
+	SaveSkill(skill Skill) error
 }
 
 func ScanSkill(rows *sql.Row, skill *Skill) error {
-	err := rows.Scan(&skill.Key, &skill.Name, &skill.Description, &skill.Logo, pq.Array(&skill.Tags))
+	err := rows.Scan(&skill.Key, &skill.Name, &skill.Description, &skill.Logo, pq.Array(&skill.Tags), &skill.Version)
 	return err
 }
 
 func NewSkillRepo(db *sql.DB) SkillRepo {
-	return &skillRepo{db: db}
+	return &skillRepo{db: db, conn: db}
+}
+
+// ProcessEvent runs fn against a repo bound to a new transaction and records
+// eventID as processed in that same transaction. It returns ErrDuplicateEvent
+// without calling fn when the event was already applied. An empty eventID is
+// never deduplicated.
+func (r *skillRepo) ProcessEvent(eventID string, fn func(repo SkillRepo) error) error {
+	return r.ProcessBatch(func(repo SkillRepo) error {
+		if err := repo.MarkProcessed(eventID); err != nil {
+			return err
+		}
+		return fn(repo)
+	})
+}
+
+// ProcessBatch runs fn against a repo bound to a new transaction and commits
+// it when fn succeeds. It records nothing by itself, fn marks each event it
+// applies with MarkProcessed.
+func (r *skillRepo) ProcessBatch(fn func(repo SkillRepo) error) error {
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&skillRepo{db: tx, conn: r.conn}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MarkProcessed records eventID as processed, or returns ErrDuplicateEvent
+// when it already was. An empty eventID is never deduplicated.
+func (r *skillRepo) MarkProcessed(eventID string) error {
+	if eventID == "" {
+		return nil
+	}
+	query := "INSERT INTO processed_events (event_id, processed_at) VALUES ($1, $2) ON CONFLICT (event_id) DO NOTHING"
+	result, err := r.db.Exec(query, eventID, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return ErrDuplicateEvent
+	}
+	return nil
+}
+
+// versionConflict turns a conditional write that matched no row into
+// ErrVersionConflict when the skill exists at another version. Other errors,
+// and a write to a missing skill, are returned as they are.
+func (r *skillRepo) versionConflict(key string, expectedVersion int64, err error) error {
+	if expectedVersion == 0 || !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	var current int64
+	if scanErr := r.db.QueryRow("SELECT version FROM skill WHERE key=$1", key).Scan(&current); scanErr != nil {
+		return err
+	}
+	return fmt.Errorf("%w: skill %s is at version %d, expected %d", ErrVersionConflict, key, current, expectedVersion)
 }
 
+func (r *skillRepo) GetSkillByKey(key string) (*Skill, error) {
+	skill := Skill{}
+	query := "SELECT key, name, description, logo, tags, version FROM skill WHERE key=$1"
+	record := r.db.QueryRow(query, key)
+	err := ScanSkill(record, &skill)
+	return &skill, err
+}
+
+// CreateSkill starts the skill at version 1, or one past its tombstone when
+// a skill of the same key was deleted before.
 func (r *skillRepo) CreateSkill(skill Skill) (*Skill, error) {
 	createdSkill := Skill{}
-	query := "INSERT INTO skill (key, name, description, logo, tags) VALUES ($1, $2, $3, $4, $5) RETURNING key, name, description, logo, tags"
+	query := "INSERT INTO skill (key, name, description, logo, tags, version) VALUES ($1, $2, $3, $4, $5, COALESCE((SELECT version FROM skill_tombstone WHERE key=$1), 0) + 1) RETURNING key, name, description, logo, tags, version"
 	record := r.db.QueryRow(query, skill.Key, skill.Name, skill.Description, skill.Logo, pq.Array(skill.Tags))
 	err := ScanSkill(record, &createdSkill)
 	return &createdSkill, err
 }
 
-func (r *skillRepo) UpdateSkill(skill Skill) (*Skill, error) {
+func (r *skillRepo) UpdateSkill(skill Skill, expectedVersion int64) (*Skill, error) {
 	updateSkill := Skill{}
-	query := "UPDATE skill SET name=$1, description=$2, logo=$3, tags=$4 WHERE key=$5 RETURNING key, name, description, logo, tags"
-	record := r.db.QueryRow(query, skill.Name, skill.Description, skill.Logo, pq.Array(skill.Tags), skill.Key)
+	query := "UPDATE skill SET name=$1, description=$2, logo=$3, tags=$4, version=version+1 WHERE key=$5 AND ($6 = 0 OR version=$6) RETURNING key, name, description, logo, tags, version"
+	record := r.db.QueryRow(query, skill.Name, skill.Description, skill.Logo, pq.Array(skill.Tags), skill.Key, expectedVersion)
 	err := ScanSkill(record, &updateSkill)
-	return &updateSkill, err
+	return &updateSkill, r.versionConflict(skill.Key, expectedVersion, err)
 }
 
-func (r *skillRepo) UpdateSkillNameByKey(key string, name string) (*Skill, error) {
+func (r *skillRepo) UpdateSkillNameByKey(key string, name string, expectedVersion int64) (*Skill, error) {
 	updateSkill := Skill{}
-	query := "UPDATE skill SET name=$1 WHERE key=$2 RETURNING key, name, description, logo, tags"
-	record := r.db.QueryRow(query, name, key)
+	query := "UPDATE skill SET name=$1, version=version+1 WHERE key=$2 AND ($3 = 0 OR version=$3) RETURNING key, name, description, logo, tags, version"
+	record := r.db.QueryRow(query, name, key, expectedVersion)
 	err := ScanSkill(record, &updateSkill)
-	return &updateSkill, err
+	return &updateSkill, r.versionConflict(key, expectedVersion, err)
 }
 
-func (r *skillRepo) UpdateSkillDescriptionByKey(key string, description string) (*Skill, error) {
+func (r *skillRepo) UpdateSkillDescriptionByKey(key string, description string, expectedVersion int64) (*Skill, error) {
 	updatedSkill := Skill{}
-	query := "UPDATE skill SET description=$1 WHERE key=$2 RETURNING key, name, description, logo, tags"
-	record := r.db.QueryRow(query, description, key)
+	query := "UPDATE skill SET description=$1, version=version+1 WHERE key=$2 AND ($3 = 0 OR version=$3) RETURNING key, name, description, logo, tags, version"
+	record := r.db.QueryRow(query, description, key, expectedVersion)
 	err := ScanSkill(record, &updatedSkill)
-	return &updatedSkill, err
+	return &updatedSkill, r.versionConflict(key, expectedVersion, err)
 }
 
-func (r *skillRepo) UpdateSkillLogoByKey(key string, logo string) (*Skill, error) {
+func (r *skillRepo) UpdateSkillLogoByKey(key string, logo string, expectedVersion int64) (*Skill, error) {
 	updatedSkill := Skill{}
-	query := "UPDATE skill SET logo=$1 WHERE key=$2 RETURNING key, name, description, logo, tags"
-	record := r.db.QueryRow(query, logo, key)
+	query := "UPDATE skill SET logo=$1, version=version+1 WHERE key=$2 AND ($3 = 0 OR version=$3) RETURNING key, name, description, logo, tags, version"
+	record := r.db.QueryRow(query, logo, key, expectedVersion)
 	err := ScanSkill(record, &updatedSkill)
-	return &updatedSkill, err
+	return &updatedSkill, r.versionConflict(key, expectedVersion, err)
 }
 
-func (r *skillRepo) UpdateSkillTagsByKey(key string, tags []string) (*Skill, error) {
+func (r *skillRepo) UpdateSkillTagsByKey(key string, tags []string, expectedVersion int64) (*Skill, error) {
 	updatedSkill := Skill{}
-	query := "UPDATE skill SET tags=$1 WHERE key=$2 RETURNING key, name, description, logo, tags"
-	record := r.db.QueryRow(query, pq.Array(tags), key)
+	query := "UPDATE skill SET tags=$1, version=version+1 WHERE key=$2 AND ($3 = 0 OR version=$3) RETURNING key, name, description, logo, tags, version"
+	record := r.db.QueryRow(query, pq.Array(tags), key, expectedVersion)
 	err := ScanSkill(record, &updatedSkill)
-	return &updatedSkill, err
+	return &updatedSkill, r.versionConflict(key, expectedVersion, err)
 }
 
-func (r *skillRepo) DeleteSkillByKey(key string) error {
-	query := "DELETE FROM skill WHERE key=$1"
-	result, err := r.db.Exec(query, key)
+// DeleteSkillByKey deletes the skill and leaves a tombstone one version past
+// it, the version of its SkillDeleted change.
+func (r *skillRepo) DeleteSkillByKey(key string, expectedVersion int64) error {
+	var version int64
+	query := "DELETE FROM skill WHERE key=$1 AND ($2 = 0 OR version=$2) RETURNING version"
+	err := r.db.QueryRow(query, key, expectedVersion).Scan(&version)
+
+	// Deleting a missing skill stays a no-op, only a stale version is an error.
+	if errors.Is(err, sql.ErrNoRows) {
+		if err := r.versionConflict(key, expectedVersion, err); errors.Is(err, ErrVersionConflict) {
+			return err
+		}
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
-	_, err = result.RowsAffected()
+	query = "INSERT INTO skill_tombstone (key, version) VALUES ($1, $2) ON CONFLICT (key) DO UPDATE SET version=excluded.version"
+	_, err = r.db.Exec(query, key, version+1)
+	return err
+}
 
+// SaveSkill writes every field of an existing skill as it is, version
+// included. It is for writes already checked by the caller, such as a folded
+// run of updates.
+func (r *skillRepo) SaveSkill(skill Skill) error {
+	query := "UPDATE skill SET name=$1, description=$2, logo=$3, tags=$4, version=$5 WHERE key=$6"
+	result, err := r.db.Exec(query, skill.Name, skill.Description, skill.Logo, pq.Array(skill.Tags), skill.Version, skill.Key)
 	if err != nil {
 		return err
 	}
-
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return sql.ErrNoRows
+	}
 	return nil
 }
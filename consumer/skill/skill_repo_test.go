@@ -2,7 +2,10 @@ package skill_test
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"savedb/skill"
+	"skillevent"
 	"testing"
 
 	"github.com/lib/pq"
@@ -18,7 +21,55 @@ func newMockDB() *sql.DB {
 		name TEXT NOT NULL DEFAULT '',
 		description TEXT NOT NULL DEFAULT '',
 		logo TEXT NOT NULL DEFAULT '',
-		tags TEXT [] NOT NULL DEFAULT '{}'
+		tags TEXT [] NOT NULL DEFAULT '{}',
+		version INTEGER NOT NULL DEFAULT 1
+	);
+		CREATE TABLE IF NOT EXISTS command (
+		id TEXT PRIMARY KEY,
+		action TEXT NOT NULL,
+		skill_key TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+		CREATE TABLE IF NOT EXISTS processed_events (
+		event_id TEXT PRIMARY KEY,
+		processed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+		CREATE TABLE IF NOT EXISTS change_outbox (
+		seq INTEGER PRIMARY KEY AUTOINCREMENT,
+		id TEXT NOT NULL UNIQUE,
+		skill_key TEXT NOT NULL,
+		version BIGINT NOT NULL,
+		type TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		sent_at TIMESTAMP,
+		UNIQUE (skill_key, version)
+	);
+		CREATE TABLE IF NOT EXISTS skill_tombstone (
+		key TEXT PRIMARY KEY,
+		version INTEGER NOT NULL
+	);
+		CREATE TABLE IF NOT EXISTS skill_audit (
+		seq INTEGER PRIMARY KEY AUTOINCREMENT,
+		skill_key TEXT NOT NULL,
+		action TEXT NOT NULL,
+		version INTEGER NOT NULL DEFAULT 0,
+		actor TEXT NOT NULL DEFAULT '',
+		event_id TEXT NOT NULL,
+		correlation_id TEXT NOT NULL DEFAULT '',
+		source_topic TEXT NOT NULL,
+		source_partition INTEGER NOT NULL,
+		source_offset INTEGER NOT NULL,
+		metadata TEXT NOT NULL DEFAULT '{}',
+		diff TEXT NOT NULL,
+		occurred_at TIMESTAMP NOT NULL,
+		recorded_at TIMESTAMP NOT NULL
 	);
 	`
 	db.Exec(q)
@@ -74,7 +125,7 @@ func TestUpdateSkillRepo(t *testing.T) {
 	}
 
 	// Act
-	mockRepo.UpdateSkill(want)
+	mockRepo.UpdateSkill(want, 0)
 
 	// Assert
 	if getCount(db) != 1 {
@@ -103,7 +154,7 @@ func TestUpdateSkillNameByKey(t *testing.T) {
 
 	want := "nameupdate"
 	//act
-	mockRepo.UpdateSkillNameByKey("key", want)
+	mockRepo.UpdateSkillNameByKey("key", want, 0)
 
 	//assert
 	result := getData(db, "key")
@@ -124,7 +175,7 @@ func TestUpdateSkillDescriptionByKey(t *testing.T) {
 
 	want := "descriptionupdate"
 	//act
-	mockRepo.UpdateSkillDescriptionByKey("key", want)
+	mockRepo.UpdateSkillDescriptionByKey("key", want, 0)
 
 	//assert
 	result := getData(db, "key")
@@ -145,7 +196,7 @@ func TestUpdateSkillLogoByKey(t *testing.T) {
 
 	want := "Logoupdate"
 	//act
-	mockRepo.UpdateSkillLogoByKey("key", want)
+	mockRepo.UpdateSkillLogoByKey("key", want, 0)
 
 	//assert
 	result := getData(db, "key")
@@ -166,7 +217,7 @@ func TestUpdateSkillTagsByKey(t *testing.T) {
 
 	want := []string{"tag1", "tag4"}
 	//act
-	mockRepo.UpdateSkillTagsByKey("key", want)
+	mockRepo.UpdateSkillTagsByKey("key", want, 0)
 
 	//assert
 	result := getData(db, "key")
@@ -187,7 +238,7 @@ func TestDeleteSkill(t *testing.T) {
 		db.Exec("INSERT INTO skill (key, name, description, logo, tags) VALUES ('key', 'name', 'description', 'logo', '{tag2,tag3}')")
 
 		//act
-		mockRepo.DeleteSkillByKey("key")
+		mockRepo.DeleteSkillByKey("key", 0)
 
 		if getCount(db) != 0 {
 			t.Errorf("expected 1 row, got %d\n", getCount(db))
@@ -202,10 +253,333 @@ func TestDeleteSkill(t *testing.T) {
 		db.Exec("INSERT INTO skill (key, name, description, logo, tags) VALUES ('key', 'name', 'description', 'logo', '{tag2,tag3}')")
 
 		//act
-		mockRepo.DeleteSkillByKey("notkey")
+		mockRepo.DeleteSkillByKey("notkey", 0)
 
 		if getCount(db) != 1 {
 			t.Errorf("expected 1 row, got %d\n", getCount(db))
 		}
 	})
 }
+
+func TestSkillVersion(t *testing.T) {
+	t.Run("should increment version on every mutation", func(t *testing.T) {
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		created, _ := repo.CreateSkill(skill.Skill{Key: "go", Tags: []string{}})
+		named, _ := repo.UpdateSkillNameByKey("go", "golang", 1)
+		tagged, err := repo.UpdateSkillTagsByKey("go", []string{"lang"}, 0)
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), created.Version)
+		assert.Equal(t, int64(2), named.Version)
+		assert.Equal(t, int64(3), tagged.Version)
+	})
+	t.Run("should reject update based on stale version", func(t *testing.T) {
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		repo := skill.NewSkillRepo(db)
+		db.Exec("INSERT INTO skill (key, name, description, logo, tags, version) VALUES ('go', 'go', 'description', 'logo', '{tag2,tag3}', 4)")
+
+		//act
+		_, err := repo.UpdateSkill(skill.Skill{Key: "go", Name: "stale"}, 3)
+
+		//assert
+		assert.ErrorIs(t, err, skill.ErrVersionConflict)
+		assert.Equal(t, "go", getData(db, "go").Name)
+	})
+	t.Run("should reject delete based on stale version", func(t *testing.T) {
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		repo := skill.NewSkillRepo(db)
+		db.Exec("INSERT INTO skill (key, name, description, logo, tags, version) VALUES ('go', 'go', 'description', 'logo', '{tag2,tag3}', 4)")
+
+		//act
+		err := repo.DeleteSkillByKey("go", 3)
+
+		//assert
+		assert.ErrorIs(t, err, skill.ErrVersionConflict)
+		assert.Equal(t, 1, getCount(db))
+	})
+	t.Run("should go on from the deleted skill when it is created again", func(t *testing.T) {
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		repo := skill.NewSkillRepo(db)
+		repo.CreateSkill(skill.Skill{Key: "go", Tags: []string{}})
+		repo.UpdateSkillNameByKey("go", "golang", 1)
+
+		//act
+		deleteErr := repo.DeleteSkillByKey("go", 2)
+		created, err := repo.CreateSkill(skill.Skill{Key: "go", Tags: []string{}})
+		other, _ := repo.CreateSkill(skill.Skill{Key: "python", Tags: []string{}})
+
+		//assert
+		assert.NoError(t, deleteErr)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(4), created.Version)
+		assert.Equal(t, int64(1), other.Version)
+	})
+	t.Run("should not report conflict when skill is missing", func(t *testing.T) {
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		repo := skill.NewSkillRepo(db)
+
+		//act
+		_, err := repo.UpdateSkillNameByKey("go", "golang", 3)
+
+		//assert
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		assert.NotErrorIs(t, err, skill.ErrVersionConflict)
+	})
+}
+
+func TestUpdateCommandStatus(t *testing.T) {
+	//arange
+	db := newMockDB()
+	defer db.Close()
+	commandRepo := skill.NewCommandRepo(db)
+
+	db.Exec("INSERT INTO command (id, action, skill_key) VALUES ('command-id', 'update_name', 'key')")
+
+	//act
+	err := commandRepo.UpdateCommandStatus("command-id", skill.CommandFailed, "skill not found")
+
+	//assert
+	if err != nil {
+		t.Errorf("expected error to be nil but got %v", err)
+	}
+
+	var status, message string
+	db.QueryRow("SELECT status, error FROM command WHERE id = $1", "command-id").Scan(&status, &message)
+	assert.Equal(t, string(skill.CommandFailed), status)
+	assert.Equal(t, "skill not found", message)
+}
+
+func TestProcessEvent(t *testing.T) {
+	t.Run("should apply event and skip it when delivered again", func(t *testing.T) {
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		mockRepo := skill.NewSkillRepo(db)
+		create := func(repo skill.SkillRepo) error {
+			_, err := repo.CreateSkill(skill.Skill{Key: "key", Name: "name", Tags: []string{"tag1"}})
+			return err
+		}
+
+		//act
+		err := mockRepo.ProcessEvent("event-id", create)
+		errDuplicate := mockRepo.ProcessEvent("event-id", create)
+
+		//assert
+		if err != nil {
+			t.Errorf("expected error to be nil but got %v", err)
+		}
+		if !errors.Is(errDuplicate, skill.ErrDuplicateEvent) {
+			t.Errorf("expected ErrDuplicateEvent but got %v", errDuplicate)
+		}
+		if getCount(db) != 1 {
+			t.Errorf("expected 1 row, got %d\n", getCount(db))
+		}
+	})
+	t.Run("should not record event when mutation fail", func(t *testing.T) {
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		mockRepo := skill.NewSkillRepo(db)
+
+		//act
+		err := mockRepo.ProcessEvent("event-id", func(repo skill.SkillRepo) error {
+			repo.CreateSkill(skill.Skill{Key: "key", Name: "name", Tags: []string{"tag1"}})
+			return errors.New("boom")
+		})
+
+		//assert
+		if err == nil {
+			t.Errorf("expected error but got %v", err)
+		}
+
+		var count int
+		db.QueryRow("SELECT COUNT(*) FROM processed_events").Scan(&count)
+		assert.Equal(t, 0, count)
+		if getCount(db) != 0 {
+			t.Errorf("expected 0 row, got %d\n", getCount(db))
+		}
+	})
+}
+
+func TestSaveSkillRepo(t *testing.T) {
+	t.Run("should write every field and the version as they are", func(t *testing.T) {
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		mockRepo := skill.NewSkillRepo(db)
+		db.Exec("INSERT INTO skill (key, name, description, logo, tags) VALUES ('key', 'name', 'description', 'logo', '{tag1}')")
+
+		//act
+		err := mockRepo.SaveSkill(skill.Skill{Key: "key", Name: "new", Description: "desc", Logo: "logo2", Tags: []string{"tag2"}, Version: 4})
+
+		//assert
+		assert.NoError(t, err)
+		got, _ := mockRepo.GetSkillByKey("key")
+		assert.Equal(t, skill.Skill{Key: "key", Name: "new", Description: "desc", Logo: "logo2", Tags: []string{"tag2"}, Version: 4}, *got)
+	})
+	t.Run("should return ErrNoRows when the skill does not exist", func(t *testing.T) {
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		mockRepo := skill.NewSkillRepo(db)
+
+		//act
+		err := mockRepo.SaveSkill(skill.Skill{Key: "key", Name: "new", Tags: []string{}, Version: 2})
+
+		//assert
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+}
+
+func getChanges(db *sql.DB, key string) []skillevent.Change {
+	changes := []skillevent.Change{}
+	records, _ := db.Query("SELECT payload FROM change_outbox WHERE skill_key = $1 ORDER BY seq", key)
+	defer records.Close()
+	for records.Next() {
+		var payload string
+		records.Scan(&payload)
+		change := skillevent.Change{}
+		json.Unmarshal([]byte(payload), &change)
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+func TestRecordChange(t *testing.T) {
+	t.Run("should queue created, updated and deleted changes with the versions of the skill", func(t *testing.T) {
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		mockRepo := skill.NewSkillRepo(db)
+		v1 := &skill.Skill{Key: "go", Name: "go", Tags: []string{}, Version: 1}
+		v2 := &skill.Skill{Key: "go", Name: "golang", Tags: []string{}, Version: 2}
+		v4 := &skill.Skill{Key: "go", Name: "go", Tags: []string{}, Version: 4}
+		event := skillevent.Envelope{ID: "event-id", CorrelationID: "command-id"}
+
+		//act
+		mockRepo.RecordChange(event, nil, v1)
+		mockRepo.RecordChange(event, v1, v2)
+		mockRepo.RecordChange(event, v2, nil)
+		mockRepo.RecordChange(event, nil, v4)
+		mockRepo.RecordChange(event, nil, nil)
+
+		//assert
+		changes := getChanges(db, "go")
+		assert.Len(t, changes, 4)
+		types := []skillevent.ChangeType{}
+		versions := []int64{}
+		for _, change := range changes {
+			types = append(types, change.Type)
+			versions = append(versions, change.Version)
+		}
+		assert.Equal(t, []skillevent.ChangeType{skillevent.SkillCreated, skillevent.SkillUpdated, skillevent.SkillDeleted, skillevent.SkillCreated}, types)
+		assert.Equal(t, []int64{1, 2, 3, 4}, versions)
+		assert.Equal(t, "go:2", changes[1].ID)
+		assert.Equal(t, "event-id", changes[1].CausationID)
+		assert.Equal(t, "command-id", changes[1].CorrelationID)
+		assert.JSONEq(t, `{"key":"go","name":"go","description":"","logo":"","tags":[],"version":1}`, string(changes[1].Before))
+		assert.JSONEq(t, `{"key":"go","name":"golang","description":"","logo":"","tags":[],"version":2}`, string(changes[1].After))
+		assert.Nil(t, changes[2].After)
+	})
+	t.Run("should not queue change when transaction is rolled back", func(t *testing.T) {
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		mockRepo := skill.NewSkillRepo(db)
+
+		//act
+		mockRepo.ProcessEvent("event-id", func(repo skill.SkillRepo) error {
+			repo.RecordChange(skillevent.Envelope{ID: "event-id"}, nil, &skill.Skill{Key: "go"})
+			return errors.New("boom")
+		})
+
+		//assert
+		assert.Empty(t, getChanges(db, "go"))
+	})
+}
+
+type auditRow struct {
+	Action   string
+	Version  int64
+	Actor    string
+	EventID  string
+	Offset   int64
+	Metadata string
+	Diff     string
+}
+
+func getAudits(db *sql.DB, key string) []auditRow {
+	audits := []auditRow{}
+	records, _ := db.Query("SELECT action, version, actor, event_id, source_offset, metadata, diff FROM skill_audit WHERE skill_key = $1 ORDER BY seq", key)
+	defer records.Close()
+	for records.Next() {
+		audit := auditRow{}
+		records.Scan(&audit.Action, &audit.Version, &audit.Actor, &audit.EventID, &audit.Offset, &audit.Metadata, &audit.Diff)
+		audits = append(audits, audit)
+	}
+	return audits
+}
+
+func TestRecordAudit(t *testing.T) {
+	t.Run("should append actor, source and field diff of each change", func(t *testing.T) {
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		mockRepo := skill.NewSkillRepo(db)
+		v1 := &skill.Skill{Key: "go", Name: "go", Tags: []string{"lang"}, Version: 1}
+		v2 := &skill.Skill{Key: "go", Name: "golang", Tags: []string{"lang"}, Version: 2}
+		event := skillevent.Envelope{
+			ID:       "event-id",
+			Type:     skill.UpdateNameAction,
+			Actor:    "alice",
+			Metadata: map[string]string{"request_id": "req-1"},
+		}
+
+		//act
+		mockRepo.RecordAudit(event, skill.AuditSource{Topic: "skills", Partition: 1, Offset: 7}, nil, v1)
+		mockRepo.RecordAudit(event, skill.AuditSource{Topic: "skills", Partition: 1, Offset: 8}, v1, v2)
+		mockRepo.RecordAudit(event, skill.AuditSource{Topic: "skills", Partition: 1, Offset: 9}, v2, nil)
+		mockRepo.RecordAudit(event, skill.AuditSource{Topic: "skills", Partition: 1, Offset: 10}, nil, nil)
+
+		//assert
+		audits := getAudits(db, "go")
+		assert.Len(t, audits, 3)
+		assert.Equal(t, "alice", audits[1].Actor)
+		assert.Equal(t, string(skill.UpdateNameAction), audits[1].Action)
+		assert.Equal(t, int64(8), audits[1].Offset)
+		assert.Equal(t, []int64{1, 2, 0}, []int64{audits[0].Version, audits[1].Version, audits[2].Version})
+		assert.JSONEq(t, `{"request_id":"req-1"}`, audits[1].Metadata)
+		assert.JSONEq(t, `[{"field":"name","from":null,"to":"go"},{"field":"description","from":null,"to":""},{"field":"logo","from":null,"to":""},{"field":"tags","from":null,"to":["lang"]}]`, audits[0].Diff)
+		assert.JSONEq(t, `[{"field":"name","from":"go","to":"golang"}]`, audits[1].Diff)
+		assert.JSONEq(t, `[{"field":"name","from":"golang","to":null},{"field":"description","from":"","to":null},{"field":"logo","from":"","to":null},{"field":"tags","from":["lang"],"to":null}]`, audits[2].Diff)
+	})
+	t.Run("should not append audit when transaction is rolled back", func(t *testing.T) {
+		//arange
+		db := newMockDB()
+		defer db.Close()
+		mockRepo := skill.NewSkillRepo(db)
+
+		//act
+		mockRepo.ProcessEvent("event-id", func(repo skill.SkillRepo) error {
+			repo.RecordAudit(skillevent.Envelope{ID: "event-id", Type: skill.CreateSkillAction}, skill.AuditSource{}, nil, &skill.Skill{Key: "go"})
+			return errors.New("boom")
+		})
+
+		//assert
+		assert.Empty(t, getAudits(db, "go"))
+	})
+}
@@ -0,0 +1,77 @@
+package skill
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	DeadLetterErrorHeader     = "dlq-error"
+	DeadLetterTopicHeader     = "dlq-source-topic"
+	DeadLetterPartitionHeader = "dlq-source-partition"
+	DeadLetterOffsetHeader    = "dlq-source-offset"
+	DeadLetterAttemptsHeader  = "dlq-attempts"
+)
+
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Backoff returns how long to wait after the given failed attempt (starting at 1).
+// The wait doubles on every attempt and is capped at MaxBackoff.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || backoff < p.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return backoff
+}
+
+type DeadLetterPublisher interface {
+	PublishDeadLetter(msg *sarama.ConsumerMessage, cause error, attempts int) error
+}
+
+type deadLetterProducer struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+func NewDeadLetterProducer(producer sarama.SyncProducer, topic string) *deadLetterProducer {
+	return &deadLetterProducer{producer: producer, topic: topic}
+}
+
+func (p *deadLetterProducer) PublishDeadLetter(msg *sarama.ConsumerMessage, cause error, attempts int) error {
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+5)
+	for _, header := range msg.Headers {
+		headers = append(headers, *header)
+	}
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(DeadLetterErrorHeader), Value: []byte(cause.Error())},
+		sarama.RecordHeader{Key: []byte(DeadLetterTopicHeader), Value: []byte(msg.Topic)},
+		sarama.RecordHeader{Key: []byte(DeadLetterPartitionHeader), Value: []byte(strconv.FormatInt(int64(msg.Partition), 10))},
+		sarama.RecordHeader{Key: []byte(DeadLetterOffsetHeader), Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		sarama.RecordHeader{Key: []byte(DeadLetterAttemptsHeader), Value: []byte(strconv.Itoa(attempts))},
+	)
+
+	deadLetter := &sarama.ProducerMessage{
+		Topic:   p.topic,
+		Key:     sarama.ByteEncoder(msg.Key),
+		Value:   sarama.ByteEncoder(msg.Value),
+		Headers: headers,
+	}
+	partition, offset, err := p.producer.SendMessage(deadLetter)
+	if err != nil {
+		log.Printf("FAILED to send dead letter: %s\n", err)
+		return err
+	}
+	log.Printf("> dead letter sent to partition %d at offset %d\n", partition, offset)
+	return nil
+}
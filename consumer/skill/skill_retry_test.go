@@ -0,0 +1,345 @@
+package skill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"skillevent"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockSyncProducer struct {
+	sarama.SyncProducer
+	msgs []*sarama.ProducerMessage
+	err  error
+}
+
+func (m *mockSyncProducer) SendMessage(msg *sarama.ProducerMessage) (partition int32, offset int64, err error) {
+	m.msgs = append(m.msgs, msg)
+	return 0, 0, m.err
+}
+
+type mockDeadLetter struct {
+	msg      *sarama.ConsumerMessage
+	cause    error
+	attempts int
+	err      error
+}
+
+func (m *mockDeadLetter) PublishDeadLetter(msg *sarama.ConsumerMessage, cause error, attempts int) error {
+	m.msg = msg
+	m.cause = cause
+	m.attempts = attempts
+	return m.err
+}
+
+type mockCommandRepo struct {
+	id      string
+	status  CommandStatus
+	message string
+}
+
+func (m *mockCommandRepo) UpdateCommandStatus(id string, status CommandStatus, message string) error {
+	m.id = id
+	m.status = status
+	m.message = message
+	return nil
+}
+
+type mockResults struct {
+	outcomes []skillevent.Outcome
+	cause    error
+	err      error
+}
+
+func (m *mockResults) PublishResult(msg *sarama.ConsumerMessage, outcome skillevent.Outcome, cause error) error {
+	m.outcomes = append(m.outcomes, outcome)
+	m.cause = cause
+	return m.err
+}
+
+type mockSession struct {
+	sarama.ConsumerGroupSession
+	ctx    context.Context
+	marked []*sarama.ConsumerMessage
+}
+
+func (m *mockSession) Context() context.Context {
+	return m.ctx
+}
+
+func (m *mockSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	m.marked = append(m.marked, msg)
+}
+
+type mockClaim struct {
+	sarama.ConsumerGroupClaim
+	msgs chan *sarama.ConsumerMessage
+}
+
+func (m *mockClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return m.msgs
+}
+
+func (m *mockClaim) HighWaterMarkOffset() int64 {
+	return 0
+}
+
+func newMockClaim(msgs ...*sarama.ConsumerMessage) *mockClaim {
+	claim := &mockClaim{msgs: make(chan *sarama.ConsumerMessage, len(msgs))}
+	for _, msg := range msgs {
+		claim.msgs <- msg
+	}
+	close(claim.msgs)
+	return claim
+}
+
+type flakySkillRepository struct {
+	MockSkillRepository
+	failures int
+	calls    int
+}
+
+func (r *flakySkillRepository) ProcessEvent(eventID string, fn func(repo SkillRepo) error) error {
+	return fn(r)
+}
+
+func (r *flakySkillRepository) CreateSkill(skill Skill) (*Skill, error) {
+	r.calls++
+	if r.calls <= r.failures {
+		return nil, errors.New("database is unavailable")
+	}
+	return &skill, nil
+}
+
+type conflictSkillRepository struct {
+	flakySkillRepository
+}
+
+func (r *conflictSkillRepository) ProcessEvent(eventID string, fn func(repo SkillRepo) error) error {
+	return fn(r)
+}
+
+func (r *conflictSkillRepository) CreateSkill(skill Skill) (*Skill, error) {
+	r.calls++
+	return nil, fmt.Errorf("%w: skill go is at version 2, expected 1", ErrVersionConflict)
+}
+
+func newCreateMessage() *sarama.ConsumerMessage {
+	msg := newEventMessage(skillevent.Envelope{
+		ID:            "event-id",
+		Type:          CreateSkillAction,
+		CorrelationID: "command-id",
+	}, Skill{Key: "go", Name: "go"})
+	msg.Topic = "skills"
+	msg.Partition = 2
+	msg.Offset = 42
+	msg.Headers = []*sarama.RecordHeader{
+		{Key: []byte("source"), Value: []byte("test")},
+	}
+	return msg
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	assert.Equal(t, 100*time.Millisecond, policy.Backoff(1))
+	assert.Equal(t, 200*time.Millisecond, policy.Backoff(2))
+	assert.Equal(t, 400*time.Millisecond, policy.Backoff(3))
+	assert.Equal(t, 800*time.Millisecond, policy.Backoff(4))
+	assert.Equal(t, time.Second, policy.Backoff(5))
+	assert.Equal(t, time.Second, policy.Backoff(50))
+}
+
+func TestPublishDeadLetter(t *testing.T) {
+	t.Run("should publish original message with dead-letter headers", func(t *testing.T) {
+		//arange
+		producer := &mockSyncProducer{}
+		deadLetter := NewDeadLetterProducer(producer, "skills.dlq")
+		msg := newCreateMessage()
+
+		//act
+		err := deadLetter.PublishDeadLetter(msg, errors.New("boom"), 3)
+
+		//assert
+		if err != nil {
+			t.Errorf("expected error to be nil but got %v", err)
+		}
+		assert.Len(t, producer.msgs, 1)
+		sent := producer.msgs[0]
+		assert.Equal(t, "skills.dlq", sent.Topic)
+		assert.Equal(t, sarama.ByteEncoder(msg.Key), sent.Key)
+		assert.Equal(t, sarama.ByteEncoder(msg.Value), sent.Value)
+		assert.Equal(t, []sarama.RecordHeader{
+			{Key: []byte("source"), Value: []byte("test")},
+			{Key: []byte(DeadLetterErrorHeader), Value: []byte("boom")},
+			{Key: []byte(DeadLetterTopicHeader), Value: []byte("skills")},
+			{Key: []byte(DeadLetterPartitionHeader), Value: []byte("2")},
+			{Key: []byte(DeadLetterOffsetHeader), Value: []byte("42")},
+			{Key: []byte(DeadLetterAttemptsHeader), Value: []byte("3")},
+		}, sent.Headers)
+	})
+	t.Run("should return error when producer fail", func(t *testing.T) {
+		//arange
+		producer := &mockSyncProducer{err: errors.New("broker down")}
+		deadLetter := NewDeadLetterProducer(producer, "skills.dlq")
+
+		//act
+		err := deadLetter.PublishDeadLetter(newCreateMessage(), errors.New("boom"), 3)
+
+		//assert
+		if err == nil {
+			t.Errorf("expected error but got %v", err)
+		}
+	})
+}
+
+func TestConsumeClaimRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	t.Run("should retry and mark message when handler recovers", func(t *testing.T) {
+		//arange
+		repo := &flakySkillRepository{failures: 2}
+		deadLetter := &mockDeadLetter{}
+		commandRepo := &mockCommandRepo{}
+		results := &mockResults{}
+		consumer := NewConsumerGroup(NewSkillEventHandler(repo), policy, deadLetter, commandRepo, results)
+		sess := &mockSession{ctx: context.Background()}
+		msg := newCreateMessage()
+
+		//act
+		err := consumer.ConsumeClaim(sess, newMockClaim(msg))
+
+		//assert
+		if err != nil {
+			t.Errorf("expected error to be nil but got %v", err)
+		}
+		assert.Equal(t, 3, repo.calls)
+		assert.Nil(t, deadLetter.msg)
+		assert.Equal(t, []*sarama.ConsumerMessage{msg}, sess.marked)
+		assert.Equal(t, "command-id", commandRepo.id)
+		assert.Equal(t, CommandApplied, commandRepo.status)
+		assert.Equal(t, []skillevent.Outcome{skillevent.OutcomeApplied}, results.outcomes)
+	})
+	t.Run("should send to dead-letter topic and mark message when retries are exhausted", func(t *testing.T) {
+		//arange
+		repo := &flakySkillRepository{failures: 10}
+		deadLetter := &mockDeadLetter{}
+		commandRepo := &mockCommandRepo{}
+		results := &mockResults{}
+		consumer := NewConsumerGroup(NewSkillEventHandler(repo), policy, deadLetter, commandRepo, results)
+		sess := &mockSession{ctx: context.Background()}
+		msg := newCreateMessage()
+
+		//act
+		err := consumer.ConsumeClaim(sess, newMockClaim(msg))
+
+		//assert
+		if err != nil {
+			t.Errorf("expected error to be nil but got %v", err)
+		}
+		assert.Equal(t, 3, repo.calls)
+		assert.Equal(t, msg, deadLetter.msg)
+		assert.Equal(t, 3, deadLetter.attempts)
+		assert.EqualError(t, deadLetter.cause, "database is unavailable")
+		assert.Equal(t, []*sarama.ConsumerMessage{msg}, sess.marked)
+		assert.Equal(t, "command-id", commandRepo.id)
+		assert.Equal(t, CommandFailed, commandRepo.status)
+		assert.Equal(t, "database is unavailable", commandRepo.message)
+		assert.Equal(t, []skillevent.Outcome{skillevent.OutcomeFailed}, results.outcomes)
+		assert.EqualError(t, results.cause, "database is unavailable")
+	})
+	t.Run("should record conflict without retry when write is stale", func(t *testing.T) {
+		//arange
+		repo := &conflictSkillRepository{}
+		deadLetter := &mockDeadLetter{}
+		commandRepo := &mockCommandRepo{}
+		results := &mockResults{}
+		consumer := NewConsumerGroup(NewSkillEventHandler(repo), policy, deadLetter, commandRepo, results)
+		sess := &mockSession{ctx: context.Background()}
+		msg := newCreateMessage()
+
+		//act
+		err := consumer.ConsumeClaim(sess, newMockClaim(msg))
+
+		//assert
+		if err != nil {
+			t.Errorf("expected error to be nil but got %v", err)
+		}
+		assert.Equal(t, 1, repo.calls)
+		assert.Nil(t, deadLetter.msg)
+		assert.Equal(t, []*sarama.ConsumerMessage{msg}, sess.marked)
+		assert.Equal(t, "command-id", commandRepo.id)
+		assert.Equal(t, CommandConflict, commandRepo.status)
+		assert.Contains(t, commandRepo.message, ErrVersionConflict.Error())
+		assert.Equal(t, []skillevent.Outcome{skillevent.OutcomeRejected}, results.outcomes)
+	})
+	t.Run("should send invalid event to dead-letter topic without retry", func(t *testing.T) {
+		//arange
+		repo := &flakySkillRepository{}
+		deadLetter := &mockDeadLetter{}
+		commandRepo := &mockCommandRepo{}
+		results := &mockResults{}
+		consumer := NewConsumerGroup(NewSkillEventHandler(repo), policy, deadLetter, commandRepo, results)
+		sess := &mockSession{ctx: context.Background()}
+		msg := newEventMessage(skillevent.Envelope{
+			ID:            "event-id",
+			Type:          CreateSkillAction,
+			CorrelationID: "command-id",
+		}, Skill{Key: "go", Name: ""})
+
+		//act
+		err := consumer.ConsumeClaim(sess, newMockClaim(msg))
+
+		//assert
+		if err != nil {
+			t.Errorf("expected error to be nil but got %v", err)
+		}
+		assert.Equal(t, 0, repo.calls)
+		assert.Equal(t, msg, deadLetter.msg)
+		assert.Equal(t, 1, deadLetter.attempts)
+		assert.ErrorIs(t, deadLetter.cause, ErrInvalidEvent)
+		assert.Equal(t, []*sarama.ConsumerMessage{msg}, sess.marked)
+		assert.Equal(t, CommandFailed, commandRepo.status)
+		assert.Contains(t, commandRepo.message, "name: is required")
+		assert.Equal(t, []skillevent.Outcome{skillevent.OutcomeRejected}, results.outcomes)
+	})
+	t.Run("should not mark message when dead-letter publish fail", func(t *testing.T) {
+		//arange
+		repo := &flakySkillRepository{failures: 10}
+		deadLetter := &mockDeadLetter{err: errors.New("broker down")}
+		commandRepo := &mockCommandRepo{}
+		results := &mockResults{}
+		consumer := NewConsumerGroup(NewSkillEventHandler(repo), policy, deadLetter, commandRepo, results)
+		sess := &mockSession{ctx: context.Background()}
+
+		//act
+		err := consumer.ConsumeClaim(sess, newMockClaim(newCreateMessage()))
+
+		//assert
+		if err == nil {
+			t.Errorf("expected error but got %v", err)
+		}
+		assert.Empty(t, sess.marked)
+		assert.Equal(t, CommandStatus(""), commandRepo.status)
+	})
+	t.Run("should not mark message when result publish fail", func(t *testing.T) {
+		//arange
+		repo := &flakySkillRepository{}
+		commandRepo := &mockCommandRepo{}
+		results := &mockResults{err: errors.New("broker down")}
+		consumer := NewConsumerGroup(NewSkillEventHandler(repo), policy, &mockDeadLetter{}, commandRepo, results)
+		sess := &mockSession{ctx: context.Background()}
+
+		//act
+		err := consumer.ConsumeClaim(sess, newMockClaim(newCreateMessage()))
+
+		//assert
+		assert.EqualError(t, err, "broker down")
+		assert.Empty(t, sess.marked)
+	})
+}
@@ -0,0 +1,182 @@
+package skill
+
+import (
+	"context"
+	"platform/tracing"
+	"skillevent"
+	"strconv"
+
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startMessageSpan starts the consumer span of msg, continuing the trace of
+// the producer that wrote the trace context into the message headers.
+func startMessageSpan(msg *sarama.ConsumerMessage) (context.Context, trace.Span) {
+	parent := tracing.Extract(context.Background(), tracing.ConsumerHeaders{Msg: msg})
+	return tracing.Tracer().Start(parent, "process "+msg.Topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(messageAttributes(msg)...),
+	)
+}
+
+// startBatchSpan starts the span of a batch. Its messages come from as many
+// traces, so the span is a root linked to each of them.
+func startBatchSpan(msgs []*sarama.ConsumerMessage) (context.Context, trace.Span) {
+	links := make([]trace.Link, 0, len(msgs))
+	for _, msg := range msgs {
+		ctx := tracing.Extract(context.Background(), tracing.ConsumerHeaders{Msg: msg})
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc, Attributes: messageAttributes(msg)})
+		}
+	}
+	topic := ""
+	if len(msgs) > 0 {
+		topic = msgs[0].Topic
+	}
+	return tracing.Tracer().Start(context.Background(), "process "+topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithNewRoot(),
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypeDeliver,
+			semconv.MessagingDestinationName(topic),
+			semconv.MessagingBatchMessageCount(len(msgs)),
+		),
+	)
+}
+
+func messageAttributes(msg *sarama.ConsumerMessage) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.MessagingSystemKafka,
+		semconv.MessagingOperationTypeDeliver,
+		semconv.MessagingDestinationName(msg.Topic),
+		semconv.MessagingDestinationPartitionID(strconv.Itoa(int(msg.Partition))),
+		semconv.MessagingKafkaMessageOffset(int(msg.Offset)),
+		semconv.MessagingKafkaMessageKey(string(msg.Key)),
+	}
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracedRepo starts a child span of ctx around every repo call. The repos it
+// hands to the transaction callbacks are traced under the transaction's span.
+type tracedRepo struct {
+	repo SkillRepo
+	ctx  context.Context
+}
+
+func traceRepo(ctx context.Context, repo SkillRepo) SkillRepo {
+	return &tracedRepo{repo: repo, ctx: ctx}
+}
+
+func (r *tracedRepo) start(name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, semconv.DBSystemPostgreSQL, semconv.DBOperationName(name))
+	return tracing.Tracer().Start(r.ctx, "SkillRepo."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+func (r *tracedRepo) ProcessEvent(eventID string, fn func(repo SkillRepo) error) (err error) {
+	ctx, span := r.start("ProcessEvent", semconv.MessagingMessageID(eventID))
+	defer func() { endSpan(span, err) }()
+	return r.repo.ProcessEvent(eventID, func(repo SkillRepo) error {
+		return fn(traceRepo(ctx, repo))
+	})
+}
+
+func (r *tracedRepo) ProcessBatch(fn func(repo SkillRepo) error) (err error) {
+	ctx, span := r.start("ProcessBatch")
+	defer func() { endSpan(span, err) }()
+	return r.repo.ProcessBatch(func(repo SkillRepo) error {
+		return fn(traceRepo(ctx, repo))
+	})
+}
+
+func (r *tracedRepo) MarkProcessed(eventID string) (err error) {
+	_, span := r.start("MarkProcessed", semconv.MessagingMessageID(eventID))
+	defer func() { endSpan(span, err) }()
+	return r.repo.MarkProcessed(eventID)
+}
+
+func (r *tracedRepo) GetSkillByKey(key string) (_ *Skill, err error) {
+	_, span := r.start("GetSkillByKey", skillKey(key))
+	defer func() { endSpan(span, err) }()
+	return r.repo.GetSkillByKey(key)
+}
+
+func (r *tracedRepo) RecordChange(event skillevent.Envelope, before *Skill, after *Skill) (err error) {
+	_, span := r.start("RecordChange", semconv.MessagingMessageID(event.ID))
+	defer func() { endSpan(span, err) }()
+	return r.repo.RecordChange(event, before, after)
+}
+
+func (r *tracedRepo) RecordAudit(event skillevent.Envelope, source AuditSource, before *Skill, after *Skill) (err error) {
+	_, span := r.start("RecordAudit", semconv.MessagingMessageID(event.ID))
+	defer func() { endSpan(span, err) }()
+	return r.repo.RecordAudit(event, source, before, after)
+}
+
+func (r *tracedRepo) CreateSkill(skill Skill) (_ *Skill, err error) {
+	_, span := r.start("CreateSkill", skillKey(skill.Key))
+	defer func() { endSpan(span, err) }()
+	return r.repo.CreateSkill(skill)
+}
+
+func (r *tracedRepo) UpdateSkill(skill Skill, expectedVersion int64) (_ *Skill, err error) {
+	_, span := r.start("UpdateSkill", skillKey(skill.Key))
+	defer func() { endSpan(span, err) }()
+	return r.repo.UpdateSkill(skill, expectedVersion)
+}
+
+func (r *tracedRepo) UpdateSkillNameByKey(key string, name string, expectedVersion int64) (_ *Skill, err error) {
+	_, span := r.start("UpdateSkillNameByKey", skillKey(key))
+	defer func() { endSpan(span, err) }()
+	return r.repo.UpdateSkillNameByKey(key, name, expectedVersion)
+}
+
+func (r *tracedRepo) UpdateSkillDescriptionByKey(key string, description string, expectedVersion int64) (_ *Skill, err error) {
+	_, span := r.start("UpdateSkillDescriptionByKey", skillKey(key))
+	defer func() { endSpan(span, err) }()
+	return r.repo.UpdateSkillDescriptionByKey(key, description, expectedVersion)
+}
+
+func (r *tracedRepo) UpdateSkillLogoByKey(key string, logo string, expectedVersion int64) (_ *Skill, err error) {
+	_, span := r.start("UpdateSkillLogoByKey", skillKey(key))
+	defer func() { endSpan(span, err) }()
+	return r.repo.UpdateSkillLogoByKey(key, logo, expectedVersion)
+}
+
+func (r *tracedRepo) UpdateSkillTagsByKey(key string, tags []string, expectedVersion int64) (_ *Skill, err error) {
+	_, span := r.start("UpdateSkillTagsByKey", skillKey(key))
+	defer func() { endSpan(span, err) }()
+	return r.repo.UpdateSkillTagsByKey(key, tags, expectedVersion)
+}
+
+func (r *tracedRepo) DeleteSkillByKey(key string, expectedVersion int64) (err error) {
+	_, span := r.start("DeleteSkillByKey", skillKey(key))
+	defer func() { endSpan(span, err) }()
+	return r.repo.DeleteSkillByKey(key, expectedVersion)
+}
+
+func (r *tracedRepo) SaveSkill(skill Skill) (err error) {
+	_, span := r.start("SaveSkill", skillKey(skill.Key))
+	defer func() { endSpan(span, err) }()
+	return r.repo.SaveSkill(skill)
+}
+
+func skillKey(key string) attribute.KeyValue {
+	return attribute.String("skill.key", key)
+}
@@ -20,9 +20,11 @@ test.describe('GET /api/v1/skills/:key', ()=> {
                 "name": expect.any(String),
                 "description": expect.any(String),
                 "logo": expect.any(String),
-                "tags":expect.any(Array<String>)
+                "tags":expect.any(Array<String>),
+                "version": expect.any(Number)
             }
         }))
+        expect(res.headers()['etag']).toMatch(/^"\d+"$/)
     })
 
     test('should response a skill with status 500 when key is not exist', async ({
@@ -31,14 +33,74 @@ test.describe('GET /api/v1/skills/:key', ()=> {
         const res = await request.get(`/api/v1/skills/java`)
     
         expect(res).not.toBeOK()
+        expect(res.headers()['content-type']).toContain('application/problem+json')
         expect(await res.json()).toEqual(
         expect.objectContaining({
-            "status": "error",
-            "message": "Skill not found"
+            "status": 404,
+            "code": "skill_not_found",
+            "detail": "Skill not found",
+            "request_id": expect.any(String)
         })
     )})
 })
 
+test.describe('GET /api/v1/skills/:key?as_of', () => {
+    test('should response bad request when as_of is not a version or time', async({
+        request
+    }) => {
+        const res = await request.get('/api/v1/skills/go?as_of=yesterday')
+        expect(res.status()).toBe(400)
+        expect(await res.json()).toEqual(
+            expect.objectContaining({
+                "code": "invalid_query"
+            })
+        )
+    })
+})
+
+test.describe('POST /api/v1/skills/:key/actions/revert', () => {
+    test('should response not found when version is not in the history', async({
+        request
+    }) => {
+        const res = await request.post('/api/v1/skills/go/actions/revert', { data: { version: 999 } })
+        expect(res.status()).toBe(404)
+        expect(await res.json()).toEqual(
+            expect.objectContaining({
+                "code": "version_not_found"
+            })
+        )
+    })
+})
+
+test.describe('GET /api/v1/skills/:key/history', () => {
+    test('should response the audit history of a skill', async({
+        request
+    }) => {
+        const res = await request.get('/api/v1/skills/go/history?limit=5')
+        expect(res.ok()).toBeTruthy()
+        expect(await res.json()).toEqual(
+            expect.objectContaining({
+                "status": "success",
+                "data": expect.any(Array),
+                "meta": expect.objectContaining({
+                    "total": expect.any(Number)
+                })
+        }))
+    })
+
+    test('should response bad request when cursor is invalid', async({
+        request
+    }) => {
+        const res = await request.get('/api/v1/skills/go/history?cursor=nope')
+        expect(res.status()).toBe(400)
+        expect(await res.json()).toEqual(
+            expect.objectContaining({
+                "code": "invalid_cursor"
+            })
+        )
+    })
+})
+
 test.describe('GET /api/v1/skills', () => {
     test('should response a skill with status success', async({
         request
@@ -56,11 +118,39 @@ test.describe('GET /api/v1/skills', () => {
                         "logo": expect.any(String),
                         "tags":expect.any(Array<String>)
                     })
-                ])
+                ]),
+                "meta": expect.objectContaining({
+                    "total": expect.any(Number)
+                })
         })) 
     })
 })
 
+test.describe('GET /api/v1/skills/search', () => {
+    test('should response skills matching the query', async({
+        request
+    }) => {
+        const res = await request.get('/api/v1/skills/search?q=system')
+        expect(res.ok()).toBeTruthy()
+        expect(await res.json()).toEqual(
+            expect.objectContaining({
+                "status": "success",
+                "data": expect.arrayContaining([
+                    expect.objectContaining({
+                        "key": "go"
+                    })
+                ])
+        }))
+    })
+
+    test('should response bad request when query is empty', async({
+        request
+    }) => {
+        const res = await request.get('/api/v1/skills/search?q=')
+        expect(res.status()).toBe(400)
+    })
+})
+
 test.describe('POST /api/v1/skills', () => {
     test('should response a skill with status created ', async({
         request
@@ -79,17 +169,43 @@ test.describe('POST /api/v1/skills', () => {
         expect(await res.json()).toEqual(
         expect.objectContaining({
             "status": "success",
-            "data": {
-                "key":"python",
-                "name": "Python",
-                "description": expect.any(String),
-                "logo": expect.any(String),
-                "tags":expect.any(Array<String>)
-            }
+            "data": expect.objectContaining({
+                "id": expect.any(String),
+                "action": "create",
+                "key": "python",
+                "status": "pending"
+            })
         })
         )
     })
 
+    test('should response the persisted skill when waiting for the consumer', async({
+        request
+    }) => {
+        const res = await request.post('/api/v1/skills', 
+            {
+                headers: { "Prefer": "wait=10" },
+                data:{
+                    key: "rust",
+                    name: "Rust",
+                    description: "Rust is a systems programming language.",
+                    logo: "https://www.rust-lang.org/logos/rust-logo-512x512.png",
+                    tags: ["programming language"]
+                }
+            })
+        expect(res.status()).toBe(201)
+        expect(res.headers()['preference-applied']).toBe('wait=10')
+        expect(await res.json()).toEqual(
+        expect.objectContaining({
+            "status": "success",
+            "data": expect.objectContaining({
+                "key": "rust",
+                "name": "Rust",
+                "version": 1
+            })
+        }))
+    })
+
     test('should response a skill with status bad request when key is already exist', async({
         request
     }) => {
@@ -107,17 +223,99 @@ test.describe('POST /api/v1/skills', () => {
         expect(await res.json()).toEqual(
         expect.objectContaining({
             "status": "success",
-            "data": {
-                "key":"go",
-                "name": "Python",
-                "description": expect.any(String),
-                "logo": expect.any(String),
-                "tags":expect.any(Array<String>)
-            }
+            "data": expect.objectContaining({
+                "id": expect.any(String),
+                "action": "create",
+                "key": "go",
+                "status": "pending"
+            })
+        }))
+    })
+
+    test('should response field errors with status unprocessable entity when payload is invalid', async({
+        request
+    }) => {
+        const res = await request.post('/api/v1/skills',
+            {
+                data:{
+                    key: "Not A Slug",
+                    name: "  ",
+                    logo: "logo.png",
+                    tags: []
+                }
+            })
+        expect(res.status()).toBe(422)
+        expect(await res.json()).toEqual(
+        expect.objectContaining({
+            "status": 422,
+            "code": "validation_failed",
+            "errors": expect.arrayContaining([
+                expect.objectContaining({"field": "key"}),
+                expect.objectContaining({"field": "name"}),
+                expect.objectContaining({"field": "logo"})
+            ])
         }))
     })
 })
 
+test.describe('POST /api/v1/skills:import', () => {
+    test('should report every row of a json lines import', async({
+        request
+    }) => {
+        const res = await request.post('/api/v1/skills:import', {
+            headers: { "Content-Type": "application/x-ndjson" },
+            data: '{"key":"swift","name":"Swift"}\n{"key":"Not A Slug","name":"bad"}\n'
+        })
+        expect(res.ok()).toBeTruthy()
+        expect(await res.json()).toEqual(
+            expect.objectContaining({
+                "data": [
+                    expect.objectContaining({ "row": 1, "key": "swift", "status": "accepted" }),
+                    expect.objectContaining({ "row": 2, "status": "rejected" })
+                ],
+                "meta": { "total": 2, "accepted": 1, "rejected": 1, "failed": 0 }
+            })
+        )
+    })
+})
+
+test.describe('POST /api/v1/skills:batch', () => {
+    test('should abort an atomic batch when one operation is rejected', async({
+        request
+    }) => {
+        const res = await request.post('/api/v1/skills:batch', {
+            data: {
+                atomic: true,
+                operations: [
+                    { op: "create", key: "elixir", name: "Elixir" },
+                    { op: "update_name", key: "kotlin", name: "Kotlin" }
+                ]
+            }
+        })
+        expect(res.ok()).toBeTruthy()
+        expect(await res.json()).toEqual(
+            expect.objectContaining({
+                "data": [
+                    expect.objectContaining({ "index": 0, "status": "aborted" }),
+                    expect.objectContaining({ "index": 1, "status": "rejected" })
+                ],
+                "meta": expect.objectContaining({ "atomic": true, "committed": false })
+            })
+        )
+    })
+})
+
+test.describe('GET /api/v1/skills:export', () => {
+    test('should stream skills as csv', async({
+        request
+    }) => {
+        const res = await request.get('/api/v1/skills:export?format=csv')
+        expect(res.ok()).toBeTruthy()
+        expect(res.headers()['content-type']).toContain('text/csv')
+        expect((await res.text()).split('\n')[0]).toBe('key,name,description,logo,tags')
+    })
+})
+
 test.describe('PUT /api/v1/skills/:key', () => {
     test('should response a skill with status created', async({
         request
@@ -125,6 +323,7 @@ test.describe('PUT /api/v1/skills/:key', () => {
         const res = await request.put(`/api/v1/skills/go`,
             {
                 data: {
+                    key: "go",
                     name: "go2",
                     description: "go2 is the latest version of Python programming language.",
                     logo: "https://upload.wikimedia.org/wikipedia/commons/c/c3/Python-logo-notext.svg",
@@ -137,13 +336,12 @@ test.describe('PUT /api/v1/skills/:key', () => {
         expect(await res.json()).toEqual(
             expect.objectContaining({
                 "status": "success",
-                "data": {
-                    "key":"go",
-                    "name": "go2",
-                    "description": "go2 is the latest version of Python programming language.",
-                    "logo": "https://upload.wikimedia.org/wikipedia/commons/c/c3/Python-logo-notext.svg",
-                    "tags": ["data"]
-                }
+                "data": expect.objectContaining({
+                    "id": expect.any(String),
+                    "action": "update",
+                    "key": "go",
+                    "status": "pending"
+                })
             })
         )
     })
@@ -164,8 +362,8 @@ test.describe('PUT /api/v1/skills/:key', () => {
         expect(res.ok()).not.toBeTruthy()
         expect(await res.json()).toEqual(
             expect.objectContaining({
-                "status": "error",
-                "message": expect.any(String),
+                "code": expect.any(String),
+                "detail": expect.any(String),
             })
         )
     })
@@ -183,13 +381,12 @@ test.describe('PATCH /api/v1/skills/:key/actions/name',() => {
         expect(await res.json()).toEqual(
             expect.objectContaining({
                 "status": "success",
-                "data": {
-                    "key":"go",
-                    "name": "golang patch",
-                    "description": expect.any(String),
-                    "logo": expect.any(String),
-                    "tags": expect.any(Array<String>)
-                }
+                "data": expect.objectContaining({
+                    "id": expect.any(String),
+                    "action": "update_name",
+                    "key": "go",
+                    "status": "pending"
+                })
             })
         )
     })
@@ -207,8 +404,8 @@ test.describe('PATCH /api/v1/skills/:key/actions/name',() => {
         expect(res).not.toBeOK()
         expect(await res.json()).toEqual(
             expect.objectContaining({
-                "status": "error",
-                "message": expect.any(String),
+                "code": expect.any(String),
+                "detail": expect.any(String),
             })
         )
     })
@@ -226,13 +423,12 @@ test.describe('PATCH /api/v1/skills/:key/actions/description',() => {
         expect(await res.json()).toEqual(
             expect.objectContaining({
                 "status": "success",
-                "data": {
-                    "key":"go",
-                    "name": expect.any(String),
-                    "description": "golang description",
-                    "logo": expect.any(String),
-                    "tags": expect.any(Array<String>)
-                }
+                "data": expect.objectContaining({
+                    "id": expect.any(String),
+                    "action": "update_desc",
+                    "key": "go",
+                    "status": "pending"
+                })
             })
         )
     })
@@ -250,8 +446,8 @@ test.describe('PATCH /api/v1/skills/:key/actions/description',() => {
         expect(res).not.toBeOK()
         expect(await res.json()).toEqual(
             expect.objectContaining({
-                "status": "error",
-                "message": expect.any(String),
+                "code": expect.any(String),
+                "detail": expect.any(String),
             })
         ) 
     })
@@ -262,20 +458,19 @@ test.describe('PATCH /api/v1/skills/:key/actions/logo',() => {
         const res = await request.patch('/api/v1/skills/go/actions/logo',
             {
                 data: {
-                    logo:"newlogoPath"
+                    logo:"https://example.com/new-logo.svg"
                 }
             })
         expect(res.ok()).toBeTruthy()
         expect(await res.json()).toEqual(
             expect.objectContaining({
                 "status": "success",
-                "data": {
-                    "key":"go",
-                    "name": expect.any(String),
-                    "description": expect.any(String),
-                    "logo": "newlogoPath",
-                    "tags": expect.any(Array<String>)
-                }
+                "data": expect.objectContaining({
+                    "id": expect.any(String),
+                    "action": "update_logo",
+                    "key": "go",
+                    "status": "pending"
+                })
             })
         )
     })
@@ -284,14 +479,14 @@ test.describe('PATCH /api/v1/skills/:key/actions/logo',() => {
         const res = await request.patch('/api/v1/skills/kotlin/actions/logo',
             {
                 data: {
-                    logo:"newLogoPath"
+                    logo:"https://example.com/new-logo.svg"
                 }
             })
         expect(res).not.toBeOK()
         expect(await res.json()).toEqual(
             expect.objectContaining({
-                "status": "error",
-                "message": expect.any(String),
+                "code": expect.any(String),
+                "detail": expect.any(String),
             })
         ) 
     })
@@ -309,13 +504,12 @@ test.describe('PATCH /api/v1/skills/:key/actions/tags',() => {
         expect(await res.json()).toEqual(
             expect.objectContaining({
                 "status": "success",
-                "data": {
-                    "key":"go",
-                    "name": expect.any(String),
-                    "description": expect.any(String),
-                    "logo": expect.any(String),
-                    "tags": ["test tags"]
-                }
+                "data": expect.objectContaining({
+                    "id": expect.any(String),
+                    "action": "update_tags",
+                    "key": "go",
+                    "status": "pending"
+                })
             })
         )
     })
@@ -330,8 +524,8 @@ test.describe('PATCH /api/v1/skills/:key/actions/tags',() => {
         expect(res).not.toBeOK()
         expect(await res.json()).toEqual(
             expect.objectContaining({
-                "status": "error",
-                "message": expect.any(String),
+                "code": expect.any(String),
+                "detail": expect.any(String),
             })
         )
     })
@@ -340,11 +534,17 @@ test.describe('PATCH /api/v1/skills/:key/actions/tags',() => {
 test.describe('DELETE /api/v1/skills/:key',() => {
     test('should response message delete completed with status ok', async({request}) => {
         const res = await request.delete('/api/v1/skills/go')
-        expect(res.ok()).toBeTruthy()
+        expect(res.status()).toBe(202)
+        expect(res.headers()['location']).toMatch(/^\/api\/v1\/commands\//)
         expect(await res.json()).toEqual(
             expect.objectContaining({
                 "status": "success",
-                "message": "Skill deleted"
+                "data": expect.objectContaining({
+                    "id": expect.any(String),
+                    "action": "delete",
+                    "key": "go",
+                    "status": "pending"
+                })
             })
         )
     })
@@ -355,8 +555,8 @@ test.describe('DELETE /api/v1/skills/:key',() => {
         expect(res).not.toBeOK()
         expect(await res.json()).toEqual(
             expect.objectContaining({
-                "status": "error",
-                "message": expect.any(String),
+                "code": expect.any(String),
+                "detail": expect.any(String),
             })
         )
     })
@@ -1,7 +0,0 @@
-CREATE TABLE IF NOT EXISTS skill (
-	key TEXT PRIMARY KEY,
-	name TEXT NOT NULL DEFAULT '',
-	description TEXT NOT NULL DEFAULT '',
-	logo TEXT NOT NULL DEFAULT '',
-    tags TEXT [] NOT NULL DEFAULT '{}'
-);
\ No newline at end of file
@@ -0,0 +1,213 @@
+// Package configload reads a typed configuration from, in increasing
+// priority, its defaults, a YAML file, the environment and the command line
+// flags. Each service declares the settings of its own Config and validates
+// it; this package only does the reading.
+package configload
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Setting is one value of a config C, read from the env variable Env or the
+// flag Flag. Key is its path in the YAML file. A bool flag is given without a
+// value to set it to true.
+type Setting[C any] struct {
+	Key    string
+	Env    string
+	Flag   string
+	Usage  string
+	Set    func(cfg *C, value string) error
+	IsBool bool
+}
+
+// flagValue holds a flag as it was given, to be set once the file and the
+// environment are read.
+type flagValue struct {
+	value  string
+	isBool bool
+}
+
+func (v *flagValue) String() string     { return v.value }
+func (v *flagValue) Set(s string) error { v.value = s; return nil }
+func (v *flagValue) IsBoolFlag() bool   { return v.isBool }
+
+// Load reads the YAML file named by -config or CONFIG_FILE, if any, over
+// cfg, then the environment, then args, and checks the result with
+// validate. Empty env variables count as unset. A value reported missing by
+// validate is told where it can be set.
+func Load[C any](cfg *C, args []string, settings []Setting[C], validate func(cfg *C) error) error {
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	file := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML configuration file (env CONFIG_FILE)")
+	for _, s := range settings {
+		flags.Var(&flagValue{isBool: s.IsBool}, s.Flag, s.Usage+" (env "+s.Env+")")
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *file != "" {
+		if err := readFile(*file, cfg); err != nil {
+			return err
+		}
+	}
+
+	problems := []error{}
+	for _, s := range settings {
+		if value := os.Getenv(s.Env); value != "" {
+			if err := s.Set(cfg, value); err != nil {
+				problems = append(problems, fmt.Errorf("%s: %w", s.Env, err))
+			}
+		}
+	}
+	flags.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.Flag != f.Name {
+				continue
+			}
+			if err := s.Set(cfg, f.Value.String()); err != nil {
+				problems = append(problems, fmt.Errorf("-%s: %w", s.Flag, err))
+			}
+		}
+	})
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(problems...))
+	}
+
+	if err := validate(cfg); err != nil {
+		hint(err, settings)
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	return nil
+}
+
+// readFile decodes the YAML file over cfg. Unknown keys are an error so a
+// typo doesn't silently leave the default in place.
+func readFile(path string, cfg any) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Problem is a value of the config that is missing or out of range.
+type Problem struct {
+	Key     string
+	Message string
+	missing bool
+	where   string
+}
+
+func (p *Problem) Error() string {
+	if p.where != "" {
+		return p.Key + " " + p.Message + ", " + p.where
+	}
+	return p.Key + " " + p.Message
+}
+
+// Required reports that the value at key is missing.
+func Required(key string) error {
+	return &Problem{Key: key, Message: "is required", missing: true}
+}
+
+// Invalid reports that the value at key is wrong, e.g. Invalid("http.port",
+// "must be a port between 1 and 65535").
+func Invalid(key string, message string) error {
+	return &Problem{Key: key, Message: message}
+}
+
+// hint tells every missing value in err, joined or wrapped, where to set it.
+func hint[C any](err error, settings []Setting[C]) {
+	var problem *Problem
+	switch e := err.(type) {
+	case interface{ Unwrap() []error }:
+		for _, err := range e.Unwrap() {
+			hint(err, settings)
+		}
+		return
+	case interface{ Unwrap() error }:
+		hint(e.Unwrap(), settings)
+		return
+	}
+	if !errors.As(err, &problem) || !problem.missing {
+		return
+	}
+	for _, s := range settings {
+		if s.Key == problem.Key {
+			problem.where = fmt.Sprintf("set %s, -%s or %s in the config file", s.Env, s.Flag, s.Key)
+		}
+	}
+}
+
+// String sets a string field.
+func String[C any](field func(*C) *string) func(*C, string) error {
+	return func(cfg *C, value string) error {
+		*field(cfg) = value
+		return nil
+	}
+}
+
+// List sets a field from a comma separated value.
+func List[C any](field func(*C) *[]string) func(*C, string) error {
+	return func(cfg *C, value string) error {
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*field(cfg) = items
+		return nil
+	}
+}
+
+// Int sets a whole number field.
+func Int[C any](field func(*C) *int) func(*C, string) error {
+	return func(cfg *C, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		*field(cfg) = n
+		return nil
+	}
+}
+
+// Duration sets a field from a value such as 500ms or 2s.
+func Duration[C any](field func(*C) *time.Duration) func(*C, string) error {
+	return func(cfg *C, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 500ms", value)
+		}
+		*field(cfg) = d
+		return nil
+	}
+}
+
+// Bool sets a field from true, false or any value strconv.ParseBool takes.
+func Bool[C any](field func(*C) *bool) func(*C, string) error {
+	return func(cfg *C, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		*field(cfg) = b
+		return nil
+	}
+}
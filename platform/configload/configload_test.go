@@ -0,0 +1,109 @@
+package configload
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testConfig struct {
+	Name    string        `yaml:"name"`
+	Hosts   []string      `yaml:"hosts"`
+	Workers int           `yaml:"workers"`
+	Timeout time.Duration `yaml:"timeout"`
+	Debug   bool          `yaml:"debug"`
+}
+
+var testSettings = []Setting[testConfig]{
+	{Key: "name", Env: "TEST_NAME", Flag: "name", Usage: "name", Set: String(func(c *testConfig) *string { return &c.Name })},
+	{Key: "hosts", Env: "TEST_HOSTS", Flag: "hosts", Usage: "comma separated hosts", Set: List(func(c *testConfig) *[]string { return &c.Hosts })},
+	{Key: "workers", Env: "TEST_WORKERS", Flag: "workers", Usage: "workers", Set: Int(func(c *testConfig) *int { return &c.Workers })},
+	{Key: "timeout", Env: "TEST_TIMEOUT", Flag: "timeout", Usage: "timeout", Set: Duration(func(c *testConfig) *time.Duration { return &c.Timeout })},
+	{Key: "debug", Env: "TEST_DEBUG", Flag: "debug", Usage: "debug", Set: Bool(func(c *testConfig) *bool { return &c.Debug }), IsBool: true},
+}
+
+func validate(cfg *testConfig) error {
+	problems := []error{}
+	if cfg.Name == "" {
+		problems = append(problems, Required("name"))
+	}
+	if cfg.Workers < 1 {
+		problems = append(problems, Invalid("workers", "must be at least 1"))
+	}
+	return errors.Join(problems...)
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("should read the file, then the environment, then the flags", func(t *testing.T) {
+		//arange
+		path := filepath.Join(t.TempDir(), "test.yaml")
+		os.WriteFile(path, []byte("name: file\nworkers: 2\ntimeout: 2s\nhosts: [a]\n"), 0o600)
+		t.Setenv("TEST_WORKERS", "4")
+		t.Setenv("TEST_HOSTS", " b , c,")
+		t.Setenv("TEST_NAME", "")
+		cfg := testConfig{Workers: 1, Timeout: time.Second}
+
+		//act
+		err := Load(&cfg, []string{"-config", path, "-workers", "8", "-debug"}, testSettings, validate)
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, testConfig{Name: "file", Hosts: []string{"b", "c"}, Workers: 8, Timeout: 2 * time.Second, Debug: true}, cfg)
+	})
+	t.Run("should read the file named by CONFIG_FILE", func(t *testing.T) {
+		//arange
+		path := filepath.Join(t.TempDir(), "test.yaml")
+		os.WriteFile(path, []byte("name: env-file\n"), 0o600)
+		t.Setenv("CONFIG_FILE", path)
+		cfg := testConfig{Workers: 1}
+
+		//act
+		err := Load(&cfg, nil, testSettings, validate)
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, "env-file", cfg.Name)
+	})
+	t.Run("should report every value that can't be parsed", func(t *testing.T) {
+		//arange
+		t.Setenv("TEST_TIMEOUT", "soon")
+		t.Setenv("TEST_DEBUG", "maybe")
+		cfg := testConfig{Name: "test", Workers: 1}
+
+		//act
+		err := Load(&cfg, []string{"-workers", "many"}, testSettings, validate)
+
+		//assert
+		assert.ErrorContains(t, err, `TEST_TIMEOUT: "soon" is not a duration such as 500ms`)
+		assert.ErrorContains(t, err, `TEST_DEBUG: "maybe" is not true or false`)
+		assert.ErrorContains(t, err, `-workers: "many" is not a whole number`)
+	})
+	t.Run("should tell where a missing value can be set", func(t *testing.T) {
+		//arange
+		cfg := testConfig{}
+
+		//act
+		err := Load(&cfg, nil, testSettings, validate)
+
+		//assert
+		assert.ErrorContains(t, err, "invalid configuration: name is required, set TEST_NAME, -name or name in the config file")
+		assert.ErrorContains(t, err, "workers must be at least 1")
+		assert.NotContains(t, err.Error(), "workers must be at least 1, set")
+	})
+	t.Run("should reject unknown keys in the file", func(t *testing.T) {
+		//arange
+		path := filepath.Join(t.TempDir(), "test.yaml")
+		os.WriteFile(path, []byte("names: typo\n"), 0o600)
+		cfg := testConfig{}
+
+		//act
+		err := Load(&cfg, []string{"-config", path}, testSettings, validate)
+
+		//assert
+		assert.ErrorContains(t, err, "field names not found")
+	})
+}
@@ -0,0 +1,27 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Liveness answers as long as the process serves requests.
+func Liveness(w http.ResponseWriter, r *http.Request) {
+	write(w, http.StatusOK, Report{Status: StatusOK})
+}
+
+// Readiness answers 503 when a check fails or the service is shutting down.
+func (c *Checker) Readiness(w http.ResponseWriter, r *http.Request) {
+	report, ready := c.Ready(r.Context())
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	write(w, status, report)
+}
+
+func write(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,131 @@
+// Package health answers the liveness and readiness probes. A service is
+// live as long as it serves HTTP; it is ready when every dependency it needs
+// to take work answers, and stops being ready as soon as it shuts down.
+package health
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// ErrShuttingDown is reported by the readiness probe once Drain was called.
+var ErrShuttingDown = errors.New("shutting down")
+
+// Check reports whether a dependency answers before ctx is done.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs the readiness checks, each one bounded by timeout.
+type Checker struct {
+	timeout  time.Duration
+	checks   []namedCheck
+	details  map[string]func() any
+	draining atomic.Bool
+}
+
+// Report is the body of both probes. Checks holds ok or unavailable for
+// every readiness check, and Details what the service is working on. The
+// probes are often public, so the errors behind a failed check are only
+// logged.
+type Report struct {
+	Status  string            `json:"status"`
+	Checks  map[string]string `json:"checks,omitempty"`
+	Details map[string]any    `json:"details,omitempty"`
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout, details: map[string]func() any{}}
+}
+
+// Add registers a readiness check under name.
+func (c *Checker) Add(name string, check Check) *Checker {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+	return c
+}
+
+// Detail adds what detail returns to every readiness report under name.
+func (c *Checker) Detail(name string, detail func() any) *Checker {
+	c.details[name] = detail
+	return c
+}
+
+// Drain makes the service unready for good, so it is taken out of rotation
+// while it finishes the requests it has.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Ready runs every check at once and reports whether they all passed.
+func (c *Checker) Ready(ctx context.Context) (Report, bool) {
+	report := Report{Status: StatusOK, Checks: map[string]string{}, Details: map[string]any{}}
+	for name, detail := range c.details {
+		report.Details[name] = detail()
+	}
+	if c.draining.Load() {
+		report.Status = StatusUnavailable
+		report.Checks["shutdown"] = ErrShuttingDown.Error()
+		return report, false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	errs := make([]error, len(c.checks))
+	wg := sync.WaitGroup{}
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = check.check(ctx)
+		}()
+	}
+	wg.Wait()
+
+	ready := true
+	for i, check := range c.checks {
+		report.Checks[check.name] = StatusOK
+		if errs[i] != nil {
+			ready = false
+			report.Status = StatusUnavailable
+			report.Checks[check.name] = StatusUnavailable
+			log.Printf("readiness check %s failed: %s\n", check.name, errs[i])
+		}
+	}
+	return report, ready
+}
+
+// Database checks that db accepts connections.
+func Database(db *sql.DB) Check {
+	return db.PingContext
+}
+
+// Kafka checks that the brokers answer a metadata request for topic.
+func Kafka(client sarama.Client, topic string) Check {
+	return func(ctx context.Context) error {
+		done := make(chan error, 1)
+		go func() {
+			done <- client.RefreshMetadata(topic)
+		}()
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func serve(handler http.HandlerFunc) (int, map[string]any) {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	report := map[string]any{}
+	json.Unmarshal(w.Body.Bytes(), &report)
+	return w.Code, report
+}
+
+func TestReadiness(t *testing.T) {
+	t.Run("should be ready with the details of the service", func(t *testing.T) {
+		//arrange
+		db, _ := sql.Open("sqlite", "file:health?mode=memory&cache=shared")
+		defer db.Close()
+		checker := NewChecker(time.Second).
+			Add("database", Database(db)).
+			Add("group", func(ctx context.Context) error { return nil }).
+			Detail("partitions", func() any { return map[string][]int32{"skills": {0, 1}} })
+
+		//act
+		code, report := serve(checker.Readiness)
+
+		//assert
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, map[string]any{
+			"status":  "ok",
+			"checks":  map[string]any{"database": "ok", "group": "ok"},
+			"details": map[string]any{"partitions": map[string]any{"skills": []any{0.0, 1.0}}},
+		}, report)
+	})
+	t.Run("should log the checks that failed or timed out and answer only unavailable", func(t *testing.T) {
+		//arrange
+		logs := &bytes.Buffer{}
+		log.SetOutput(logs)
+		defer log.SetOutput(os.Stderr)
+		db, _ := sql.Open("sqlite", "file:health?mode=memory&cache=shared")
+		db.Close()
+		checker := NewChecker(10*time.Millisecond).
+			Add("database", Database(db)).
+			Add("kafka", func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			})
+
+		//act
+		code, report := serve(checker.Readiness)
+
+		//assert
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, map[string]any{
+			"status": "unavailable",
+			"checks": map[string]any{"database": "unavailable", "kafka": "unavailable"},
+		}, report)
+		assert.Contains(t, logs.String(), "readiness check database failed: sql: database is closed")
+		assert.Contains(t, logs.String(), "readiness check kafka failed: "+context.DeadlineExceeded.Error())
+	})
+	t.Run("should stop being ready once draining but stay live", func(t *testing.T) {
+		//arrange
+		called := false
+		checker := NewChecker(time.Second).Add("kafka", func(ctx context.Context) error {
+			called = true
+			return errors.New("unreachable")
+		})
+		checker.Drain()
+
+		//act
+		readyCode, report := serve(checker.Readiness)
+		liveCode, live := serve(Liveness)
+
+		//assert
+		assert.Equal(t, http.StatusServiceUnavailable, readyCode)
+		assert.Equal(t, map[string]any{"status": "unavailable", "checks": map[string]any{"shutdown": "shutting down"}}, report)
+		assert.False(t, called)
+		assert.Equal(t, http.StatusOK, liveCode)
+		assert.Equal(t, map[string]any{"status": "ok"}, live)
+	})
+}
+
+func TestKafka(t *testing.T) {
+	//arrange
+	broker := sarama.NewMockBroker(t, 1)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("skills", 0, broker.BrokerID()),
+	})
+	config := sarama.NewConfig()
+	config.Metadata.Retry.Max = 0
+	client, err := sarama.NewClient([]string{broker.Addr()}, config)
+	assert.NoError(t, err)
+	defer client.Close()
+
+	//act
+	found := Kafka(client, "skills")(context.Background())
+	broker.Close()
+	gone := Kafka(client, "skills")(context.Background())
+
+	//assert
+	assert.NoError(t, found)
+	assert.Error(t, gone)
+}
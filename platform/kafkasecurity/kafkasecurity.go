@@ -0,0 +1,144 @@
+// Package kafkasecurity turns the TLS and SASL settings of a service into a
+// sarama config. Each service reads the settings under kafka.tls and
+// kafka.sasl, with its own env variables and flags, and hands them here.
+package kafkasecurity
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"platform/configload"
+
+	"github.com/IBM/sarama"
+	"github.com/xdg-go/scram"
+)
+
+type TLSConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// CAFile verifies the brokers instead of the system roots.
+	CAFile string `yaml:"ca_file"`
+	// CertFile and KeyFile are the client certificate, for brokers that
+	// authenticate clients with TLS.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// InsecureSkipVerify accepts any broker certificate. It is for dev only.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+}
+
+type SASLConfig struct {
+	// Mechanism is PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512. SASL is off when it
+	// is empty.
+	Mechanism string `yaml:"mechanism"`
+	User      string `yaml:"user"`
+	Password  string `yaml:"password"`
+}
+
+// Validate reports TLS and SASL settings that can't work together. The files
+// themselves are read by Apply.
+func Validate(t TLSConfig, s SASLConfig) []error {
+	problems := []error{}
+	if !t.Enabled && (t.CAFile != "" || t.CertFile != "" || t.KeyFile != "" || t.InsecureSkipVerify) {
+		problems = append(problems, configload.Invalid("kafka.tls", "settings are given but kafka.tls.enabled is false"))
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		problems = append(problems, configload.Invalid("kafka.tls", "needs both cert_file and key_file for a client certificate"))
+	}
+
+	switch s.Mechanism {
+	case "":
+		if s.User != "" || s.Password != "" {
+			problems = append(problems, configload.Required("kafka.sasl.mechanism"))
+		}
+		return problems
+	case sarama.SASLTypePlaintext, sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512:
+	default:
+		problems = append(problems, configload.Invalid("kafka.sasl.mechanism", "must be PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512"))
+	}
+	if s.User == "" {
+		problems = append(problems, configload.Required("kafka.sasl.user"))
+	}
+	if s.Password == "" {
+		problems = append(problems, configload.Required("kafka.sasl.password"))
+	}
+	return problems
+}
+
+// Apply turns on the TLS and SASL settings in config.
+func Apply(config *sarama.Config, t TLSConfig, s SASLConfig) error {
+	if t.Enabled {
+		tlsConfig, err := tlsConfig(t)
+		if err != nil {
+			return err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+
+	if s.Mechanism == "" {
+		return nil
+	}
+	config.Net.SASL.Enable = true
+	config.Net.SASL.Handshake = true
+	config.Net.SASL.Mechanism = sarama.SASLMechanism(s.Mechanism)
+	config.Net.SASL.User = s.User
+	config.Net.SASL.Password = s.Password
+	switch s.Mechanism {
+	case sarama.SASLTypeSCRAMSHA256:
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hash: sha256.New} }
+	case sarama.SASLTypeSCRAMSHA512:
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hash: sha512.New} }
+	}
+	return nil
+}
+
+func tlsConfig(cfg TLSConfig) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		ca, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("kafka.tls.ca_file: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, errors.New("kafka.tls.ca_file: no PEM certificate found")
+		}
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("kafka.tls client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// scramClient runs the client side of a SCRAM exchange for sarama.
+type scramClient struct {
+	hash         scram.HashGeneratorFcn
+	conversation *scram.ClientConversation
+}
+
+func (c *scramClient) Begin(user, password, authzID string) error {
+	client, err := c.hash.NewClient(user, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.conversation = client.NewConversation()
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conversation.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.conversation.Done()
+}
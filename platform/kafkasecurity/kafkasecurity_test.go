@@ -0,0 +1,169 @@
+package kafkasecurity
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCert writes a self-signed certificate and its key as PEM files.
+func writeCert(t *testing.T) (certFile string, keyFile string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kafka"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+func TestApply(t *testing.T) {
+	t.Run("should stay plaintext without TLS or SASL", func(t *testing.T) {
+		//arange
+		config := sarama.NewConfig()
+
+		//act
+		err := Apply(config, TLSConfig{}, SASLConfig{})
+
+		//assert
+		assert.NoError(t, err)
+		assert.False(t, config.Net.TLS.Enable)
+		assert.False(t, config.Net.SASL.Enable)
+		assert.NoError(t, config.Validate())
+	})
+	t.Run("should verify the brokers with the CA and present the client certificate", func(t *testing.T) {
+		//arange
+		certFile, keyFile := writeCert(t)
+		config := sarama.NewConfig()
+
+		//act
+		err := Apply(config, TLSConfig{Enabled: true, CAFile: certFile, CertFile: certFile, KeyFile: keyFile}, SASLConfig{})
+
+		//assert
+		assert.NoError(t, err)
+		assert.True(t, config.Net.TLS.Enable)
+		assert.NotNil(t, config.Net.TLS.Config.RootCAs)
+		assert.Len(t, config.Net.TLS.Config.Certificates, 1)
+		assert.Equal(t, uint16(tls.VersionTLS12), config.Net.TLS.Config.MinVersion)
+		assert.False(t, config.Net.TLS.Config.InsecureSkipVerify)
+	})
+	t.Run("should authenticate with SCRAM-SHA-512", func(t *testing.T) {
+		//arange
+		config := sarama.NewConfig()
+
+		//act
+		err := Apply(config, TLSConfig{Enabled: true, InsecureSkipVerify: true}, SASLConfig{Mechanism: "SCRAM-SHA-512", User: "skill", Password: "secret"})
+
+		//assert
+		assert.NoError(t, err)
+		assert.True(t, config.Net.TLS.Config.InsecureSkipVerify)
+		assert.True(t, config.Net.SASL.Enable)
+		assert.Equal(t, sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA512), config.Net.SASL.Mechanism)
+		assert.Equal(t, "skill", config.Net.SASL.User)
+		assert.Equal(t, "secret", config.Net.SASL.Password)
+		client := config.Net.SASL.SCRAMClientGeneratorFunc()
+		assert.NoError(t, client.Begin("skill", "secret", ""))
+		first, err := client.Step("")
+		assert.NoError(t, err)
+		assert.Contains(t, first, "n=skill")
+		assert.NoError(t, config.Validate())
+	})
+	t.Run("should authenticate with SCRAM-SHA-256", func(t *testing.T) {
+		//arange
+		config := sarama.NewConfig()
+
+		//act
+		err := Apply(config, TLSConfig{}, SASLConfig{Mechanism: "SCRAM-SHA-256", User: "skill", Password: "secret"})
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA256), config.Net.SASL.Mechanism)
+		assert.NotNil(t, config.Net.SASL.SCRAMClientGeneratorFunc)
+		assert.NoError(t, config.Validate())
+	})
+	t.Run("should authenticate with PLAIN without a SCRAM client", func(t *testing.T) {
+		//arange
+		config := sarama.NewConfig()
+
+		//act
+		err := Apply(config, TLSConfig{}, SASLConfig{Mechanism: "PLAIN", User: "skill", Password: "secret"})
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, sarama.SASLMechanism(sarama.SASLTypePlaintext), config.Net.SASL.Mechanism)
+		assert.Nil(t, config.Net.SASL.SCRAMClientGeneratorFunc)
+		assert.NoError(t, config.Validate())
+	})
+	t.Run("should fail when the CA file holds no certificate", func(t *testing.T) {
+		//arange
+		_, keyFile := writeCert(t)
+
+		//act
+		err := Apply(sarama.NewConfig(), TLSConfig{Enabled: true, CAFile: keyFile}, SASLConfig{})
+
+		//assert
+		assert.EqualError(t, err, "kafka.tls.ca_file: no PEM certificate found")
+	})
+	t.Run("should fail when the client key can't be read", func(t *testing.T) {
+		//arange
+		certFile, _ := writeCert(t)
+
+		//act
+		err := Apply(sarama.NewConfig(), TLSConfig{Enabled: true, CertFile: certFile, KeyFile: filepath.Join(t.TempDir(), "missing.pem")}, SASLConfig{})
+
+		//assert
+		assert.ErrorContains(t, err, "kafka.tls client certificate")
+	})
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("should report incomplete TLS and SASL settings", func(t *testing.T) {
+		//act
+		err := errors.Join(Validate(TLSConfig{CertFile: "client.pem"}, SASLConfig{Mechanism: "SCRAM-SHA-512", User: "skill"})...)
+
+		//assert
+		assert.ErrorContains(t, err, "kafka.tls settings are given but kafka.tls.enabled is false")
+		assert.ErrorContains(t, err, "kafka.tls needs both cert_file and key_file")
+		assert.ErrorContains(t, err, "kafka.sasl.password is required")
+		assert.NotContains(t, err.Error(), "kafka.sasl.user")
+	})
+	t.Run("should reject an unknown mechanism and credentials without one", func(t *testing.T) {
+		//act
+		unknown := errors.Join(Validate(TLSConfig{}, SASLConfig{Mechanism: "GSSAPI", User: "skill", Password: "secret"})...)
+		missing := errors.Join(Validate(TLSConfig{}, SASLConfig{User: "skill"})...)
+
+		//assert
+		assert.EqualError(t, unknown, "kafka.sasl.mechanism must be PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512")
+		assert.EqualError(t, missing, "kafka.sasl.mechanism is required")
+	})
+	t.Run("should accept TLS with SCRAM", func(t *testing.T) {
+		//act
+		problems := Validate(TLSConfig{Enabled: true}, SASLConfig{Mechanism: "SCRAM-SHA-256", User: "skill", Password: "secret"})
+
+		//assert
+		assert.Empty(t, problems)
+	})
+}
@@ -0,0 +1,146 @@
+// Package relay publishes the rows of a transactional outbox in the order
+// they were written. The services keep their own outbox table and message;
+// the relay only needs to read, publish and mark them.
+package relay
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Message is an outbox row. Messages with the same OutboxKey, the events of
+// one skill, are published in order.
+type Message interface {
+	OutboxID() string
+	OutboxKey() string
+}
+
+// Store is the outbox table the relay reads.
+type Store[M Message] interface {
+	FetchPending(limit int) ([]M, error)
+	MarkSent(id string) error
+	MarkFailed(id string, message string) error
+}
+
+type Publisher[M Message] interface {
+	Publish(msg M) error
+}
+
+// BatchPublisher sends many messages in one round trip. It returns how many
+// messages from the start of msgs were delivered before the first failure.
+type BatchPublisher[M Message] interface {
+	PublishBatch(msgs []M) (int, error)
+}
+
+type Relay[M Message] struct {
+	repo       Store[M]
+	publisher  Publisher[M]
+	interval   time.Duration
+	maxBackoff time.Duration
+	batchSize  int
+}
+
+func NewRelay[M Message](repo Store[M], publisher Publisher[M], interval time.Duration, maxBackoff time.Duration, batchSize int) *Relay[M] {
+	return &Relay[M]{
+		repo:       repo,
+		publisher:  publisher,
+		interval:   interval,
+		maxBackoff: maxBackoff,
+		batchSize:  batchSize,
+	}
+}
+
+// Run polls the outbox until ctx is cancelled. After a failed round the wait
+// doubles up to maxBackoff, and it goes back to interval once a round succeeds.
+func (r *Relay[M]) Run(ctx context.Context) {
+	wait := r.interval
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("outbox relay stopped")
+			return
+		case <-time.After(wait):
+		}
+
+		sent, err := r.relay()
+		if err != nil {
+			wait = min(max(wait*2, r.interval), r.maxBackoff)
+			log.Printf("outbox relay failed, retrying in %s: %s\n", wait, err)
+			continue
+		}
+
+		wait = r.interval
+		if sent == r.batchSize {
+			// more rows are probably waiting, drain them without sleeping
+			wait = 0
+		}
+	}
+}
+
+// relay publishes one batch in insertion order. It stops at the first failure
+// so a later message for a skill never overtakes an earlier one.
+func (r *Relay[M]) relay() (int, error) {
+	msgs, err := r.repo.FetchPending(r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	if batch, ok := r.publisher.(BatchPublisher[M]); ok && len(msgs) > 0 {
+		return r.relayBatch(batch, msgs)
+	}
+
+	for i, msg := range msgs {
+		if err := r.publisher.Publish(msg); err != nil {
+			if markErr := r.repo.MarkFailed(msg.OutboxID(), err.Error()); markErr != nil {
+				log.Printf("can't record outbox failure %s: %s\n", msg.OutboxID(), markErr)
+			}
+			return i, err
+		}
+		if err := r.repo.MarkSent(msg.OutboxID()); err != nil {
+			return i, err
+		}
+	}
+
+	return len(msgs), nil
+}
+
+// relayBatch publishes msgs in rounds of one round trip each. A round holds
+// at most one message per skill, so when a message fails no later message of
+// its skill is in flight with it, and it can be published again without a
+// newer event of that skill being applied first. Only the delivered prefix of
+// a round is marked sent; the rest are published again, and the consumer
+// drops any of them it has already applied.
+func (r *Relay[M]) relayBatch(batch BatchPublisher[M], msgs []M) (int, error) {
+	sent := 0
+	for sent < len(msgs) {
+		round := distinctKeys(msgs[sent:])
+		delivered, err := batch.PublishBatch(round)
+		for _, msg := range round[:delivered] {
+			if err := r.repo.MarkSent(msg.OutboxID()); err != nil {
+				return sent, err
+			}
+			sent++
+		}
+		if err != nil {
+			if markErr := r.repo.MarkFailed(round[delivered].OutboxID(), err.Error()); markErr != nil {
+				log.Printf("can't record outbox failure %s: %s\n", round[delivered].OutboxID(), markErr)
+			}
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// distinctKeys is the longest prefix of msgs without two messages of the same
+// skill.
+func distinctKeys[M Message](msgs []M) []M {
+	seen := map[string]bool{}
+	for i, msg := range msgs {
+		if seen[msg.OutboxKey()] {
+			return msgs[:i]
+		}
+		seen[msg.OutboxKey()] = true
+	}
+	return msgs
+}
@@ -0,0 +1,244 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type message struct {
+	ID  string
+	Key string
+}
+
+func (m message) OutboxID() string  { return m.ID }
+func (m message) OutboxKey() string { return m.Key }
+
+type mockOutboxRepo struct {
+	mu      sync.Mutex
+	pending []message
+	sent    []string
+	failed  []string
+	err     error
+}
+
+func (m *mockOutboxRepo) FetchPending(limit int) ([]message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msgs := []message{}
+	for _, msg := range m.pending {
+		if !contains(m.sent, msg.ID) && len(msgs) < limit {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs, m.err
+}
+
+func (m *mockOutboxRepo) MarkSent(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, id)
+	return nil
+}
+
+func (m *mockOutboxRepo) sentCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sent)
+}
+
+func (m *mockOutboxRepo) MarkFailed(id string, message string) error {
+	m.failed = append(m.failed, id)
+	return nil
+}
+
+type mockPublisher struct {
+	published []string
+	failOn    string
+}
+
+func (m *mockPublisher) Publish(msg message) error {
+	if msg.ID == m.failOn {
+		return errors.New("broker down")
+	}
+	m.published = append(m.published, msg.ID)
+	return nil
+}
+
+type mockBatchPublisher struct {
+	mockPublisher
+	batches [][]string
+}
+
+func (m *mockBatchPublisher) PublishBatch(msgs []message) (int, error) {
+	ids := []string{}
+	for _, msg := range msgs {
+		ids = append(ids, msg.ID)
+	}
+	m.batches = append(m.batches, ids)
+	for i, msg := range msgs {
+		if msg.ID == m.failOn {
+			return i, errors.New("broker down")
+		}
+	}
+	return len(msgs), nil
+}
+
+func contains(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRelay(t *testing.T) {
+	t.Run("should publish pending messages and mark them sent", func(t *testing.T) {
+		//arange
+		repo := &mockOutboxRepo{pending: []message{{ID: "1"}, {ID: "2"}}}
+		publisher := &mockPublisher{}
+		relay := NewRelay[message](repo, publisher, time.Millisecond, time.Second, 10)
+
+		//act
+		sent, err := relay.relay()
+
+		//assert
+		if err != nil {
+			t.Errorf("expected error to be nil but got %v", err)
+		}
+		assert.Equal(t, 2, sent)
+		assert.Equal(t, []string{"1", "2"}, publisher.published)
+		assert.Equal(t, []string{"1", "2"}, repo.sent)
+	})
+	t.Run("should stop at first failure to keep order", func(t *testing.T) {
+		//arange
+		repo := &mockOutboxRepo{pending: []message{{ID: "1"}, {ID: "2"}, {ID: "3"}}}
+		publisher := &mockPublisher{failOn: "2"}
+		relay := NewRelay[message](repo, publisher, time.Millisecond, time.Second, 10)
+
+		//act
+		sent, err := relay.relay()
+
+		//assert
+		if err == nil {
+			t.Errorf("expected error but got %v", err)
+		}
+		assert.Equal(t, 1, sent)
+		assert.Equal(t, []string{"1"}, publisher.published)
+		assert.Equal(t, []string{"1"}, repo.sent)
+		assert.Equal(t, []string{"2"}, repo.failed)
+	})
+	t.Run("should return error when outbox can not be read", func(t *testing.T) {
+		//arange
+		repo := &mockOutboxRepo{err: errors.New("database is down")}
+		relay := NewRelay[message](repo, &mockPublisher{}, time.Millisecond, time.Second, 10)
+
+		//act
+		_, err := relay.relay()
+
+		//assert
+		if err == nil {
+			t.Errorf("expected error but got %v", err)
+		}
+	})
+}
+
+func TestRelayBatch(t *testing.T) {
+	t.Run("should publish pending messages in one round trip", func(t *testing.T) {
+		//arange
+		repo := &mockOutboxRepo{pending: []message{{ID: "1", Key: "go"}, {ID: "2", Key: "rust"}}}
+		publisher := &mockBatchPublisher{}
+		relay := NewRelay[message](repo, publisher, time.Millisecond, time.Second, 10)
+
+		//act
+		sent, err := relay.relay()
+
+		//assert
+		if err != nil {
+			t.Errorf("expected error to be nil but got %v", err)
+		}
+		assert.Equal(t, 2, sent)
+		assert.Equal(t, [][]string{{"1", "2"}}, publisher.batches)
+		assert.Empty(t, publisher.published)
+		assert.Equal(t, []string{"1", "2"}, repo.sent)
+	})
+	t.Run("should mark only the delivered prefix as sent", func(t *testing.T) {
+		//arange
+		repo := &mockOutboxRepo{pending: []message{{ID: "1", Key: "go"}, {ID: "2", Key: "rust"}, {ID: "3", Key: "java"}}}
+		publisher := &mockBatchPublisher{mockPublisher: mockPublisher{failOn: "2"}}
+		relay := NewRelay[message](repo, publisher, time.Millisecond, time.Second, 10)
+
+		//act
+		sent, err := relay.relay()
+
+		//assert
+		if err == nil {
+			t.Errorf("expected error but got %v", err)
+		}
+		assert.Equal(t, 1, sent)
+		assert.Equal(t, []string{"1"}, repo.sent)
+		assert.Equal(t, []string{"2"}, repo.failed)
+	})
+	t.Run("should send the later events of a skill in a later round trip", func(t *testing.T) {
+		//arange
+		repo := &mockOutboxRepo{pending: []message{{ID: "1", Key: "go"}, {ID: "2", Key: "rust"}, {ID: "3", Key: "go"}, {ID: "4", Key: "go"}}}
+		publisher := &mockBatchPublisher{}
+		relay := NewRelay[message](repo, publisher, time.Millisecond, time.Second, 10)
+
+		//act
+		sent, err := relay.relay()
+
+		//assert
+		assert.NoError(t, err)
+		assert.Equal(t, 4, sent)
+		assert.Equal(t, [][]string{{"1", "2"}, {"3"}, {"4"}}, publisher.batches)
+		assert.Equal(t, []string{"1", "2", "3", "4"}, repo.sent)
+	})
+	t.Run("should not let a later event of a skill overtake one that failed", func(t *testing.T) {
+		//arange
+		repo := &mockOutboxRepo{pending: []message{{ID: "1", Key: "go"}, {ID: "2", Key: "rust"}, {ID: "3", Key: "go"}}}
+		publisher := &mockBatchPublisher{mockPublisher: mockPublisher{failOn: "1"}}
+		relay := NewRelay[message](repo, publisher, time.Millisecond, time.Second, 10)
+
+		//act
+		_, failedErr := relay.relay()
+		publisher.failOn = ""
+		_, retryErr := relay.relay()
+
+		//assert
+		assert.Error(t, failedErr)
+		assert.NoError(t, retryErr)
+		assert.Equal(t, [][]string{{"1", "2"}, {"1", "2"}, {"3"}}, publisher.batches)
+		assert.Equal(t, []string{"1"}, repo.failed)
+		assert.Equal(t, []string{"1", "2", "3"}, repo.sent)
+	})
+}
+
+func TestRelayRun(t *testing.T) {
+	//arange
+	repo := &mockOutboxRepo{pending: []message{{ID: "1"}}}
+	publisher := &mockPublisher{}
+	relay := NewRelay[message](repo, publisher, time.Millisecond, time.Second, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	//act
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return repo.sentCount() == 1 }, time.Second, time.Millisecond)
+	cancel()
+
+	//assert
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("expected relay to stop after context is cancelled")
+	}
+}
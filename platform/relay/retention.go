@@ -0,0 +1,64 @@
+package relay
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// PurgeInterval is how often Retention deletes the rows past their period.
+var PurgeInterval = time.Hour
+
+// Purger deletes the rows a table no longer needs from before a time, the
+// outbox rows that were sent, and returns how many it deleted.
+type Purger interface {
+	Purge(before time.Time) (int64, error)
+}
+
+type retained struct {
+	name   string
+	purger Purger
+	period time.Duration
+}
+
+// Retention keeps the outbox tables, which only grow, to their retention
+// period. Only rows that are done with, such as sent messages, are purged.
+type Retention struct {
+	tables []retained
+}
+
+func NewRetention() *Retention {
+	return &Retention{}
+}
+
+// Add purges the rows of the table name older than period.
+func (r *Retention) Add(name string, purger Purger, period time.Duration) *Retention {
+	r.tables = append(r.tables, retained{name: name, purger: purger, period: period})
+	return r
+}
+
+// Run purges every table at once and then every PurgeInterval until ctx is
+// cancelled. A failed purge is logged and tried again on the next round.
+func (r *Retention) Run(ctx context.Context) {
+	for {
+		r.purge(time.Now().UTC())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(PurgeInterval):
+		}
+	}
+}
+
+func (r *Retention) purge(now time.Time) {
+	for _, table := range r.tables {
+		deleted, err := table.purger.Purge(now.Add(-table.period))
+		if err != nil {
+			log.Printf("can't purge %s: %s\n", table.name, err)
+			continue
+		}
+		if deleted > 0 {
+			log.Printf("purged %d rows of %s older than %s\n", deleted, table.name, table.period)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package relay
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockPurger struct {
+	before []time.Time
+	err    error
+}
+
+func (m *mockPurger) Purge(before time.Time) (int64, error) {
+	m.before = append(m.before, before)
+	return 1, m.err
+}
+
+func TestRetention(t *testing.T) {
+	t.Run("should purge each table from before its own period", func(t *testing.T) {
+		//arange
+		now := time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC)
+		outbox := &mockPurger{}
+		change := &mockPurger{}
+		retention := NewRetention().
+			Add("outbox", outbox, 24*time.Hour).
+			Add("change_outbox", change, time.Hour)
+
+		//act
+		retention.purge(now)
+
+		//assert
+		assert.Equal(t, []time.Time{now.Add(-24 * time.Hour)}, outbox.before)
+		assert.Equal(t, []time.Time{now.Add(-time.Hour)}, change.before)
+	})
+	t.Run("should go on with the other tables when one fails", func(t *testing.T) {
+		//arange
+		failing := &mockPurger{err: errors.New("database down")}
+		other := &mockPurger{}
+		retention := NewRetention().Add("outbox", failing, time.Hour).Add("change_outbox", other, time.Hour)
+
+		//act
+		retention.purge(time.Now())
+
+		//assert
+		assert.Len(t, failing.before, 1)
+		assert.Len(t, other.before, 1)
+	})
+}
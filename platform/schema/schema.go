@@ -0,0 +1,35 @@
+// Package schema holds the one database schema of the skill services. Both
+// the api and the consumer apply it when they start, so a database gets the
+// tables and columns of the running code whether it is new or not.
+package schema
+
+import (
+	"database/sql"
+	_ "embed"
+	"fmt"
+)
+
+//go:embed schema.sql
+var ddl string
+
+// lockID is the advisory lock the services hold while applying the schema,
+// so two of them starting together don't create the same table at once.
+const lockID = 7_316_512
+
+// Apply brings the database up to the schema. Every statement is idempotent,
+// so it is safe to apply on each start.
+func Apply(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin schema: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", lockID); err != nil {
+		return fmt.Errorf("lock schema: %w", err)
+	}
+	if _, err := tx.Exec(ddl); err != nil {
+		return fmt.Errorf("apply schema: %w", err)
+	}
+	return tx.Commit()
+}
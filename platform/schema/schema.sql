@@ -0,0 +1,131 @@
+CREATE TABLE IF NOT EXISTS skill (
+	key TEXT PRIMARY KEY,
+	name TEXT NOT NULL DEFAULT '',
+	description TEXT NOT NULL DEFAULT '',
+	logo TEXT NOT NULL DEFAULT '',
+	tags TEXT [] NOT NULL DEFAULT '{}',
+	version BIGINT NOT NULL DEFAULT 1
+);
+
+ALTER TABLE skill ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+
+CREATE INDEX IF NOT EXISTS skill_name_idx ON skill (name, key);
+CREATE INDEX IF NOT EXISTS skill_tags_idx ON skill USING GIN (tags);
+
+ALTER TABLE skill ADD COLUMN IF NOT EXISTS search TSVECTOR;
+
+-- The consumer is the only writer of skill, this trigger keeps the search
+-- vector in step with every insert and update it makes.
+CREATE OR REPLACE FUNCTION skill_search_update() RETURNS trigger AS $$
+BEGIN
+	NEW.search :=
+		setweight(to_tsvector('english', coalesce(NEW.name, '')), 'A') ||
+		setweight(to_tsvector('english', array_to_string(NEW.tags, ' ')), 'B') ||
+		setweight(to_tsvector('english', coalesce(NEW.description, '')), 'C');
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS skill_search_trigger ON skill;
+CREATE TRIGGER skill_search_trigger BEFORE INSERT OR UPDATE OF name, description, tags ON skill
+	FOR EACH ROW EXECUTE FUNCTION skill_search_update();
+
+UPDATE skill SET name = name WHERE search IS NULL;
+
+CREATE INDEX IF NOT EXISTS skill_search_idx ON skill USING GIN (search);
+
+CREATE TABLE IF NOT EXISTS command (
+	id TEXT PRIMARY KEY,
+	action TEXT NOT NULL,
+	skill_key TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS outbox (
+	seq BIGSERIAL PRIMARY KEY,
+	id TEXT NOT NULL UNIQUE,
+	command_id TEXT NOT NULL,
+	action TEXT NOT NULL,
+	skill_key TEXT NOT NULL,
+	expected_version BIGINT NOT NULL DEFAULT 0,
+	actor TEXT NOT NULL DEFAULT '',
+	metadata JSONB NOT NULL DEFAULT '{}',
+	trace_context JSONB NOT NULL DEFAULT '{}',
+	payload JSONB NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INT NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	sent_at TIMESTAMPTZ
+);
+
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS expected_version BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS actor TEXT NOT NULL DEFAULT '';
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS trace_context JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (seq) WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS processed_events (
+	event_id TEXT PRIMARY KEY,
+	processed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS change_outbox (
+	seq BIGSERIAL PRIMARY KEY,
+	id TEXT NOT NULL UNIQUE,
+	skill_key TEXT NOT NULL,
+	version BIGINT NOT NULL,
+	type TEXT NOT NULL,
+	payload JSONB NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INT NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	sent_at TIMESTAMPTZ,
+	UNIQUE (skill_key, version)
+);
+
+CREATE INDEX IF NOT EXISTS change_outbox_pending_idx ON change_outbox (seq) WHERE status = 'pending';
+
+-- The version of the last change of each deleted skill, so a skill created
+-- again under its key goes on from it instead of reusing its versions.
+CREATE TABLE IF NOT EXISTS skill_tombstone (
+	key TEXT PRIMARY KEY,
+	version BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS skill_audit (
+	seq BIGSERIAL PRIMARY KEY,
+	skill_key TEXT NOT NULL,
+	action TEXT NOT NULL,
+	version BIGINT NOT NULL DEFAULT 0,
+	actor TEXT NOT NULL DEFAULT '',
+	event_id TEXT NOT NULL,
+	correlation_id TEXT NOT NULL DEFAULT '',
+	source_topic TEXT NOT NULL,
+	source_partition INT NOT NULL,
+	source_offset BIGINT NOT NULL,
+	metadata JSONB NOT NULL DEFAULT '{}',
+	diff JSONB NOT NULL,
+	occurred_at TIMESTAMPTZ NOT NULL,
+	recorded_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE skill_audit ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS skill_audit_key_idx ON skill_audit (skill_key, seq);
+
+-- The audit log is append-only, rows can be added but never changed.
+CREATE OR REPLACE FUNCTION skill_audit_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'skill_audit is append-only';
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS skill_audit_append_only_trigger ON skill_audit;
+CREATE TRIGGER skill_audit_append_only_trigger BEFORE UPDATE OR DELETE ON skill_audit
+	FOR EACH ROW EXECUTE FUNCTION skill_audit_append_only();
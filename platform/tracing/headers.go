@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"github.com/IBM/sarama"
+)
+
+// ProducerHeaders lets a propagator write the trace context into the headers
+// of a kafka message.
+type ProducerHeaders struct {
+	Msg *sarama.ProducerMessage
+}
+
+func (h ProducerHeaders) Get(key string) string {
+	for _, header := range h.Msg.Headers {
+		if string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// Set replaces any header with the same key, so a message sent again keeps
+// one trace context.
+func (h ProducerHeaders) Set(key string, value string) {
+	for i, header := range h.Msg.Headers {
+		if string(header.Key) == key {
+			h.Msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	h.Msg.Headers = append(h.Msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+func (h ProducerHeaders) Keys() []string {
+	keys := make([]string, len(h.Msg.Headers))
+	for i, header := range h.Msg.Headers {
+		keys[i] = string(header.Key)
+	}
+	return keys
+}
+
+// ConsumerHeaders lets a propagator read the trace context from the headers
+// of a consumed kafka message.
+type ConsumerHeaders struct {
+	Msg *sarama.ConsumerMessage
+}
+
+func (h ConsumerHeaders) Get(key string) string {
+	for _, header := range h.Msg.Headers {
+		if header != nil && string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func (h ConsumerHeaders) Set(key string, value string) {
+	for _, header := range h.Msg.Headers {
+		if header != nil && string(header.Key) == key {
+			header.Value = []byte(value)
+			return
+		}
+	}
+	h.Msg.Headers = append(h.Msg.Headers, &sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+func (h ConsumerHeaders) Keys() []string {
+	keys := make([]string, 0, len(h.Msg.Headers))
+	for _, header := range h.Msg.Headers {
+		if header != nil {
+			keys = append(keys, string(header.Key))
+		}
+	}
+	return keys
+}
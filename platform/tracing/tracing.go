@@ -0,0 +1,99 @@
+// Package tracing sets up OpenTelemetry and carries the W3C trace context
+// from a request, through the outbox and the kafka message headers, into the
+// consumer.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"platform/configload"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "platform/tracing"
+
+type Config struct {
+	// Exporter is none, stdout or otlp.
+	Exporter string `yaml:"exporter"`
+	// Endpoint is the host:port of the OTLP HTTP collector.
+	Endpoint string `yaml:"endpoint"`
+	// Insecure talks to the collector over plain HTTP.
+	Insecure    bool   `yaml:"insecure"`
+	ServiceName string `yaml:"service_name"`
+}
+
+// Validate reports the tracing settings Setup can't work with.
+func Validate(cfg Config) []error {
+	problems := []error{}
+	switch cfg.Exporter {
+	case "none", "stdout":
+	case "otlp":
+		if cfg.Endpoint == "" {
+			problems = append(problems, configload.Required("tracing.endpoint"))
+		}
+	default:
+		problems = append(problems, configload.Invalid("tracing.exporter", "must be none, stdout or otlp"))
+	}
+	if cfg.ServiceName == "" {
+		problems = append(problems, configload.Required("tracing.service_name"))
+	}
+	return problems
+}
+
+// Tracer starts the spans of both services. They are told apart by the
+// service name on the provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Setup installs the W3C propagator and a tracer provider sending spans to
+// the configured exporter. The returned function flushes and stops it. With
+// the none exporter spans are still propagated but not recorded.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New()
+	case "otlp":
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		err = fmt.Errorf("unknown exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Inject writes the trace context of ctx into carrier.
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+}
+
+// Extract returns ctx with the trace context found in carrier.
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
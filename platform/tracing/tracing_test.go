@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"platform/tracing/tracingtest"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestHeaders(t *testing.T) {
+	t.Run("should carry the trace context from a produced to a consumed message", func(t *testing.T) {
+		//arange
+		tracingtest.InMemory()
+		ctx, span := Tracer().Start(context.Background(), "publish skills")
+		produced := &sarama.ProducerMessage{Headers: []sarama.RecordHeader{{Key: []byte("event-type"), Value: []byte("create")}}}
+
+		//act
+		Inject(ctx, ProducerHeaders{Msg: produced})
+		Inject(ctx, ProducerHeaders{Msg: produced})
+		consumed := &sarama.ConsumerMessage{}
+		for _, header := range produced.Headers {
+			consumed.Headers = append(consumed.Headers, &sarama.RecordHeader{Key: header.Key, Value: header.Value})
+		}
+		extracted := Extract(context.Background(), ConsumerHeaders{Msg: consumed})
+		span.End()
+
+		//assert
+		assert.Equal(t, []string{"event-type", "traceparent"}, ProducerHeaders{Msg: produced}.Keys())
+		assert.Equal(t, span.SpanContext().TraceID(), trace.SpanContextFromContext(extracted).TraceID())
+	})
+	t.Run("should skip nil headers of a consumed message", func(t *testing.T) {
+		//arange
+		msg := &sarama.ConsumerMessage{Headers: []*sarama.RecordHeader{nil, {Key: []byte("traceparent"), Value: []byte("00-1")}}}
+		headers := ConsumerHeaders{Msg: msg}
+
+		//act
+		headers.Set("tracestate", "a=b")
+
+		//assert
+		assert.Equal(t, "00-1", headers.Get("traceparent"))
+		assert.Equal(t, []string{"traceparent", "tracestate"}, headers.Keys())
+	})
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("should need an endpoint to export spans over OTLP", func(t *testing.T) {
+		//act
+		missing := errors.Join(Validate(Config{Exporter: "otlp", ServiceName: "skill-api"})...)
+		unknown := errors.Join(Validate(Config{Exporter: "jaeger"})...)
+		valid := Validate(Config{Exporter: "otlp", Endpoint: "collector:4318", ServiceName: "skill-api"})
+
+		//assert
+		assert.EqualError(t, missing, "tracing.endpoint is required")
+		assert.ErrorContains(t, unknown, "tracing.exporter must be none, stdout or otlp")
+		assert.ErrorContains(t, unknown, "tracing.service_name is required")
+		assert.Empty(t, valid)
+	})
+}
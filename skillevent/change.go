@@ -0,0 +1,35 @@
+package skillevent
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ChangeType names a domain event the consumer publishes once a change is
+// committed.
+type ChangeType string
+
+const (
+	SkillCreated ChangeType = "SkillCreated"
+	SkillUpdated ChangeType = "SkillUpdated"
+	SkillDeleted ChangeType = "SkillDeleted"
+)
+
+// Change is a committed change to one skill. Unlike the command events it
+// only exists for writes that were applied. Version counts the changes of the
+// skill and keeps growing across a delete and re-create, so subscribers can
+// drop what they have already seen.
+type Change struct {
+	ID      string     `json:"id"`
+	Type    ChangeType `json:"type"`
+	Key     string     `json:"key"`
+	Version int64      `json:"version"`
+	// CausationID is the id of the command event that made the change.
+	CausationID   string    `json:"causation_id,omitempty"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	OccurredAt    time.Time `json:"occurred_at"`
+	// Before and After are the skill around the change, absent for a create
+	// and a delete respectively.
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
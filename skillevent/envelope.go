@@ -0,0 +1,89 @@
+package skillevent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const CurrentVersion = 1
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported event schema version")
+	ErrMissingType        = errors.New("event type is missing")
+)
+
+type Envelope struct {
+	ID            string    `json:"id"`
+	Type          Type      `json:"type"`
+	SchemaVersion int       `json:"schema_version"`
+	OccurredAt    time.Time `json:"occurred_at"`
+	Actor         string    `json:"actor,omitempty"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	// ExpectedVersion is the skill version the write was based on, zero when
+	// the caller did not ask for a version check.
+	ExpectedVersion int64 `json:"expected_version,omitempty"`
+	// Metadata describes the request behind the event, such as its request
+	// id, client ip and user agent. It is kept for the audit log.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Payload  json.RawMessage   `json:"payload"`
+}
+
+// upcasters turn an envelope of version N into version N+1.
+var upcasters = map[int]func(Envelope) Envelope{
+	// Version 0 is the bare payload published before the envelope existed.
+	0: func(e Envelope) Envelope {
+		e.SchemaVersion = 1
+		return e
+	},
+}
+
+func (e Envelope) DecodePayload(v any) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+// Encode stamps the current schema version on the envelope and marshals it.
+func Encode(e Envelope) ([]byte, error) {
+	if e.Type == "" {
+		return nil, ErrMissingType
+	}
+	e.SchemaVersion = CurrentVersion
+	return json.Marshal(e)
+}
+
+// Decode parses a kafka value and upcasts it to CurrentVersion. A value
+// without schema_version is a pre-envelope payload; legacyType is used as its
+// type, which is what those producers put in the message key.
+func Decode(data []byte, legacyType Type) (Envelope, error) {
+	var probe struct {
+		SchemaVersion *int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return Envelope{}, err
+	}
+
+	e := Envelope{}
+	if probe.SchemaVersion == nil {
+		e.Type = legacyType
+		e.Payload = json.RawMessage(data)
+	} else if err := json.Unmarshal(data, &e); err != nil {
+		return Envelope{}, err
+	}
+
+	if e.SchemaVersion > CurrentVersion {
+		return Envelope{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, e.SchemaVersion)
+	}
+	for e.SchemaVersion < CurrentVersion {
+		upcast, ok := upcasters[e.SchemaVersion]
+		if !ok {
+			return Envelope{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, e.SchemaVersion)
+		}
+		e = upcast(e)
+	}
+
+	if e.Type == "" {
+		return Envelope{}, ErrMissingType
+	}
+	return e, nil
+}
@@ -0,0 +1,131 @@
+package skillevent
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	t.Run("should decode what was encoded", func(t *testing.T) {
+		//arange
+		payload, _ := json.Marshal(NameUpdateMessage{Key: "go", Name: "golang"})
+		want := Envelope{
+			ID:              "event-id",
+			Type:            UpdateName,
+			OccurredAt:      time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+			Actor:           "gopher",
+			CorrelationID:   "command-id",
+			ExpectedVersion: 3,
+			Payload:         payload,
+		}
+
+		//act
+		data, err := Encode(want)
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %v", err)
+		}
+		got, err := Decode(data, "")
+
+		//assert
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %v", err)
+		}
+		if got.ID != want.ID || got.Type != want.Type || got.Actor != want.Actor || got.CorrelationID != want.CorrelationID || got.ExpectedVersion != want.ExpectedVersion {
+			t.Errorf("expected %+v but got %+v", want, got)
+		}
+		if !got.OccurredAt.Equal(want.OccurredAt) {
+			t.Errorf("expected occurred at %v but got %v", want.OccurredAt, got.OccurredAt)
+		}
+		if got.SchemaVersion != CurrentVersion {
+			t.Errorf("expected schema version %d but got %d", CurrentVersion, got.SchemaVersion)
+		}
+
+		message := NameUpdateMessage{}
+		if err := got.DecodePayload(&message); err != nil {
+			t.Fatalf("expected error to be nil but got %v", err)
+		}
+		if message.Name != "golang" {
+			t.Errorf("expected name golang but got %q", message.Name)
+		}
+	})
+	t.Run("should return error when encode without type", func(t *testing.T) {
+		//act
+		_, err := Encode(Envelope{ID: "event-id"})
+
+		//assert
+		if !errors.Is(err, ErrMissingType) {
+			t.Errorf("expected ErrMissingType but got %v", err)
+		}
+	})
+}
+
+func TestDecode(t *testing.T) {
+	t.Run("should upcast bare payload using legacy type", func(t *testing.T) {
+		//arange
+		data := []byte(`{"Key":"go","Name":"golang"}`)
+
+		//act
+		got, err := Decode(data, UpdateName)
+
+		//assert
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %v", err)
+		}
+		if got.Type != UpdateName {
+			t.Errorf("expected type %q but got %q", UpdateName, got.Type)
+		}
+		if got.SchemaVersion != CurrentVersion {
+			t.Errorf("expected schema version %d but got %d", CurrentVersion, got.SchemaVersion)
+		}
+		if string(got.Payload) != string(data) {
+			t.Errorf("expected payload %s but got %s", data, got.Payload)
+		}
+	})
+	t.Run("should reject newer schema version", func(t *testing.T) {
+		//arange
+		data := []byte(`{"id":"event-id","type":"create","schema_version":99,"payload":{}}`)
+
+		//act
+		_, err := Decode(data, "")
+
+		//assert
+		if !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("expected ErrUnsupportedVersion but got %v", err)
+		}
+	})
+	t.Run("should reject negative schema version", func(t *testing.T) {
+		//arange
+		data := []byte(`{"id":"event-id","type":"create","schema_version":-1,"payload":{}}`)
+
+		//act
+		_, err := Decode(data, "")
+
+		//assert
+		if !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("expected ErrUnsupportedVersion but got %v", err)
+		}
+	})
+	t.Run("should return error when type is missing", func(t *testing.T) {
+		//arange
+		data := []byte(`{"Key":"go"}`)
+
+		//act
+		_, err := Decode(data, "")
+
+		//assert
+		if !errors.Is(err, ErrMissingType) {
+			t.Errorf("expected ErrMissingType but got %v", err)
+		}
+	})
+	t.Run("should return error when value is not json object", func(t *testing.T) {
+		//act
+		_, err := Decode([]byte(`"not an event"`), CreateSkill)
+
+		//assert
+		if err == nil {
+			t.Errorf("expected error but got %v", err)
+		}
+	})
+}
@@ -0,0 +1,3 @@
+module skillevent
+
+go 1.22.5
@@ -0,0 +1,25 @@
+package skillevent
+
+type NameUpdateMessage struct {
+	Key  string
+	Name string
+}
+
+type DescriptionUpdateMessage struct {
+	Key         string
+	Description string
+}
+
+type LogoUpdateMessage struct {
+	Key  string
+	Logo string
+}
+
+type TagsUpdateMessage struct {
+	Key  string
+	Tags []string
+}
+
+type DeleteMessage struct {
+	Key string
+}
@@ -0,0 +1,33 @@
+package skillevent
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Outcome is what the consumer did with an event.
+type Outcome string
+
+const (
+	// OutcomeApplied means the change is in the database, or already was.
+	OutcomeApplied Outcome = "applied"
+	// OutcomeRejected means the event can never apply: it is invalid or was
+	// based on a stale skill version.
+	OutcomeRejected Outcome = "rejected"
+	// OutcomeFailed means the consumer gave up after retrying.
+	OutcomeFailed Outcome = "failed"
+)
+
+// Result is published to the reply topic after every consumed message.
+type Result struct {
+	EventID       string  `json:"event_id,omitempty"`
+	CorrelationID string  `json:"correlation_id,omitempty"`
+	Type          Type    `json:"type,omitempty"`
+	Key           string  `json:"key"`
+	Outcome       Outcome `json:"outcome"`
+	// Skill is the skill as it is after the message, absent when it does
+	// not exist.
+	Skill       json.RawMessage `json:"skill,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	ProcessedAt time.Time       `json:"processed_at"`
+}
@@ -0,0 +1,13 @@
+package skillevent
+
+type Type string
+
+const (
+	CreateSkill Type = "create"
+	UpdateSkill Type = "update"
+	DeleteSkill Type = "delete"
+	UpdateName  Type = "update_name"
+	UpdateDesc  Type = "update_desc"
+	UpdateLogo  Type = "update_logo"
+	UpdateTags  Type = "update_tags"
+)
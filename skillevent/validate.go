@@ -0,0 +1,126 @@
+package skillevent
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	MaxKeyLength  = 64
+	MaxNameLength = 100
+	MaxTags       = 20
+	MaxTagLength  = 50
+)
+
+var keyPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// ReservedKeys name the routes and custom methods of the skills collection,
+// e.g. GET /api/v1/skills/search, so no skill can be shadowed by them.
+var ReservedKeys = []string{"search", "export", "import", "batch"}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every field of a skill payload that broke a rule.
+// The API returns it to the caller and the consumer rejects events with it.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Field + ": " + field.Message
+	}
+	return "invalid skill: " + strings.Join(messages, ", ")
+}
+
+// Validate collects the failed checks into a ValidationError, or returns nil
+// when every check passed.
+func Validate(checks ...*FieldError) error {
+	fields := []FieldError{}
+	for _, check := range checks {
+		if check != nil {
+			fields = append(fields, *check)
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: fields}
+}
+
+func ValidateSkill(key string, name string, logo string, tags []string) error {
+	return Validate(ValidateKey(key), ValidateName(name), ValidateLogo(logo), ValidateTags(tags))
+}
+
+func ValidateKey(key string) *FieldError {
+	if len(key) == 0 || len(key) > MaxKeyLength {
+		return &FieldError{Field: "key", Message: "must be between 1 and " + strconv.Itoa(MaxKeyLength) + " characters"}
+	}
+	if !keyPattern.MatchString(key) {
+		return &FieldError{Field: "key", Message: "must be lowercase letters and digits separated by single hyphens"}
+	}
+	for _, reserved := range ReservedKeys {
+		if key == reserved {
+			return &FieldError{Field: "key", Message: "must not be one of " + strings.Join(ReservedKeys, ", ")}
+		}
+	}
+	return nil
+}
+
+func ValidateName(name string) *FieldError {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return &FieldError{Field: "name", Message: "is required"}
+	}
+	if len([]rune(name)) > MaxNameLength {
+		return &FieldError{Field: "name", Message: "must be at most " + strconv.Itoa(MaxNameLength) + " characters"}
+	}
+	return nil
+}
+
+// ValidateLogo accepts an empty logo, otherwise an absolute http(s) URL.
+func ValidateLogo(logo string) *FieldError {
+	if logo == "" {
+		return nil
+	}
+	u, err := url.ParseRequestURI(logo)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &FieldError{Field: "logo", Message: "must be an http or https URL"}
+	}
+	return nil
+}
+
+// ValidateTags checks tags that already went through NormalizeTags.
+func ValidateTags(tags []string) *FieldError {
+	if len(tags) > MaxTags {
+		return &FieldError{Field: "tags", Message: "must have at most " + strconv.Itoa(MaxTags) + " tags"}
+	}
+	for _, tag := range tags {
+		if len([]rune(tag)) > MaxTagLength {
+			return &FieldError{Field: "tags", Message: "each tag must be at most " + strconv.Itoa(MaxTagLength) + " characters"}
+		}
+	}
+	return nil
+}
+
+// NormalizeTags trims and lowercases tags, collapses inner whitespace and
+// drops empty and repeated tags, keeping the first occurrence order.
+func NormalizeTags(tags []string) []string {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
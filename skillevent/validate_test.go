@@ -0,0 +1,87 @@
+package skillevent
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateSkill(t *testing.T) {
+	t.Run("should accept valid skill", func(t *testing.T) {
+		//act
+		err := ValidateSkill("go-lang", "Go", "https://go.dev/logo.svg", []string{"lang"})
+
+		//assert
+		if err != nil {
+			t.Errorf("expected error to be nil but got %v", err)
+		}
+	})
+	t.Run("should list every invalid field", func(t *testing.T) {
+		//act
+		err := ValidateSkill("Go Lang", "  ", "javascript:alert(1)", make([]string, MaxTags+1))
+
+		//assert
+		var validation *ValidationError
+		if !errors.As(err, &validation) {
+			t.Fatalf("expected ValidationError but got %v", err)
+		}
+		fields := []string{}
+		for _, field := range validation.Fields {
+			fields = append(fields, field.Field)
+		}
+		if !reflect.DeepEqual(fields, []string{"key", "name", "logo", "tags"}) {
+			t.Errorf("expected key, name, logo and tags errors but got %v", fields)
+		}
+	})
+}
+
+func TestValidateKey(t *testing.T) {
+	valid := []string{"go", "1", "test-key", "a1-b2-c3"}
+	invalid := []string{"", "Go", "go_kit", "-go", "go-", "go--lang", "go lang", strings.Repeat("a", MaxKeyLength+1), "search", "export", "import", "batch"}
+
+	for _, key := range valid {
+		if err := ValidateKey(key); err != nil {
+			t.Errorf("expected %q to be valid but got %v", key, err.Message)
+		}
+	}
+	for _, key := range invalid {
+		if err := ValidateKey(key); err == nil {
+			t.Errorf("expected %q to be invalid", key)
+		}
+	}
+}
+
+func TestValidateReservedKey(t *testing.T) {
+	err := ValidateKey("search")
+	if err == nil || err.Message != "must not be one of search, export, import, batch" {
+		t.Errorf("expected search to be reserved but got %v", err)
+	}
+}
+
+func TestValidateLogo(t *testing.T) {
+	valid := []string{"", "http://example.com/logo.png", "https://example.com/logo.svg"}
+	invalid := []string{"logo", "ftp://example.com/logo.png", "https://", "/logo.png"}
+
+	for _, logo := range valid {
+		if err := ValidateLogo(logo); err != nil {
+			t.Errorf("expected %q to be valid but got %v", logo, err.Message)
+		}
+	}
+	for _, logo := range invalid {
+		if err := ValidateLogo(logo); err == nil {
+			t.Errorf("expected %q to be invalid", logo)
+		}
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	//act
+	got := NormalizeTags([]string{" Go ", "go", "", "Programming   Language", "web", "WEB"})
+
+	//assert
+	want := []string{"go", "programming language", "web"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v but got %v", want, got)
+	}
+}